@@ -0,0 +1,106 @@
+package jwt
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AttestationClaim is the claim name for the key inventory of Attest.
+const AttestationClaim = "trusted_keys"
+
+// AttestedKey is an entry of the key inventory from KeyRegister.Attest.
+type AttestedKey struct {
+	// Field is the name of the KeyRegister field with the key, i.e., one
+	// of "ECDSAs", "EdDSAs", "RSAs" or "Others".
+	Field string `json:"field"`
+	// KeyID is the identifier of the key from the register, if any.
+	KeyID string `json:"kid,omitempty"`
+	// PinSHA256 is the standard base64 encoding of the SPKIPin. Keys
+	// from Others without a PKIX encoding, e.g., ES256K, have none.
+	PinSHA256 string `json:"pin-sha256,omitempty"`
+}
+
+// Attest returns a signed inventory of the public keys in the register, with
+// the claims as a template, e.g., with the node identity as the subject. The
+// inventory goes in the AttestationClaim, in order of the register fields. An
+// issue time is set when absent. Secrets are left out, as a fingerprint would
+// enable offline guessing. So are Encryptions, as they verify no signature.
+// Keys from Others which x509.MarshalPKIXPublicKey does not support go in the
+// inventory without a pin, as their encoding is up to the RegisterAlg.
+// Downstream services Check the attestation with the public key of key, and
+// they read the inventory with Claims.AttestedKeys.
+func (keys *KeyRegister) Attest(template *Claims, alg string, key crypto.PrivateKey) ([]byte, error) {
+	var inventory []interface{}
+	add := func(field string, pub crypto.PublicKey, ids []string, i int) error {
+		entry := map[string]interface{}{"field": field}
+		pin, err := SPKIPin(pub)
+		switch {
+		case err == nil:
+			entry["pin-sha256"] = base64.StdEncoding.EncodeToString(pin[:])
+		case field != "Others":
+			return fmt.Errorf("jwt: attestation of %s[%d]: %w", field, i, err)
+		}
+		if i < len(ids) && ids[i] != "" {
+			entry[headerKeyID] = ids[i]
+		}
+		inventory = append(inventory, entry)
+		return nil
+	}
+	for i, k := range keys.ECDSAs {
+		if err := add("ECDSAs", k, keys.ECDSAIDs, i); err != nil {
+			return nil, err
+		}
+	}
+	for i, k := range keys.EdDSAs {
+		if err := add("EdDSAs", k, keys.EdDSAIDs, i); err != nil {
+			return nil, err
+		}
+	}
+	for i, k := range keys.RSAs {
+		if err := add("RSAs", k, keys.RSAIDs, i); err != nil {
+			return nil, err
+		}
+	}
+	for i, k := range keys.Others {
+		if err := add("Others", k, keys.OtherIDs, i); err != nil {
+			return nil, err
+		}
+	}
+	if inventory == nil {
+		inventory = []interface{}{}
+	}
+
+	c := new(Claims)
+	if template != nil {
+		c = template.Clone()
+	}
+	if c.Issued == nil {
+		c.Issued = NewNumericTime(time.Now().Truncate(time.Second))
+	}
+	if c.Set == nil {
+		c.Set = make(map[string]interface{})
+	}
+	c.Set[AttestationClaim] = inventory
+	return c.Sign(alg, key)
+}
+
+// AttestedKeys returns the key inventory from KeyRegister.Attest. Make sure
+// the claims come from a Check with the attestation key.
+func (c *Claims) AttestedKeys() ([]AttestedKey, error) {
+	v, ok := c.Set[AttestationClaim]
+	if !ok {
+		return nil, fmt.Errorf("jwt: no %s claim", AttestationClaim)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var inventory []AttestedKey
+	if err := json.Unmarshal(data, &inventory); err != nil {
+		return nil, fmt.Errorf("jwt: malformed %s claim: %w", AttestationClaim, err)
+	}
+	return inventory, nil
+}
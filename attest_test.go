@@ -0,0 +1,69 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestKeyRegisterAttest(t *testing.T) {
+	keys := &KeyRegister{
+		ECDSAs:    []*ecdsa.PublicKey{&testKeyEC256.PublicKey},
+		RSAs:      []*rsa.PublicKey{&testKeyRSA2048.PublicKey},
+		Secrets:   [][]byte{[]byte("guest")},
+		ECDSAIDs:  []string{"ec"},
+		SecretIDs: []string{"not disclosed"},
+	}
+	var template Claims
+	template.Subject = "node-7"
+	token, err := keys.Attest(&template, EdDSA, testKeyEd25519Private)
+	if err != nil {
+		t.Fatal("attest error:", err)
+	}
+	if template.Set != nil {
+		t.Error("template modified")
+	}
+
+	attestation := &KeyRegister{EdDSAs: []ed25519.PublicKey{testKeyEd25519Public}}
+	c, err := attestation.Check(token)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if c.Subject != "node-7" || c.Issued == nil {
+		t.Errorf("got subject %q and issued %v, want node-7 with a time", c.Subject, c.Issued)
+	}
+	got, err := c.AttestedKeys()
+	if err != nil {
+		t.Fatal("attested keys error:", err)
+	}
+
+	ecPin, _ := SPKIPin(&testKeyEC256.PublicKey)
+	rsaPin, _ := SPKIPin(&testKeyRSA2048.PublicKey)
+	want := []AttestedKey{
+		{Field: "ECDSAs", KeyID: "ec", PinSHA256: base64.StdEncoding.EncodeToString(ecPin[:])},
+		{Field: "RSAs", PinSHA256: base64.StdEncoding.EncodeToString(rsaPin[:])},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got inventory %+v, want %+v", got, want)
+	}
+
+	// empty register
+	token, err = new(KeyRegister).Attest(nil, EdDSA, testKeyEd25519Private)
+	if err != nil {
+		t.Fatal("attest error:", err)
+	}
+	c, err = attestation.Check(token)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if got, err := c.AttestedKeys(); err != nil || len(got) != 0 {
+		t.Errorf("got inventory %+v, %v for an empty register, want none", got, err)
+	}
+
+	if _, err := new(Claims).AttestedKeys(); err == nil {
+		t.Error("no error without attestation claim")
+	}
+}
@@ -0,0 +1,250 @@
+// Package azure provides signing with keys from Azure Key Vault, such that
+// private keys never enter the process memory. A Key implements crypto.Signer
+// for use with jwt.Claims.Sign and with jwt.SignBytes.
+//
+// The package talks to the Key Vault REST API directly. Authentication is left
+// to the caller, in the form of a function which provides OAuth 2.0 access
+// tokens for the "https://vault.azure.net" resource, e.g., from the Azure SDK
+// or from a managed identity endpoint. The key needs the "sign" operation
+// permitted, and the identity needs the "get" permission on keys.
+package azure
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// APIVersion is the Key Vault REST API version in use.
+const APIVersion = "7.4"
+
+// Vault is a Key Vault client.
+type Vault struct {
+	// URL is the vault location, e.g., "https://example.vault.azure.net".
+	URL string
+
+	// AccessToken returns a bearer token for each request.
+	AccessToken func(ctx context.Context) (string, error)
+
+	// Client performs the requests. Nil defaults to http.DefaultClient.
+	// Set a timeout on the client, as crypto.Signer has no context.
+	Client *http.Client
+}
+
+// Key is a specific version of a Key Vault key. Supported are both RSA and EC
+// keys, including the HSM variants. Multiple goroutines may invoke methods on a
+// Key simultaneously.
+type Key struct {
+	// Alg is the JOSE algorithm. Key loading sets RS256 for RSA keys,
+	// and ES256, ES384 or ES512 for EC keys, conform the curve. RSA
+	// keys may use any of jwt.RSAAlgs instead.
+	Alg string
+
+	// ID is the key identifier from Key Vault, which is a URL with the
+	// name and the version of the key.
+	ID string
+
+	// KeyID is the version from ID, for use as the "kid" in JOSE headers.
+	KeyID string
+
+	vault  *Vault
+	public crypto.PublicKey
+}
+
+// Key loads a key in a specific version. The empty version selects the latest.
+func (v *Vault) Key(ctx context.Context, name, version string) (*Key, error) {
+	path := "/keys/" + url.PathEscape(name)
+	if version != "" {
+		path += "/" + url.PathEscape(version)
+	}
+	var bundle struct {
+		Key map[string]interface{} `json:"key"`
+	}
+	if err := v.do(ctx, http.MethodGet, path, nil, &bundle); err != nil {
+		return nil, err
+	}
+
+	k := &Key{vault: v}
+	k.ID, _ = bundle.Key["kid"].(string)
+	if i := strings.LastIndexByte(k.ID, '/'); i >= 0 {
+		k.KeyID = k.ID[i+1:]
+	}
+	if k.KeyID == "" {
+		return nil, fmt.Errorf("azure: key %q without version in identifier %q", name, k.ID)
+	}
+
+	// JWK without the Azure extensions
+	jwk := make(map[string]interface{})
+	for _, param := range []string{"kty", "crv", "x", "y", "n", "e"} {
+		if v, ok := bundle.Key[param]; ok {
+			jwk[param] = v
+		}
+	}
+	if kty, ok := jwk["kty"].(string); ok {
+		jwk["kty"] = strings.TrimSuffix(kty, "-HSM")
+	}
+	data, err := json.Marshal(jwk)
+	if err != nil {
+		return nil, err
+	}
+	var keys jwt.KeyRegister
+	if _, err := keys.LoadJWK(data); err != nil {
+		return nil, fmt.Errorf("azure: key %q: %w", name, err)
+	}
+	switch {
+	case len(keys.RSAs) == 1:
+		k.public = keys.RSAs[0]
+		k.Alg = jwt.RS256
+	case len(keys.ECDSAs) == 1:
+		k.public = keys.ECDSAs[0]
+		switch keys.ECDSAs[0].Curve.Params().BitSize {
+		case 256:
+			k.Alg = jwt.ES256
+		case 384:
+			k.Alg = jwt.ES384
+		case 521:
+			k.Alg = jwt.ES512
+		}
+	}
+	if k.Alg == "" {
+		return nil, fmt.Errorf("azure: key %q of type %q not supported", name, jwk["kty"])
+	}
+	return k, nil
+}
+
+// Public honors the crypto.Signer interface.
+func (k *Key) Public() crypto.PublicKey { return k.public }
+
+// Sign honors the crypto.Signer interface. The random source is not used. ECDSA
+// signatures are in ASN.1, conform the crypto package.
+func (k *Key) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+// SignContext is like Sign, with a context for the HTTP request.
+func (k *Key) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash, ok := jwt.ECDSAAlgs[k.Alg]
+	if !ok {
+		hash, ok = jwt.RSAAlgs[k.Alg]
+	}
+	if !ok {
+		return nil, jwt.AlgError(k.Alg)
+	}
+	_, pss := opts.(*rsa.PSSOptions)
+	if opts.HashFunc() != hash || pss != (k.Alg[0] == 'P') {
+		return nil, fmt.Errorf("azure: signer options don't match algorithm %s", k.Alg)
+	}
+
+	req := map[string]string{
+		"alg":   k.Alg,
+		"value": base64.RawURLEncoding.EncodeToString(digest),
+	}
+	var result struct {
+		Value string `json:"value"`
+	}
+	if err := k.vault.do(ctx, http.MethodPost, k.path()+"/sign", req, &result); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(result.Value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("azure: malformed signature: %w", err)
+	}
+
+	if _, ok := k.public.(*ecdsa.PublicKey); ok {
+		// Key Vault returns r || s, conform RFC 7518, subsection 3.4
+		if len(sig) == 0 || len(sig)%2 != 0 {
+			return nil, errors.New("azure: malformed ECDSA signature")
+		}
+		var pair struct{ R, S *big.Int }
+		pair.R = new(big.Int).SetBytes(sig[:len(sig)/2])
+		pair.S = new(big.Int).SetBytes(sig[len(sig)/2:])
+		return asn1.Marshal(pair)
+	}
+	return sig, nil
+}
+
+// SignClaims is like jwt.Claims.Sign with Alg, and it sets the KeyID of the
+// claims to the key version, unless already set.
+func (k *Key) SignClaims(c *jwt.Claims, extraHeaders ...json.RawMessage) (token []byte, err error) {
+	if c.KeyID == "" {
+		c.KeyID = k.KeyID
+	}
+	return c.Sign(k.Alg, k, extraHeaders...)
+}
+
+// Path returns the URL path with the name and the version.
+func (k *Key) path() string {
+	if u, err := url.Parse(k.ID); err == nil {
+		return u.EscapedPath()
+	}
+	return ""
+}
+
+// Do sends the request, and it decodes a successful response into result.
+func (v *Vault) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var content io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(b)
+	}
+	location := strings.TrimSuffix(v.URL, "/") + path + "?api-version=" + APIVersion
+	req, err := http.NewRequestWithContext(ctx, method, location, content)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	token, err := v.AccessToken(ctx)
+	if err != nil {
+		return fmt.Errorf("azure: access token unavailable: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(respBody, &e)
+		return fmt.Errorf("azure: %s %s got HTTP status %q: %s: %s", method, path, resp.Status, e.Error.Code, e.Error.Message)
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("azure: %s %s got malformed response: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package azure
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// FakeVault mimics Key Vault with one version per key.
+type fakeVault struct {
+	t    *testing.T
+	keys map[string]crypto.Signer
+}
+
+const testVersion = "78deebed173b48e48f55abf87ed4cf71"
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if got := r.URL.Query().Get("api-version"); got != APIVersion {
+		f.t.Errorf("fake Key Vault got API version %q, want %q", got, APIVersion)
+	}
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"code":"Unauthorized","message":"AKV10000: Request is missing a Bearer or PoP token."}}`))
+		return
+	}
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/keys/"), "/")
+	key, ok := f.keys[path[0]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":"KeyNotFound","message":"A key with (name/id) was not found in this key vault."}}`))
+		return
+	}
+	kid := "https://example.vault.azure.net/keys/" + path[0] + "/" + testVersion
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch {
+	case r.Method == http.MethodGet && len(path) <= 2:
+		jwk := map[string]interface{}{"kid": kid, "key_ops": []string{"sign", "verify"}}
+		switch pub := key.Public().(type) {
+		case *ecdsa.PublicKey:
+			jwk["kty"] = "EC-HSM"
+			jwk["crv"] = "P-256"
+			jwk["x"] = b64(pad32(pub.X))
+			jwk["y"] = b64(pad32(pub.Y))
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = b64(pub.N.Bytes())
+			jwk["e"] = b64(big.NewInt(int64(pub.E)).Bytes())
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"key": jwk})
+
+	case r.Method == http.MethodPost && len(path) == 3 && path[1] == testVersion && path[2] == "sign":
+		var req struct{ Alg, Value string }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.t.Error("fake Key Vault request body:", err)
+		}
+		digest, _ := base64.RawURLEncoding.DecodeString(req.Value)
+		hash := jwt.ECDSAAlgs[req.Alg]
+		if hash == 0 {
+			hash = jwt.RSAAlgs[req.Alg]
+		}
+		var sig []byte
+		switch k := key.(type) {
+		case *ecdsa.PrivateKey:
+			r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+			if err != nil {
+				f.t.Error("fake Key Vault sign:", err)
+			}
+			sig = append(pad32(r), pad32(s)...)
+		case *rsa.PrivateKey:
+			var err error
+			if req.Alg[0] == 'P' {
+				sig, err = rsa.SignPSS(rand.Reader, k, hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+			} else {
+				sig, err = rsa.SignPKCS1v15(rand.Reader, k, hash, digest)
+			}
+			if err != nil {
+				f.t.Error("fake Key Vault sign:", err)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]string{"kid": kid, "value": b64(sig)})
+
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+// Pad32 returns the big-endian representation in 32 bytes.
+func pad32(i *big.Int) []byte {
+	b := i.Bytes()
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+// TestKeyEC has an X coordinate with a leading zero byte, which must encode
+// in full size nonetheless.
+var testKeyEC = &ecdsa.PrivateKey{
+	PublicKey: ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     hexInt("003e982ebca261d62fb23da157d7cd68f8a7170b27a7d57d8bd4c8c00542dfa4"),
+		Y:     hexInt("07f13ebe83c37b6b5452bce1d82bdabd57cbee4df74712bbcdd41769d60b1bed"),
+	},
+	D: hexInt("c6be75a610757adc31594b59fca2584727ad9ddbc8aba13ca28d23dd1e177aa5"),
+}
+
+func hexInt(s string) *big.Int {
+	i, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("malformed test integer " + s)
+	}
+	return i
+}
+
+func newFakeVault(t *testing.T) (vault *Vault, keys map[string]crypto.Signer, close func()) {
+	ecKey := testKeyEC
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = map[string]crypto.Signer{"ec": ecKey, "rsa": rsaKey}
+
+	srv := httptest.NewServer(&fakeVault{t: t, keys: keys})
+	vault = &Vault{
+		URL: srv.URL,
+		AccessToken: func(context.Context) (string, error) {
+			return "test-token", nil
+		},
+	}
+	return vault, keys, srv.Close
+}
+
+func TestSignClaims(t *testing.T) {
+	vault, signers, close := newFakeVault(t)
+	defer close()
+
+	golden := []struct{ name, alg string }{
+		{"ec", jwt.ES256},
+		{"rsa", jwt.RS256},
+		{"rsa", jwt.PS512},
+	}
+	for _, gold := range golden {
+		key, err := vault.Key(context.Background(), gold.name, "")
+		if err != nil {
+			t.Fatalf("%s: key error: %s", gold.name, err)
+		}
+		if key.KeyID != testVersion {
+			t.Errorf("%s: got key ID %q, want %q", gold.name, key.KeyID, testVersion)
+		}
+		key.Alg = gold.alg
+
+		var c jwt.Claims
+		c.Subject = "test"
+		token, err := key.SignClaims(&c)
+		if err != nil {
+			t.Errorf("%s: sign error: %s", gold.alg, err)
+			continue
+		}
+
+		var keys jwt.KeyRegister
+		switch pub := signers[gold.name].Public().(type) {
+		case *ecdsa.PublicKey:
+			keys.ECDSAs = append(keys.ECDSAs, pub)
+			keys.ECDSAIDs = append(keys.ECDSAIDs, testVersion)
+		case *rsa.PublicKey:
+			keys.RSAs = append(keys.RSAs, pub)
+			keys.RSAIDs = append(keys.RSAIDs, testVersion)
+		}
+		got, err := keys.Check(token)
+		if err != nil {
+			t.Errorf("%s: check error: %s", gold.alg, err)
+			continue
+		}
+		if got.KeyID != testVersion {
+			t.Errorf("%s: got key ID %q in header, want %q", gold.alg, got.KeyID, testVersion)
+		}
+		if got.Subject != "test" {
+			t.Errorf("%s: got subject %q, want test", gold.alg, got.Subject)
+		}
+	}
+}
+
+func TestKeyDefaultAlg(t *testing.T) {
+	vault, _, close := newFakeVault(t)
+	defer close()
+
+	for name, want := range map[string]string{"ec": jwt.ES256, "rsa": jwt.RS256} {
+		key, err := vault.Key(context.Background(), name, testVersion)
+		if err != nil {
+			t.Fatalf("%s: key error: %s", name, err)
+		}
+		if key.Alg != want {
+			t.Errorf("%s: got algorithm %q, want %q", name, key.Alg, want)
+		}
+	}
+}
+
+func TestSignOptsMismatch(t *testing.T) {
+	vault, _, close := newFakeVault(t)
+	defer close()
+	key, err := vault.Key(context.Background(), "rsa", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := key.Sign(nil, make([]byte, 48), crypto.SHA384); err == nil {
+		t.Error("RS256 key signed with SHA-384 options")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	vault, _, close := newFakeVault(t)
+	defer close()
+
+	_, err := vault.Key(context.Background(), "doesntexist", "")
+	const want = `azure: GET /keys/doesntexist got HTTP status "404 Not Found": KeyNotFound: A key with (name/id) was not found in this key vault.`
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+
+	tokenErr := errors.New("no identity")
+	vault.AccessToken = func(context.Context) (string, error) { return "", tokenErr }
+	if _, err := vault.Key(context.Background(), "ec", ""); !errors.Is(err, tokenErr) {
+		t.Errorf("got error %v, want %v", err, tokenErr)
+	}
+}
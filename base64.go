@@ -0,0 +1,140 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+)
+
+// The codec below is conform the strict encoding, i.e., base64.RawURLEncoding
+// with Strict, except that new lines are illegal too. Wide loads and stores of
+// 64 bits handle 6 bytes per iteration, and any illegal character in a block
+// of 8 shows up in one check on the combined lookups.
+
+const base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// Base64URLDecodeMap has the 6-bit value for each character of the alphabet.
+// Any other character maps to 0xff.
+var base64URLDecodeMap = func() (a [256]byte) {
+	for i := range a {
+		a[i] = 0xff
+	}
+	for i := 0; i < len(base64URLAlphabet); i++ {
+		a[base64URLAlphabet[i]] = byte(i)
+	}
+	return
+}()
+
+// DecodeBase64URL writes the base64url decoding of src into dst, which must
+// have a length of at least encoding.DecodedLen(len(src)). Illegal input gets
+// a base64.CorruptInputError with the same offset as the standard library.
+func decodeBase64URL(dst, src []byte) (n int, err error) {
+	m := &base64URLDecodeMap
+	si := 0
+	for len(src)-si >= 8 && len(dst)-n >= 8 {
+		s := src[si : si+8]
+		c0, c1, c2, c3 := m[s[0]], m[s[1]], m[s[2]], m[s[3]]
+		c4, c5, c6, c7 := m[s[4]], m[s[5]], m[s[6]], m[s[7]]
+		if (c0|c1|c2|c3|c4|c5|c6|c7)&0xc0 != 0 {
+			return n, corruptBase64(src, si)
+		}
+		binary.BigEndian.PutUint64(dst[n:], uint64(c0)<<58|uint64(c1)<<52|uint64(c2)<<46|uint64(c3)<<40|
+			uint64(c4)<<34|uint64(c5)<<28|uint64(c6)<<22|uint64(c7)<<16)
+		si += 8
+		n += 6
+	}
+	for len(src)-si >= 4 {
+		s := src[si : si+4]
+		c0, c1, c2, c3 := m[s[0]], m[s[1]], m[s[2]], m[s[3]]
+		if (c0|c1|c2|c3)&0xc0 != 0 {
+			return n, corruptBase64(src, si)
+		}
+		v := uint(c0)<<18 | uint(c1)<<12 | uint(c2)<<6 | uint(c3)
+		d := dst[n : n+3]
+		d[0], d[1], d[2] = byte(v>>16), byte(v>>8), byte(v)
+		si += 4
+		n += 3
+	}
+
+	switch len(src) - si {
+	case 0:
+		return n, nil
+	case 1:
+		// 6 bits don't make a byte
+		return n, base64.CorruptInputError(si)
+	case 2:
+		c0, c1 := m[src[si]], m[src[si+1]]
+		if (c0|c1)&0xc0 != 0 {
+			return n, corruptBase64(src, si)
+		}
+		if c1&0x0f != 0 {
+			// non-zero trailing bits
+			return n, base64.CorruptInputError(si)
+		}
+		dst[n] = c0<<2 | c1>>4
+		return n + 1, nil
+	default: // 3
+		c0, c1, c2 := m[src[si]], m[src[si+1]], m[src[si+2]]
+		if (c0|c1|c2)&0xc0 != 0 {
+			return n, corruptBase64(src, si)
+		}
+		if c2&0x03 != 0 {
+			// non-zero trailing bits
+			return n, base64.CorruptInputError(si + 2)
+		}
+		v := uint(c0)<<12 | uint(c1)<<6 | uint(c2)
+		dst[n], dst[n+1] = byte(v>>10), byte(v>>2)
+		return n + 2, nil
+	}
+}
+
+// CorruptBase64 returns the error for the first illegal character in src, at
+// or after offset i.
+func corruptBase64(src []byte, i int) error {
+	for ; i < len(src); i++ {
+		if base64URLDecodeMap[src[i]] == 0xff {
+			break
+		}
+	}
+	return base64.CorruptInputError(i)
+}
+
+// EncodeBase64URL writes the base64url encoding of src into dst, which must
+// have a length of at least encoding.EncodedLen(len(src)).
+func encodeBase64URL(dst, src []byte) {
+	const a = base64URLAlphabet
+	di, si := 0, 0
+	for len(src)-si >= 8 && len(dst)-di >= 8 {
+		// 6 bytes of the 64-bit load encode into 8 characters
+		v := binary.BigEndian.Uint64(src[si:])
+		d := dst[di : di+8]
+		d[0] = a[v>>58&0x3f]
+		d[1] = a[v>>52&0x3f]
+		d[2] = a[v>>46&0x3f]
+		d[3] = a[v>>40&0x3f]
+		d[4] = a[v>>34&0x3f]
+		d[5] = a[v>>28&0x3f]
+		d[6] = a[v>>22&0x3f]
+		d[7] = a[v>>16&0x3f]
+		si += 6
+		di += 8
+	}
+	for len(src)-si >= 3 {
+		v := uint(src[si])<<16 | uint(src[si+1])<<8 | uint(src[si+2])
+		d := dst[di : di+4]
+		d[0] = a[v>>18&0x3f]
+		d[1] = a[v>>12&0x3f]
+		d[2] = a[v>>6&0x3f]
+		d[3] = a[v&0x3f]
+		si += 3
+		di += 4
+	}
+
+	switch len(src) - si {
+	case 1:
+		v := uint(src[si])
+		dst[di], dst[di+1] = a[v>>2], a[v<<4&0x3f]
+	case 2:
+		v := uint(src[si])<<8 | uint(src[si+1])
+		dst[di], dst[di+1], dst[di+2] = a[v>>10], a[v>>4&0x3f], a[v<<2&0x3f]
+	}
+}
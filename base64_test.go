@@ -0,0 +1,64 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math/rand"
+	"testing"
+)
+
+func TestBase64URL(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for n := 0; n < 200; n++ {
+		src := make([]byte, n)
+		rnd.Read(src)
+
+		want := encoding.EncodeToString(src)
+		enc := make([]byte, encoding.EncodedLen(n))
+		encodeBase64URL(enc, src)
+		if string(enc) != want {
+			t.Errorf("%d bytes got encoding %q, want %q", n, enc, want)
+			continue
+		}
+
+		dec := make([]byte, encoding.DecodedLen(len(enc)))
+		got, err := decodeBase64URL(dec, enc)
+		if err != nil {
+			t.Errorf("%d bytes got decode error: %s", n, err)
+		} else if !bytes.Equal(dec[:got], src) {
+			t.Errorf("%d bytes got decoding %#x, want %#x", n, dec[:got], src)
+		}
+	}
+}
+
+func TestBase64URLCorrupt(t *testing.T) {
+	strict := encoding.Strict()
+	rnd := rand.New(rand.NewSource(42))
+	illegal := []byte("=+/ \r\n.\x00\xff")
+	for n := 0; n < 100; n++ {
+		src := make([]byte, n)
+		rnd.Read(src)
+		enc := []byte(encoding.EncodeToString(src))
+
+		for i := range enc {
+			for _, c := range illegal {
+				corrupt := append([]byte(nil), enc...)
+				corrupt[i] = c
+				_, err := decodeBase64URL(make([]byte, len(corrupt)), corrupt)
+				if err != base64.CorruptInputError(i) {
+					t.Errorf("%q got error %v, want %v", corrupt, err, base64.CorruptInputError(i))
+				}
+			}
+		}
+
+		// trailing bits and truncation conform the standard library
+		for _, tail := range []string{"A", "B", "Q", "AB", "AQ", "AAB"} {
+			corrupt := append(append([]byte(nil), enc[:len(enc)/4*4]...), tail...)
+			_, err := decodeBase64URL(make([]byte, len(corrupt)), corrupt)
+			_, want := strict.Decode(make([]byte, len(corrupt)), corrupt)
+			if err != want {
+				t.Errorf("%q got error %v, want %v", corrupt, err, want)
+			}
+		}
+	}
+}
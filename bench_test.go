@@ -1,8 +1,12 @@
 package jwt
 
 import (
+	"bytes"
 	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
+	"encoding/base64"
 	"fmt"
 	"testing"
 	"time"
@@ -118,6 +122,28 @@ func BenchmarkHMAC(b *testing.B) {
 			}
 		})
 	}
+
+	keys := &KeyRegister{Secrets: [][]byte{secret}}
+	token, err := benchClaims.HMACSign(HS256, secret)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("register-check", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := keys.Check(token); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("register-check-registered", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := keys.CheckRegistered(token); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
 }
 
 func BenchmarkRSA(b *testing.B) {
@@ -153,3 +179,76 @@ func BenchmarkRSA(b *testing.B) {
 		})
 	}
 }
+
+func BenchmarkBase64URL(b *testing.B) {
+	strict := encoding.Strict()
+	for _, size := range []int{64, 1024, 16 * 1024} {
+		src := make([]byte, size)
+		rand.Read(src)
+		enc := make([]byte, encoding.EncodedLen(size))
+		encoding.Encode(enc, src)
+		dec := make([]byte, encoding.DecodedLen(len(enc)))
+
+		b.Run(fmt.Sprintf("encode-%d", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				encodeBase64URL(enc, src)
+			}
+		})
+		b.Run(fmt.Sprintf("encode-%d-stdlib", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				encoding.Encode(enc, src)
+			}
+		})
+		b.Run(fmt.Sprintf("decode-%d", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if _, err := decode(dec, enc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("decode-%d-stdlib", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				// new line check as decode had before
+				if i := bytes.IndexAny(enc, "\r\n"); i >= 0 {
+					b.Fatal(base64.CorruptInputError(i))
+				}
+				if _, err := strict.Decode(dec, enc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUniformTiming(b *testing.B) {
+	token, err := new(Claims).ECDSASign(ES256, testKeyEC256)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("uniform", func(b *testing.B) {
+		keys := &KeyRegister{UniformTiming: true}
+		for i := 0; i < b.N; i++ {
+			keys.Check(token)
+		}
+	})
+	b.Run("one-key", func(b *testing.B) {
+		other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			b.Fatal(err)
+		}
+		keys := &KeyRegister{ECDSAs: []*ecdsa.PublicKey{&other.PublicKey}}
+		for i := 0; i < b.N; i++ {
+			keys.Check(token)
+		}
+	})
+	b.Run("no-key", func(b *testing.B) {
+		keys := new(KeyRegister)
+		for i := 0; i < b.N; i++ {
+			keys.Check(token)
+		}
+	})
+}
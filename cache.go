@@ -0,0 +1,198 @@
+package jwt
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// CheckCache memoizes successful verifications, for services which see the
+// same token on many requests. Entries are keyed by the SHA-256 of the token,
+// and they remain no longer than the expiration time of the respective claims.
+// Tokens without an "exp" claim are not cached. The least recently used entry
+// is dropped when the cache is full. Claims.Valid still applies on each hit.
+//
+// Revocation is tied in with the Revoke method, which drops any entries with
+// the JWT ID before it passes the invocation on to the Revocation field, when
+// set. Hits pass CheckHook, like misses do with Check. A miss which turns out
+// revoked passes CheckHook once more, with ErrRevoked, as Check reports on the
+// signature only. Multiple goroutines may invoke methods on a CheckCache
+// simultaneously.
+// Any modifications to the exported fields should be made before first use.
+type CheckCache struct {
+	// Check verifies tokens on cache misses, e.g., KeyRegister.Check,
+	// RegisterSet.Check or RemoteJWKS.Check.
+	Check func(token []byte) (*Claims, error)
+
+	// Size limits the number of entries. Zero defaults to 1024.
+	Size int
+
+	// Revocation, when set, is consulted on each hit and each miss.
+	// Revoked tokens get ErrRevoked.
+	Revocation Revocation
+
+	mutex   sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     list.List // *cacheEntry, most recently used in front
+}
+
+type cacheEntry struct {
+	hash    [sha256.Size]byte
+	claims  *Claims
+	alg     string // for CheckHook
+	expires time.Time
+}
+
+// VerifiedClaims returns the claims from a token with a valid signature. The
+// claims are Clone'd on cache hits, so callers may modify the return freely.
+func (cache *CheckCache) VerifiedClaims(token []byte) (*Claims, error) {
+	hash := sha256.Sum256(token)
+
+	if c, alg := cache.lookup(hash); c != nil {
+		if cache.Revocation != nil && c.ID != "" && cache.Revocation.Revoked(c.ID) {
+			return observe(nil, alg, ErrRevoked)
+		}
+		return observe(c, alg, nil)
+	}
+
+	c, err := cache.Check(token)
+	if err != nil {
+		return nil, err
+	}
+	if cache.Revocation != nil && c.ID != "" && cache.Revocation.Revoked(c.ID) {
+		var alg string
+		if header, err := c.Header(); err == nil {
+			alg = header.Alg
+		}
+		return observe(nil, alg, ErrRevoked)
+	}
+	if c.Expires != nil {
+		cache.add(hash, c)
+	}
+	return c, nil
+}
+
+// Lookup returns a copy of the cached claims, if any, with their algorithm.
+func (cache *CheckCache) lookup(hash [sha256.Size]byte) (*Claims, string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	e, ok := cache.entries[hash]
+	if !ok {
+		return nil, ""
+	}
+	entry := e.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expires) {
+		cache.lru.Remove(e)
+		delete(cache.entries, hash)
+		return nil, ""
+	}
+	cache.lru.MoveToFront(e)
+	return entry.claims.Clone(), entry.alg
+}
+
+func (cache *CheckCache) add(hash [sha256.Size]byte, c *Claims) {
+	expires := c.Expires.Time()
+	if !time.Now().Before(expires) {
+		return // expired
+	}
+	entry := &cacheEntry{hash: hash, claims: c.Clone(), expires: expires}
+	if header, err := c.Header(); err == nil {
+		entry.alg = header.Alg
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.entries == nil {
+		cache.entries = make(map[[sha256.Size]byte]*list.Element)
+	}
+	if e, ok := cache.entries[hash]; ok {
+		e.Value = entry
+		cache.lru.MoveToFront(e)
+		return
+	}
+	cache.entries[hash] = cache.lru.PushFront(entry)
+
+	size := cache.Size
+	if size == 0 {
+		size = 1024
+	}
+	for cache.lru.Len() > size {
+		last := cache.lru.Back()
+		cache.lru.Remove(last)
+		delete(cache.entries, last.Value.(*cacheEntry).hash)
+	}
+}
+
+// Revoke honors the Revocation interface. Cache entries with the JWT ID are
+// dropped, and the invocation is passed on to the Revocation field, when set.
+func (cache *CheckCache) Revoke(id string, expires time.Time) error {
+	cache.mutex.Lock()
+	for e := cache.lru.Front(); e != nil; {
+		next := e.Next()
+		if entry := e.Value.(*cacheEntry); entry.claims.ID == id {
+			cache.lru.Remove(e)
+			delete(cache.entries, entry.hash)
+		}
+		e = next
+	}
+	cache.mutex.Unlock()
+
+	if cache.Revocation == nil {
+		return nil
+	}
+	return cache.Revocation.Revoke(id, expires)
+}
+
+// Revoked honors the Revocation interface. The return is false without a
+// Revocation field set.
+func (cache *CheckCache) Revoked(id string) bool {
+	return cache.Revocation != nil && cache.Revocation.Revoked(id)
+}
+
+// Invalidate drops all entries, e.g., after a key rotation.
+func (cache *CheckCache) Invalidate() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.entries = nil
+	cache.lru.Init()
+}
+
+// CachePolicy gives the time to live for verified tokens in caches beyond this
+// package, e.g., the internal cache of a reverse proxy.
+type CachePolicy struct {
+	// Leeway is the margin before the expiration time, e.g., for clock
+	// skew among the caching parties.
+	Leeway time.Duration
+
+	// MaxAge limits the time to live. Zero disables the limit.
+	MaxAge time.Duration
+
+	// RevocationInterval is the time between the revocation checks on
+	// the same token, as a cache hit skips any Revocation. Zero disables
+	// the limit, which is only safe without Revocation in place.
+	RevocationInterval time.Duration
+}
+
+// TTL returns how long the claims may be cached, as the minimum of the time to
+// the expiry minus the Leeway, the MaxAge, and the RevocationInterval. Claims
+// without expiry, and claims outside their time constraints, are not cacheable,
+// i.e., the return is zero.
+func (p *CachePolicy) TTL(c *Claims, now time.Time) time.Duration {
+	if c.Expires == nil || !c.Valid(now) {
+		return 0
+	}
+	ttl := c.Expires.Time().Sub(now) - p.Leeway
+	if p.MaxAge > 0 && p.MaxAge < ttl {
+		ttl = p.MaxAge
+	}
+	if p.RevocationInterval > 0 && p.RevocationInterval < ttl {
+		ttl = p.RevocationInterval
+	}
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
@@ -0,0 +1,193 @@
+package jwt
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckCache(t *testing.T) {
+	keys := &KeyRegister{Secrets: [][]byte{[]byte("guest")}}
+	var checks int
+	cache := &CheckCache{
+		Size: 2,
+		Check: func(token []byte) (*Claims, error) {
+			checks++
+			return keys.Check(token)
+		},
+	}
+
+	tokens := make([][]byte, 3)
+	for i := range tokens {
+		var c Claims
+		c.ID = fmt.Sprint("id", i)
+		c.Expires = NewNumericTime(time.Now().Add(time.Hour))
+		token, err := c.HMACSign(HS256, keys.Secrets[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[i] = token
+	}
+
+	for _, token := range [][]byte{tokens[0], tokens[0], tokens[1], tokens[0]} {
+		if _, err := cache.VerifiedClaims(token); err != nil {
+			t.Fatal("verified claims error:", err)
+		}
+	}
+	if checks != 2 {
+		t.Errorf("got %d checks, want 2", checks)
+	}
+
+	// evicts least recently used, which is tokens[1]
+	if _, err := cache.VerifiedClaims(tokens[2]); err != nil {
+		t.Fatal("verified claims error:", err)
+	}
+	cache.VerifiedClaims(tokens[0])
+	if checks != 3 {
+		t.Errorf("got %d checks, want 3", checks)
+	}
+	cache.VerifiedClaims(tokens[1])
+	if checks != 4 {
+		t.Errorf("got %d checks after eviction, want 4", checks)
+	}
+
+	// hits are copies
+	c, _ := cache.VerifiedClaims(tokens[1])
+	c.ID = "modified"
+	if c, _ := cache.VerifiedClaims(tokens[1]); c.ID != "id1" {
+		t.Errorf("got ID %q after modification, want id1", c.ID)
+	}
+
+	cache.Invalidate()
+	cache.VerifiedClaims(tokens[1])
+	if checks != 5 {
+		t.Errorf("got %d checks after invalidation, want 5", checks)
+	}
+}
+
+func TestCheckCacheExpiry(t *testing.T) {
+	var checks int
+	cache := &CheckCache{Check: func(token []byte) (*Claims, error) {
+		checks++
+		return HMACCheck(token, []byte("guest"))
+	}}
+
+	var c Claims
+	c.Expires = NewNumericTime(time.Now().Add(-time.Second))
+	expired, err := c.HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Expires = nil
+	eternal, err := c.HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range [][]byte{expired, expired, eternal, eternal} {
+		if _, err := cache.VerifiedClaims(token); err != nil {
+			t.Fatal("verified claims error:", err)
+		}
+	}
+	if checks != 4 {
+		t.Errorf("got %d checks, want 4 as nothing is cached", checks)
+	}
+}
+
+func TestCheckCacheRevoke(t *testing.T) {
+	var checks int
+	cache := &CheckCache{
+		Check: func(token []byte) (*Claims, error) {
+			checks++
+			return HMACCheck(token, []byte("guest"))
+		},
+		Revocation: new(RevocationList),
+	}
+
+	var c Claims
+	c.ID = "a"
+	c.Expires = NewNumericTime(time.Now().Add(time.Hour))
+	token, err := c.HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cache.VerifiedClaims(token); err != nil {
+		t.Fatal("verified claims error:", err)
+	}
+	if err := cache.Revoke("a", c.Expires.Time()); err != nil {
+		t.Fatal("revoke error:", err)
+	}
+	if !cache.Revoked("a") {
+		t.Error("revocation not passed on")
+	}
+	if _, err := cache.VerifiedClaims(token); err != ErrRevoked {
+		t.Errorf("got error %v, want %v", err, ErrRevoked)
+	}
+	if checks != 2 {
+		t.Errorf("got %d checks, want 2 as revoke drops the entry", checks)
+	}
+}
+
+func TestCheckCacheRevokeHook(t *testing.T) {
+	var got []string
+	defer func(hook func(alg, issuer string, err error)) {
+		CheckHook = hook // restore
+	}(CheckHook)
+	CheckHook = func(alg, issuer string, err error) {
+		got = append(got, alg+" "+ErrorClass(err))
+	}
+
+	revoked := new(RevocationList)
+	revoked.Revoke("a", time.Now().Add(time.Hour))
+	cache := &CheckCache{
+		Check:      func(token []byte) (*Claims, error) { return HMACCheck(token, []byte("guest")) },
+		Revocation: revoked,
+	}
+	var c Claims
+	c.ID = "a"
+	c.Expires = NewNumericTime(time.Now().Add(time.Hour))
+	token, err := c.HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.VerifiedClaims(token); err != ErrRevoked {
+		t.Errorf("got error %v, want %v", err, ErrRevoked)
+	}
+	if want := []string{"HS256 ", "HS256 revoked"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got hook outcomes %q, want %q", got, want)
+	}
+}
+
+func TestCachePolicyTTL(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	golden := []struct {
+		policy CachePolicy
+		exp    time.Duration // relative to now; zero for none
+		nbf    time.Duration // relative to now; zero for none
+		want   time.Duration
+	}{
+		{CachePolicy{}, 0, 0, 0},
+		{CachePolicy{}, time.Hour, 0, time.Hour},
+		{CachePolicy{}, -time.Second, 0, 0},
+		{CachePolicy{}, time.Hour, time.Minute, 0},
+		{CachePolicy{Leeway: time.Minute}, time.Hour, 0, 59 * time.Minute},
+		{CachePolicy{Leeway: time.Minute}, 30 * time.Second, 0, 0},
+		{CachePolicy{MaxAge: 5 * time.Minute}, time.Hour, 0, 5 * time.Minute},
+		{CachePolicy{MaxAge: 5 * time.Minute, RevocationInterval: 30 * time.Second}, time.Hour, 0, 30 * time.Second},
+		{CachePolicy{Leeway: time.Minute, MaxAge: time.Hour}, 2 * time.Minute, 0, time.Minute},
+	}
+	for _, gold := range golden {
+		var c Claims
+		if gold.exp != 0 {
+			c.Expires = NewNumericTime(now.Add(gold.exp))
+		}
+		if gold.nbf != 0 {
+			c.NotBefore = NewNumericTime(now.Add(gold.nbf))
+		}
+		if got := gold.policy.TTL(&c, now); got != gold.want {
+			t.Errorf("%+v with exp %s and nbf %s: got TTL %s, want %s", gold.policy, gold.exp, gold.nbf, got, gold.want)
+		}
+	}
+}
@@ -9,14 +9,82 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
 // ErrSigMiss means the signature check failed.
 var ErrSigMiss = errors.New("jwt: signature mismatch")
 
+// ErrOversized means the token exceeds MaxTokenSize or MaxSegmentSize.
+var ErrOversized = errors.New("jwt: token size exceeds limit")
+
 var errPart = errors.New("jwt: missing base64 part")
 
+// Size limits protect against hostile input. The Check functions return
+// ErrOversized, before any decoding takes place, when a token exceeds either
+// one of the limits. Zero disables the respective limit. Any modifications
+// should be made before first use, just like with the algorithm registration.
+var (
+	// MaxTokenSize is the maximum length of a token in bytes.
+	MaxTokenSize int
+	// MaxSegmentSize is the maximum length of each base64 part in bytes,
+	// i.e., the header, the payload and the signature.
+	MaxSegmentSize int
+)
+
+// StrictJSON makes the Check functions reject any JSON object with duplicate
+// names, either in the JOSE header or in the payload. The default behaviour is
+// conform encoding/json, i.e., the last value of a duplicate name applies, and
+// the name of struct fields matches case-insensitive. Hence, names in the JOSE
+// header count as duplicates when they differ in case only. Implementations that
+// treat duplicates differently may see other claims than this package does.
+// Any modifications should be made before first use.
+var StrictJSON bool
+
+// UseNumber makes the Check functions decode JSON numbers in Claims.Set as a
+// json.Number instead of a float64, which preserves the precision of integers
+// beyond 53 bits, e.g., snowflake IDs. The Registered fields (exp, nbf & iat)
+// remain unaffected. Any modifications should be made before first use.
+var UseNumber bool
+
+// LenientBase64 makes the Check functions accept padding, whitespace and the
+// standard alphabet of base64 in any of the three parts. By default, each part
+// must be in the canonical encoding: “Base64 encoding using the URL- and
+// filename-safe character set defined in Section 5 of RFC 4648, with all
+// trailing '=' characters omitted […] and without the inclusion of any line
+// breaks, whitespace, or other additional characters.”
+// — “JSON Web Signature (JWS)” RFC 7515, section 2
+//
+// Distinct decoding rules among implementations may cause the signed content
+// to differ from the content processed. Any modifications should be made
+// before first use.
+var LenientBase64 bool
+
+// Decode applies the base64 constraints, as configured with LenientBase64.
+func decode(dst, src []byte) (n int, err error) {
+	if LenientBase64 {
+		normal := make([]byte, 0, len(src))
+		for _, c := range src {
+			switch c {
+			case ' ', '\t', '\r', '\n', '=':
+				continue
+			case '+':
+				c = '-'
+			case '/':
+				c = '_'
+			}
+			normal = append(normal, c)
+		}
+		return encoding.Decode(dst, normal)
+	}
+
+	return decodeBase64URL(dst, src)
+}
+
 // “Producers MUST NOT use the empty list "[]" as the "crit" value.”
 // — “JSON Web Signature (JWS)” RFC 7515, subsection 4.1.11
 var errCritEmpty = errors.New("jwt: empty array in crit header")
@@ -31,6 +99,52 @@ var EvalCrit = func(token []byte, crit []string, header json.RawMessage) error {
 	return fmt.Errorf("jwt: unsupported critical extension in JOSE header: %q", crit)
 }
 
+// CheckHook is invoked, when not nil, on the outcome of each Check function,
+// including the ones from KeyRegister, RegisterSet and RemoteJWKS, once per
+// call. Alg is the algorithm from the header,
+// if any. Issuer is the "iss" claim on success only, as the payload is not
+// interpreted without a valid signature. The error is nil on success. See
+// ErrorClass for metrics with a limited number of labels. Any modifications
+// should be made before first use.
+var CheckHook func(alg, issuer string, err error)
+
+func observe(c *Claims, alg string, err error) (*Claims, error) {
+	if CheckHook != nil {
+		var issuer string
+		if err == nil {
+			issuer = c.Issuer
+		}
+		CheckHook(alg, issuer, err)
+	}
+	return c, err
+}
+
+// ErrorClass returns a classification of errors from the Check functions:
+// "signature" for ErrSigMiss, "algorithm" for AlgError (and hash functions not
+// linked), "size" for ErrOversized, "issuer" for IssuerError, "revoked" for
+// ErrRevoked, and "format" for all other errors, which includes any from
+// EvalCrit. The return is empty for nil.
+func ErrorClass(err error) string {
+	var algErr AlgError
+	var issuerErr IssuerError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrSigMiss):
+		return "signature"
+	case errors.As(err, &algErr), errors.Is(err, errHashLink):
+		return "algorithm"
+	case errors.Is(err, ErrOversized):
+		return "size"
+	case errors.As(err, &issuerErr):
+		return "issuer"
+	case errors.Is(err, ErrRevoked):
+		return "revoked"
+	default:
+		return "format"
+	}
+}
+
 // ParseWithoutCheck skips the signature validation.
 func ParseWithoutCheck(token []byte) (*Claims, error) {
 	var c Claims
@@ -46,89 +160,116 @@ func ParseWithoutCheck(token []byte) (*Claims, error) {
 // The return is an AlgError when the algorithm is not in ECDSAAlgs.
 // Use Valid to complete the verification.
 func ECDSACheck(token []byte, key *ecdsa.PublicKey) (*Claims, error) {
-	var c Claims
+	return observe(ecdsaCheck(token, key))
+}
+
+func ecdsaCheck(token []byte, key *ecdsa.PublicKey) (c *Claims, alg string, err error) {
+	c = new(Claims)
 	firstDot, lastDot, sig, alg, err := c.scan(token)
 	if err != nil {
-		return nil, err
+		return nil, alg, err
 	}
 
 	hash, err := hashLookup(alg, ECDSAAlgs)
 	if err != nil {
-		return nil, err
+		return nil, alg, err
 	}
 	digest := hash.New()
 	digest.Write(token[:lastDot])
 
-	r := new(big.Int).SetBytes(sig[:len(sig)/2])
-	s := new(big.Int).SetBytes(sig[len(sig)/2:])
-	if !ecdsa.Verify(key, digest.Sum(sig[:0]), r, s) {
-		return nil, ErrSigMiss
+	if !ecdsaVerify(key, digest.Sum(sig[len(sig):]), sig) {
+		return nil, alg, ErrSigMiss
 	}
 
-	return &c, c.applyPayload(token[firstDot+1:lastDot], sig)
+	return c, alg, c.applyPayload(token[firstDot+1:lastDot], sig)
+}
+
+// Sig holds the pair (r, s) in fixed width, i.e., each integer zero-padded to
+// the byte size of the curve, as per RFC 7518, subsection 3.4. Signatures of
+// any other size never match.
+func ecdsaVerify(key *ecdsa.PublicKey, digestSum, sig []byte) bool {
+	paramLen := (key.Curve.Params().BitSize + 7) / 8
+	if len(sig) != 2*paramLen {
+		return false
+	}
+	r := new(big.Int).SetBytes(sig[:paramLen])
+	s := new(big.Int).SetBytes(sig[paramLen:])
+	return ecdsa.Verify(key, digestSum, r, s)
 }
 
 // EdDSACheck parses a JWT if, and only if, the signature checks out.
 // Use Valid to complete the verification.
 func EdDSACheck(token []byte, key ed25519.PublicKey) (*Claims, error) {
-	var c Claims
+	return observe(eddsaCheck(token, key))
+}
+
+func eddsaCheck(token []byte, key ed25519.PublicKey) (c *Claims, alg string, err error) {
+	c = new(Claims)
 	firstDot, lastDot, sig, alg, err := c.scan(token)
 	if err != nil {
-		return nil, err
+		return nil, alg, err
 	}
 
 	if alg != EdDSA {
-		return nil, AlgError(alg)
+		return nil, alg, AlgError(alg)
 	}
 
 	if !ed25519.Verify(key, token[:lastDot], sig) {
-		return nil, ErrSigMiss
+		return nil, alg, ErrSigMiss
 	}
 
-	return &c, c.applyPayload(token[firstDot+1:lastDot], sig)
+	return c, alg, c.applyPayload(token[firstDot+1:lastDot], sig)
 }
 
 // HMACCheck parses a JWT if, and only if, the signature checks out.
 // The return is an AlgError when the algorithm is not in HMACAlgs.
 // Use Valid to complete the verification.
 func HMACCheck(token, secret []byte) (*Claims, error) {
+	return observe(hmacCheck(token, secret))
+}
+
+func hmacCheck(token, secret []byte) (c *Claims, alg string, err error) {
 	if len(secret) == 0 {
-		return nil, errNoSecret
+		return nil, alg, errNoSecret
 	}
 
-	var c Claims
+	c = new(Claims)
 	firstDot, lastDot, sig, alg, err := c.scan(token)
 	if err != nil {
-		return nil, err
+		return nil, alg, err
 	}
 
 	hash, err := hashLookup(alg, HMACAlgs)
 	if err != nil {
-		return nil, err
+		return nil, alg, err
 	}
 	digest := hmac.New(hash.New, secret)
 	digest.Write(token[:lastDot])
 
 	if !hmac.Equal(sig, digest.Sum(sig[len(sig):])) {
-		return nil, ErrSigMiss
+		return nil, alg, ErrSigMiss
 	}
 
-	return &c, c.applyPayload(token[firstDot+1:lastDot], sig)
+	return c, alg, c.applyPayload(token[firstDot+1:lastDot], sig)
 }
 
 // RSACheck parses a JWT if, and only if, the signature checks out.
 // The return is an AlgError when the algorithm is not in RSAAlgs.
 // Use Valid to complete the verification.
 func RSACheck(token []byte, key *rsa.PublicKey) (*Claims, error) {
-	var c Claims
+	return observe(rsaCheck(token, key))
+}
+
+func rsaCheck(token []byte, key *rsa.PublicKey) (c *Claims, alg string, err error) {
+	c = new(Claims)
 	firstDot, lastDot, sig, alg, err := c.scan(token)
 	if err != nil {
-		return nil, err
+		return nil, alg, err
 	}
 
 	hash, err := hashLookup(alg, RSAAlgs)
 	if err != nil {
-		return nil, err
+		return nil, alg, err
 	}
 	digest := hash.New()
 	digest.Write(token[:lastDot])
@@ -139,13 +280,17 @@ func RSACheck(token []byte, key *rsa.PublicKey) (*Claims, error) {
 		err = rsa.VerifyPKCS1v15(key, hash, digest.Sum(sig[len(sig):]), sig)
 	}
 	if err != nil {
-		return nil, ErrSigMiss
+		return nil, alg, ErrSigMiss
 	}
 
-	return &c, c.applyPayload(token[firstDot+1:lastDot], sig)
+	return c, alg, c.applyPayload(token[firstDot+1:lastDot], sig)
 }
 
 func (c *Claims) scan(token []byte) (firstDot, lastDot int, sig []byte, alg string, err error) {
+	if MaxTokenSize != 0 && len(token) > MaxTokenSize {
+		return 0, 0, nil, "", ErrOversized
+	}
+
 	firstDot = bytes.IndexByte(token, '.')
 	lastDot = bytes.LastIndexByte(token, '.')
 	if lastDot <= firstDot {
@@ -153,15 +298,27 @@ func (c *Claims) scan(token []byte) (firstDot, lastDot int, sig []byte, alg stri
 		return 0, 0, nil, "", errPart
 	}
 
+	if MaxSegmentSize != 0 && (firstDot > MaxSegmentSize ||
+		lastDot-firstDot-1 > MaxSegmentSize ||
+		len(token)-lastDot-1 > MaxSegmentSize) {
+		return 0, 0, nil, "", ErrOversized
+	}
+
 	buf := make([]byte, encoding.DecodedLen(len(token)))
-	n, err := encoding.Decode(buf, token[:firstDot])
+	n, err := decode(buf, token[:firstDot])
 	if err != nil {
 		return 0, 0, nil, "", fmt.Errorf("jwt: malformed JOSE header: %w", err)
 	}
 
+	if StrictJSON {
+		if err := checkDupes(buf[:n], true); err != nil {
+			return 0, 0, nil, "", fmt.Errorf("jwt: malformed JOSE header: %w", err)
+		}
+	}
 	var header struct {
 		Kid  string   `json:"kid"`
 		Alg  string   `json:"alg"`
+		Cty  string   `json:"cty"`
 		Crit []string `json:"crit"`
 	}
 	if err := json.Unmarshal(buf[:n], &header); err != nil {
@@ -172,6 +329,7 @@ func (c *Claims) scan(token []byte) (firstDot, lastDot int, sig []byte, alg stri
 
 	alg = header.Alg
 	c.KeyID = header.Kid
+	c.ContentType = header.Cty
 	if header.Crit != nil {
 		if len(header.Crit) == 0 {
 			return 0, 0, nil, "", errCritEmpty
@@ -182,7 +340,7 @@ func (c *Claims) scan(token []byte) (firstDot, lastDot int, sig []byte, alg stri
 	}
 
 	// signature
-	n, err = encoding.Decode(buf, token[lastDot+1:])
+	n, err = decode(buf, token[lastDot+1:])
 	if err != nil {
 		return 0, 0, nil, "", fmt.Errorf("jwt: malformed signature: %w", err)
 	}
@@ -191,16 +349,49 @@ func (c *Claims) scan(token []byte) (firstDot, lastDot int, sig []byte, alg stri
 	return
 }
 
+// PeekHeader returns the JOSE header (content) without any verification, and
+// without parsing of the payload. Use it to select keys, e.g., a register per
+// algorithm, or to log unverified tokens. Never trust the values for anything
+// else than hints.
+func PeekHeader(token []byte) (*Header, error) {
+	if MaxTokenSize != 0 && len(token) > MaxTokenSize {
+		return nil, ErrOversized
+	}
+	firstDot := bytes.IndexByte(token, '.')
+	if firstDot < 0 || bytes.IndexByte(token[firstDot+1:], '.') < 0 {
+		return nil, errPart
+	}
+	if MaxSegmentSize != 0 && firstDot > MaxSegmentSize {
+		return nil, ErrOversized
+	}
+
+	buf := make([]byte, encoding.DecodedLen(firstDot))
+	n, err := decode(buf, token[:firstDot])
+	if err != nil {
+		return nil, fmt.Errorf("jwt: malformed JOSE header: %w", err)
+	}
+	h := new(Header)
+	if err := json.Unmarshal(buf[:n], h); err != nil {
+		return nil, fmt.Errorf("jwt: malformed JOSE header: %w", err)
+	}
+	return h, nil
+}
+
 // Buf remains in use as the Raw field.
 func (c *Claims) applyPayload(encoded, buf []byte) error {
 	buf = buf[:cap(buf)]
-	n, err := encoding.Decode(buf, encoded)
+	n, err := decode(buf, encoded)
 	if err != nil {
 		return fmt.Errorf("jwt: malformed payload: %w", err)
 	}
 	buf = buf[:n]
 	c.Raw = json.RawMessage(buf)
-	if err = json.Unmarshal(buf, &c.Set); err != nil {
+	if StrictJSON {
+		if err := checkDupes(buf, false); err != nil {
+			return fmt.Errorf("jwt: malformed payload: %w", err)
+		}
+	}
+	if err = unmarshalSet(buf, &c.Set); err != nil {
 		return fmt.Errorf("jwt: malformed payload: %w", err)
 	}
 
@@ -238,15 +429,15 @@ func (c *Claims) applyPayload(encoded, buf []byte) error {
 		c.Audiences = []string{a}
 	}
 
-	if f, ok := m[expires].(float64); ok {
+	if f, ok := jsonNumber(m[expires]); ok {
 		delete(m, expires)
 		c.Expires = (*NumericTime)(&f)
 	}
-	if f, ok := m[notBefore].(float64); ok {
+	if f, ok := jsonNumber(m[notBefore]); ok {
 		delete(m, notBefore)
 		c.NotBefore = (*NumericTime)(&f)
 	}
-	if f, ok := m[issued].(float64); ok {
+	if f, ok := jsonNumber(m[issued]); ok {
 		delete(m, issued)
 		c.Issued = (*NumericTime)(&f)
 	}
@@ -257,3 +448,279 @@ func (c *Claims) applyPayload(encoded, buf []byte) error {
 
 	return nil
 }
+
+// ApplyRegistered is like applyPayload, yet it reads the Registered fields
+// only, without any allocation for the other claims. Set remains nil.
+func (c *Claims) applyRegistered(encoded, buf []byte) error {
+	buf = buf[:cap(buf)]
+	n, err := decode(buf, encoded)
+	if err != nil {
+		return fmt.Errorf("jwt: malformed payload: %w", err)
+	}
+	buf = buf[:n]
+	c.Raw = json.RawMessage(buf)
+	if StrictJSON {
+		if err := checkDupes(buf, false); err != nil {
+			return fmt.Errorf("jwt: malformed payload: %w", err)
+		}
+	}
+	if !json.Valid(buf) {
+		return errors.New("jwt: malformed payload: invalid JSON")
+	}
+	if err := scanRegistered(buf, &c.Registered); err != nil {
+		return fmt.Errorf("jwt: malformed payload: %w", err)
+	}
+	return nil
+}
+
+// ScanRegistered reads the Registered fields from a valid JSON object, with
+// the same outcome as the Set mapping in applyPayload.
+func scanRegistered(data []byte, r *Registered) error {
+	i := skipSpace(data, 0)
+	if data[i] == 'n' {
+		return nil // null
+	}
+	if data[i] != '{' {
+		return errors.New("JSON value not an object")
+	}
+
+	for {
+		i = skipSpace(data, i+1) // skips '{' or ','
+		if data[i] == '}' {
+			return nil
+		}
+		end := skipValue(data, i)
+		name := data[i+1 : end-1]
+		var unescaped string
+		if bytes.IndexByte(name, '\\') >= 0 {
+			if err := json.Unmarshal(data[i:end], &unescaped); err != nil {
+				return err
+			}
+			name = []byte(unescaped)
+		}
+
+		i = skipSpace(data, end)
+		i = skipSpace(data, i+1) // skips ':'
+		end = skipValue(data, i)
+		value := data[i:end]
+
+		var err error
+		switch string(name) {
+		case issuer:
+			r.Issuer, err = scanString(value)
+		case subject:
+			r.Subject, err = scanString(value)
+		case id:
+			r.ID, err = scanString(value)
+		case audience:
+			r.Audiences, err = scanAudiences(value)
+		case expires:
+			r.Expires, err = scanNumericTime(value)
+		case notBefore:
+			r.NotBefore, err = scanNumericTime(value)
+		case issued:
+			r.Issued, err = scanNumericTime(value)
+		}
+		if err != nil {
+			return err
+		}
+
+		i = skipSpace(data, end)
+		if data[i] == '}' {
+			return nil
+		}
+	}
+}
+
+// ScanString returns the empty string for non-string values.
+func scanString(value []byte) (string, error) {
+	if value[0] != '"' {
+		return "", nil
+	}
+	if bytes.IndexByte(value, '\\') < 0 {
+		return string(value[1 : len(value)-1]), nil
+	}
+	var s string
+	err := json.Unmarshal(value, &s)
+	return s, err
+}
+
+func scanAudiences(value []byte) ([]string, error) {
+	switch value[0] {
+	case '"':
+		s, err := scanString(value)
+		return []string{s}, err
+	case '[':
+		var a []interface{}
+		if err := json.Unmarshal(value, &a); err != nil {
+			return nil, err
+		}
+		var audiences []string
+		for _, o := range a {
+			if s, ok := o.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+		return audiences, nil
+	}
+	return nil, nil
+}
+
+// ScanNumericTime returns nil for non-number values.
+func scanNumericTime(value []byte) (*NumericTime, error) {
+	if value[0] != '-' && (value[0] < '0' || value[0] > '9') {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(string(value), 64)
+	if err != nil {
+		return nil, fmt.Errorf("number %s out of range", value)
+	}
+	return (*NumericTime)(&f), nil
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// SkipValue returns the end of the value at offset i in valid JSON.
+func skipValue(data []byte, i int) int {
+	switch data[i] {
+	case '"':
+		for i++; ; i++ {
+			switch data[i] {
+			case '\\':
+				i++ // escaped character
+			case '"':
+				return i + 1
+			}
+		}
+	case '{', '[':
+		var depth int
+		for ; ; i++ {
+			switch data[i] {
+			case '"':
+				i = skipValue(data, i) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+	default:
+		for i++; i < len(data); i++ {
+			switch data[i] {
+			case ',', '}', ']', ' ', '\t', '\r', '\n':
+				return i
+			}
+		}
+		return i
+	}
+}
+
+// UnmarshalSet decodes a JSON object conform UseNumber.
+func unmarshalSet(data []byte, set *map[string]interface{}) error {
+	if !UseNumber {
+		return json.Unmarshal(data, set)
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(set); err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return errors.New("invalid data after top-level value")
+	}
+	return nil
+}
+
+// JSONNumber returns the value of either a float64 or a json.Number.
+func jsonNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// CheckDupes returns an error on the first JSON object in data with a duplicate
+// name, including nested objects. Names compare after unescaping. With fold,
+// names of the top-level object compare case-insensitive, conform struct fields
+// in encoding/json.
+func checkDupes(data []byte, fold bool) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	return checkDupesValue(dec, fold)
+}
+
+func checkDupesValue(dec *json.Decoder, fold bool) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		names := make(map[string]struct{})
+		for dec.More() {
+			token, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			name := token.(string)
+			key := name
+			if fold {
+				key = foldName(name)
+			}
+			if _, ok := names[key]; ok {
+				return fmt.Errorf("jwt: duplicate name %q in JSON object", name)
+			}
+			names[key] = struct{}{}
+
+			if err := checkDupesValue(dec, false); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token() // closing brace
+		return err
+
+	case json.Delim('['):
+		for dec.More() {
+			if err := checkDupesValue(dec, false); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token() // closing bracket
+		return err
+	}
+
+	return nil
+}
+
+// FoldName returns the name with each rune replaced by the lowest one of its
+// case-folding orbit, such that names are equal when strings.EqualFold is.
+func foldName(name string) string {
+	var buf strings.Builder
+	for _, r := range name {
+		low := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < low {
+				low = f
+			}
+		}
+		buf.WriteRune(low)
+	}
+	return buf.String()
+}
@@ -1,15 +1,22 @@
 package jwt
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 var goldenECDSAs = []struct {
@@ -276,6 +283,359 @@ func TestErrPart(t *testing.T) {
 	}
 }
 
+func TestCheckOversized(t *testing.T) {
+	defer func(token, segment int) {
+		MaxTokenSize, MaxSegmentSize = token, segment // restore
+	}(MaxTokenSize, MaxSegmentSize)
+
+	token := []byte(goldenHMACs[1].token)
+	MaxTokenSize = len(token) - 1
+	if _, err := HMACCheck(token, goldenHMACs[1].secret); err != ErrOversized {
+		t.Errorf("token limit got error %v, want %v", err, ErrOversized)
+	}
+	MaxTokenSize = len(token)
+	if _, err := HMACCheck(token, goldenHMACs[1].secret); err != nil {
+		t.Errorf("token on limit got error %v", err)
+	}
+
+	// payload is the largest segment
+	payloadLen := bytes.LastIndexByte(token, '.') - bytes.IndexByte(token, '.') - 1
+	MaxSegmentSize = payloadLen - 1
+	if _, err := HMACCheck(token, goldenHMACs[1].secret); err != ErrOversized {
+		t.Errorf("segment limit got error %v, want %v", err, ErrOversized)
+	}
+	if _, err := ParseWithoutCheck(token); err != ErrOversized {
+		t.Errorf("segment limit without check got error %v, want %v", err, ErrOversized)
+	}
+	MaxSegmentSize = payloadLen
+	if _, err := HMACCheck(token, goldenHMACs[1].secret); err != nil {
+		t.Errorf("segment on limit got error %v", err)
+	}
+}
+
+func TestCheckStrictJSON(t *testing.T) {
+	defer func(strict bool) {
+		StrictJSON = strict // restore
+	}(StrictJSON)
+
+	golden := []struct {
+		header, payload string
+		dupe            string
+	}{
+		{`{"alg":"HS256"}`, `{"sub":"a","aud":["b","b"]}`, ""},
+		{`{"alg":"HS256"}`, `{"sub":"a","sub":"b"}`, "sub"},
+		{`{"alg":"HS256"}`, `{"sub":"a","\u0073ub":"b"}`, "sub"},
+		{`{"alg":"HS256"}`, `{"cnf":{"jkt":"a","jkt":"b"}}`, "jkt"},
+		{`{"alg":"HS256"}`, `{"x":[{"a":1},{"b":2,"b":3}]}`, "b"},
+		{`{"alg":"HS256","kid":"a","kid":"b"}`, `{}`, "kid"},
+		{`{"alg":"HS512","ALG":"HS256"}`, `{}`, "ALG"},
+		{`{"alg":"HS256","Kid":"a","kid":"b"}`, `{}`, "kid"},
+		{`{"alg":"HS256"}`, `{"sub":"a","SUB":"b"}`, ""},
+	}
+	for _, gold := range golden {
+		token := signHS256Guest(encoding.EncodeToString([]byte(gold.header)) + "." + encoding.EncodeToString([]byte(gold.payload)))
+
+		StrictJSON = false
+		if _, err := HMACCheck(token, []byte("guest")); err != nil {
+			t.Errorf("%s.%s: got error %q without strict mode", gold.header, gold.payload, err)
+		}
+
+		StrictJSON = true
+		_, err := HMACCheck(token, []byte("guest"))
+		if gold.dupe == "" {
+			if err != nil {
+				t.Errorf("%s.%s: got error %q", gold.header, gold.payload, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("duplicate name %q", gold.dupe)) {
+			t.Errorf("%s.%s: got error %v, want duplicate %q", gold.header, gold.payload, err, gold.dupe)
+		}
+	}
+}
+
+func TestCheckHook(t *testing.T) {
+	type outcome struct {
+		alg, issuer, class string
+	}
+	var got []outcome
+	defer func(hook func(alg, issuer string, err error)) {
+		CheckHook = hook // restore
+	}(CheckHook)
+	CheckHook = func(alg, issuer string, err error) {
+		got = append(got, outcome{alg, issuer, ErrorClass(err)})
+	}
+
+	gold := goldenHMACs[1]
+	HMACCheck([]byte(gold.token), gold.secret)
+	HMACCheck([]byte(gold.token), []byte("wrong"))
+	HMACCheck([]byte("broken"), gold.secret)
+	keys := &KeyRegister{Secrets: [][]byte{gold.secret}}
+	keys.Check([]byte(gold.token))
+	keys.Check([]byte(goldenECDSAs[0].token))
+	keys.VerifyBytes([]byte(gold.token))
+
+	want := []outcome{
+		{HS512, "ppoovey", ""},
+		{HS512, "", "signature"},
+		{"", "", "format"},
+		{HS512, "ppoovey", ""},
+		{ES256, "", "signature"},
+		{HS512, "", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got outcomes %q, want %q", got, want)
+	}
+}
+
+// Each entry point must pass CheckHook exactly once.
+func TestCheckHookOnce(t *testing.T) {
+	type outcome struct {
+		alg, issuer, class string
+	}
+	var got []outcome
+	defer func(hook func(alg, issuer string, err error)) {
+		CheckHook = hook // restore
+	}(CheckHook)
+	CheckHook = func(alg, issuer string, err error) {
+		got = append(got, outcome{alg, issuer, ErrorClass(err)})
+	}
+
+	s := &jwksServer{kids: []string{"a"}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	j := &RemoteJWKS{URL: srv.URL}
+	j.Check(jwksToken(t, "a"))
+	j.Check(jwksToken(t, "b")) // unknown key identifier
+
+	gold := goldenHMACs[1]
+	set := RegisterSet{"ppoovey": {Secrets: [][]byte{gold.secret}}}
+	set.Check([]byte(gold.token))
+	delete(set, "ppoovey")
+	set.Check([]byte(gold.token))
+
+	var c Claims
+	c.Issuer = "cache"
+	c.Expires = NewNumericTime(time.Now().Add(time.Hour))
+	token, err := c.HMACSign(HS384, gold.secret)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	keys := &KeyRegister{Secrets: [][]byte{gold.secret}}
+	cache := &CheckCache{Check: keys.Check}
+	cache.VerifiedClaims(token)
+	cache.VerifiedClaims(token) // hit
+
+	want := []outcome{
+		{HS256, "", ""},
+		{HS256, "", "signature"},
+		{HS512, "ppoovey", ""},
+		{HS512, "", "issuer"},
+		{HS384, "cache", ""},
+		{HS384, "cache", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got outcomes %q, want %q", got, want)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	golden := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{ErrSigMiss, "signature"},
+		{AlgError("none"), "algorithm"},
+		{errHashLink, "algorithm"},
+		{ErrOversized, "size"},
+		{IssuerError("x"), "issuer"},
+		{ErrRevoked, "revoked"},
+		{errPart, "format"},
+		{fmt.Errorf("wrapped: %w", ErrSigMiss), "signature"},
+	}
+	for _, gold := range golden {
+		if got := ErrorClass(gold.err); got != gold.want {
+			t.Errorf("got class %q for %v, want %q", got, gold.err, gold.want)
+		}
+	}
+}
+
+// SignHS256Guest appends an HMAC signature with secret "guest".
+func signHS256Guest(tokenWithoutSignature string) []byte {
+	mac := hmac.New(sha256.New, []byte("guest"))
+	mac.Write([]byte(tokenWithoutSignature))
+	return []byte(tokenWithoutSignature + "." + encoding.EncodeToString(mac.Sum(nil)))
+}
+
+func TestUseNumber(t *testing.T) {
+	defer func(useNumber bool) {
+		UseNumber = useNumber // restore
+	}(UseNumber)
+
+	token := signHS256Guest("eyJhbGciOiJIUzI1NiJ9." + encoding.EncodeToString([]byte(`{"exp":1600000000.5,"snowflake":1234567890123456789,"nested":{"n":2}}`)))
+
+	UseNumber = false
+	c, err := HMACCheck(token, []byte("guest"))
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if _, ok := c.Set["snowflake"].(float64); !ok {
+		t.Errorf("got snowflake %T, want float64", c.Set["snowflake"])
+	}
+
+	UseNumber = true
+	c, err = HMACCheck(token, []byte("guest"))
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if got, want := c.Set["snowflake"], json.Number("1234567890123456789"); got != want {
+		t.Errorf("got snowflake %#v, want %#v", got, want)
+	}
+	if got, want := c.Set["nested"].(map[string]interface{})["n"], json.Number("2"); got != want {
+		t.Errorf("got nested number %#v, want %#v", got, want)
+	}
+	if c.Expires == nil || *c.Expires != 1600000000.5 {
+		t.Errorf("got expires %v, want 1600000000.5", c.Expires)
+	}
+	if f, ok := c.Number("snowflake"); !ok || f != 1234567890123456789 {
+		t.Errorf("got number (%v, %t), want (1234567890123456789, true)", f, ok)
+	}
+
+	token = signHS256Guest("eyJhbGciOiJIUzI1NiJ9." + encoding.EncodeToString([]byte(`{} {}`)))
+	if _, err := HMACCheck(token, []byte("guest")); err == nil {
+		t.Error("no error for trailing data")
+	}
+}
+
+func TestScanRegistered(t *testing.T) {
+	golden := []string{
+		`{}`,
+		`null`,
+		` { "iss" : "a" , "sub":"b\u0022c" ,"aud":"d", "exp":1.5e9, "nbf":-1, "iat":0, "jti":"\/" } `,
+		`{"aud":["a", 2, "b"], "extra": {"iss": "nested", "a": [1, "]", {"}": null}]}, "exp": "text"}`,
+		`{"\u0069ss": "escaped name", "sub": 1, "aud": [], "jti": null, "iat": true}`,
+		`{"iss": "first", "iss": "last", "exp": 1, "exp": false}`,
+		`{"aud": {"a": "b"}, "x\"y": "\\", "nbf": 1600000000.25}`,
+	}
+	for _, payload := range golden {
+		want := new(Claims)
+		buf := make([]byte, len(payload))
+		if err := want.applyPayload([]byte(encoding.EncodeToString([]byte(payload))), buf[:0]); err != nil {
+			t.Fatalf("%s: %s", payload, err)
+		}
+
+		got := new(Claims)
+		buf = make([]byte, len(payload))
+		if err := got.applyRegistered([]byte(encoding.EncodeToString([]byte(payload))), buf[:0]); err != nil {
+			t.Errorf("%s: %s", payload, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Registered, want.Registered) {
+			t.Errorf("%s: got %+v, want %+v", payload, got.Registered, want.Registered)
+		}
+		if got.Set != nil {
+			t.Errorf("%s: got Set %v, want nil", payload, got.Set)
+		}
+	}
+
+	for _, payload := range []string{`[]`, `"iss"`, `{"iss": "a",}`, `{"exp": 1e999}`} {
+		buf := make([]byte, len(payload))
+		if err := new(Claims).applyRegistered([]byte(encoding.EncodeToString([]byte(payload))), buf[:0]); err == nil {
+			t.Errorf("%s: no error", payload)
+		}
+	}
+}
+
+func TestKeyRegisterCheckRegistered(t *testing.T) {
+	keys := &KeyRegister{Secrets: [][]byte{[]byte("guest")}}
+	var c Claims
+	c.Subject = "alice"
+	c.Audiences = []string{"api"}
+	c.Set = map[string]interface{}{"scope": "read"}
+	token, err := c.HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	got, err := keys.CheckRegistered(token)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if got.Subject != "alice" || !reflect.DeepEqual(got.Audiences, []string{"api"}) || got.Set != nil {
+		t.Errorf("got subject %q, audiences %q, set %v; want alice, [api], nil", got.Subject, got.Audiences, got.Set)
+	}
+	if string(got.Raw) != string(c.Raw) {
+		t.Errorf("got raw %q, want %q", got.Raw, c.Raw)
+	}
+
+	keys.Secrets[0] = []byte("wrong")
+	if _, err := keys.CheckRegistered(token); err != ErrSigMiss {
+		t.Errorf("got error %v, want %v", err, ErrSigMiss)
+	}
+}
+
+func TestDecodeBase64(t *testing.T) {
+	defer func(lenient bool) {
+		LenientBase64 = lenient // restore
+	}(LenientBase64)
+
+	golden := []struct {
+		encoded string
+		want    string
+		strict  bool // whether valid in strict mode
+	}{
+		{"YQ", "a", true},
+		{"-_8", "\xfb\xff", true},
+		{"YQ==", "a", false},
+		{"Y\nQ", "a", false},
+		{"Y\r\nQ", "a", false},
+		{" YQ", "a", false},
+		{"+/8", "\xfb\xff", false},
+		{"YR", "a", false}, // non-zero trailing bits
+	}
+	for _, gold := range golden {
+		buf := make([]byte, len(gold.encoded))
+
+		LenientBase64 = false
+		n, err := decode(buf, []byte(gold.encoded))
+		switch {
+		case gold.strict && err != nil:
+			t.Errorf("%q: got error %q", gold.encoded, err)
+		case gold.strict && string(buf[:n]) != gold.want:
+			t.Errorf("%q: got %q, want %q", gold.encoded, buf[:n], gold.want)
+		case !gold.strict && err == nil:
+			t.Errorf("%q: no error in strict mode", gold.encoded)
+		}
+
+		LenientBase64 = true
+		n, err = decode(buf, []byte(gold.encoded))
+		if err != nil {
+			t.Errorf("%q: got error %q in lenient mode", gold.encoded, err)
+		} else if string(buf[:n]) != gold.want {
+			t.Errorf("%q: got %q in lenient mode, want %q", gold.encoded, buf[:n], gold.want)
+		}
+	}
+}
+
+func TestCheckBase64NewLine(t *testing.T) {
+	defer func(lenient bool) {
+		LenientBase64 = lenient // restore
+	}(LenientBase64)
+
+	token := signHS256Guest("eyJhbGciOiJIUzI1NiJ9.e30\r\n")
+
+	LenientBase64 = false
+	_, err := HMACCheck(token, []byte("guest"))
+	if err == nil || !strings.Contains(err.Error(), "malformed payload") {
+		t.Errorf("got error %v, want malformed payload", err)
+	}
+
+	LenientBase64 = true
+	if _, err := HMACCheck(token, []byte("guest")); err != nil {
+		t.Errorf("got error %q in lenient mode", err)
+	}
+}
+
 func TestRejectNone(t *testing.T) {
 	// example from RFC 7519, subsection 6.1.
 	const token = "eyJhbGciOiJub25lIn0.eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ."
@@ -335,3 +695,61 @@ func TestCheckBrokenJSON(t *testing.T) {
 		t.Errorf("corrupt JSON in payload got error %v, want %s…", err, want)
 	}
 }
+
+func TestPeekHeader(t *testing.T) {
+	var c Claims
+	c.KeyID = "k1"
+	c.Subject = "test"
+	token, err := c.HMACSign(HS256, []byte("guest"), json.RawMessage(`{"typ":"JWT","cty":"text/plain"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := PeekHeader(token)
+	if err != nil {
+		t.Fatal("peek error:", err)
+	}
+	if h.Alg != HS256 || h.KeyID != "k1" || h.Type != "JWT" || h.ContentType != "text/plain" {
+		t.Errorf("got alg %q, kid %q, typ %q, cty %q; want HS256, k1, JWT, text/plain", h.Alg, h.KeyID, h.Type, h.ContentType)
+	}
+
+	// payload is not interpreted
+	if _, err := PeekHeader([]byte("eyJhbGciOiJIUzI1NiJ9.broken.")); err != nil {
+		t.Error("peek error on broken payload:", err)
+	}
+	for _, token := range []string{"", "eyJhbGciOiJIUzI1NiJ9", "eyJhbGciOiJIUzI1NiJ9.e30"} {
+		if _, err := PeekHeader([]byte(token)); err != errPart {
+			t.Errorf("%q: got error %v, want %v", token, err, errPart)
+		}
+	}
+	if _, err := PeekHeader([]byte("e3!.e30.")); err == nil {
+		t.Error("no error for malformed base64")
+	}
+}
+
+// PeekHeader must agree with Check on the key identifier.
+func TestPeekHeaderCase(t *testing.T) {
+	token := signHS256Guest(encoding.EncodeToString([]byte(`{"ALG":"HS256","KID":"k1","Typ":"JWT"}`)) + ".e30")
+	keys := &KeyRegister{Secrets: [][]byte{[]byte("guest")}, SecretIDs: []string{"k1"}}
+	c, err := keys.Check(token)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	for _, f := range []func() (*Header, error){
+		func() (*Header, error) { return PeekHeader(token) },
+		c.Header,
+	} {
+		h, err := f()
+		if err != nil {
+			t.Fatal("header error:", err)
+		}
+		if h.Alg != HS256 || h.KeyID != "k1" || h.Type != "JWT" || len(h.Set) != 0 {
+			t.Errorf("got alg %q, kid %q, typ %q and set %v; want HS256, k1, JWT and none", h.Alg, h.KeyID, h.Type, h.Set)
+		}
+	}
+
+	// case variants are ambiguous
+	token = signHS256Guest(encoding.EncodeToString([]byte(`{"alg":"HS256","kid":"k1","KID":"evil"}`)) + ".e30")
+	if _, err := PeekHeader(token); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("got error %v for case variants, want duplicate name", err)
+	}
+}
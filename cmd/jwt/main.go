@@ -0,0 +1,270 @@
+// Command jwt decodes, verifies and signs JSON Web Tokens with the exact same
+// code as services which use the package.
+//
+//	jwt decode [token]
+//	jwt verify [-pem file] [-jwk file] [-jwks URL] [token]
+//	jwt sign -alg name -key file [-kid id] [-exp duration] [claims]
+//
+// Tokens and claims (as a JSON object) are read from standard input when not
+// provided as an argument. A "Bearer " prefix on tokens is ignored. Verify
+// exits with status 1 when the signature doesn't check out, or when the claims
+// are not valid at the current time. Keys for signing are PEM-encoded, except
+// for the HMAC algorithms, which read the file content as the secret as is.
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+const usage = `usage:
+	jwt decode [token]
+	jwt verify [-pem file] [-jwk file] [-jwks URL] [token]
+	jwt sign -alg name -key file [-kid id] [-exp duration] [claims]
+`
+
+// Run executes the command, and it returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "decode":
+		err = decode(args[1:], stdin, stdout, stderr)
+	case "verify":
+		err = verify(args[1:], stdin, stdout, stderr)
+	case "sign":
+		err = sign(args[1:], stdin, stdout, stderr)
+	default:
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	switch {
+	case err == nil:
+		return 0
+	case err == flag.ErrHelp:
+		return 2
+	default:
+		msg := err.Error()
+		if !strings.HasPrefix(msg, "jwt: ") {
+			msg = "jwt: " + msg
+		}
+		fmt.Fprintln(stderr, msg)
+		return 1
+	}
+}
+
+func decode(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("decode", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return flag.ErrHelp // reported by flags
+	}
+	token, err := input(flags, stdin)
+	if err != nil {
+		return err
+	}
+
+	// no ParseWithoutCheck, as EvalCrit would deny tokens with extensions
+	parts := bytes.Split(token, []byte{'.'})
+	if len(parts) != 3 {
+		return errors.New("token needs 3 dot-separated parts")
+	}
+	header, err := base64.RawURLEncoding.DecodeString(string(parts[0]))
+	if err != nil {
+		return fmt.Errorf("malformed JOSE header: %w", err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(string(parts[1]))
+	if err != nil {
+		return fmt.Errorf("malformed payload: %w", err)
+	}
+	if !json.Valid(header) {
+		return errors.New("malformed JOSE header: not JSON")
+	}
+	if !json.Valid(payload) {
+		return errors.New("malformed payload: not JSON")
+	}
+	if err := printJSON(stdout, header); err != nil {
+		return err
+	}
+	return printJSON(stdout, payload)
+}
+
+func verify(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	pemFile := flags.String("pem", "", "PEM `file` with public keys, private keys and/or certificates")
+	jwkFile := flags.String("jwk", "", "`file` with a JWK or a JWK Set")
+	jwksURL := flags.String("jwks", "", "`URL` of a JWK Set")
+	if err := flags.Parse(args); err != nil {
+		return flag.ErrHelp // reported by flags
+	}
+	token, err := input(flags, stdin)
+	if err != nil {
+		return err
+	}
+
+	var keys jwt.KeyRegister
+	if *pemFile != "" {
+		text, err := ioutil.ReadFile(*pemFile)
+		if err != nil {
+			return err
+		}
+		if _, err := keys.LoadPEM(text, nil); err != nil {
+			return fmt.Errorf("%s: %w", *pemFile, err)
+		}
+	}
+	if *jwkFile != "" {
+		data, err := ioutil.ReadFile(*jwkFile)
+		if err != nil {
+			return err
+		}
+		if _, err := keys.LoadJWK(data); err != nil {
+			return fmt.Errorf("%s: %w", *jwkFile, err)
+		}
+	}
+
+	var claims *jwt.Claims
+	switch {
+	case *jwksURL != "":
+		if *pemFile != "" || *jwkFile != "" {
+			return errors.New("JWKS can't be combined with other keys")
+		}
+		claims, err = (&jwt.RemoteJWKS{URL: *jwksURL}).Check(token)
+	case *pemFile != "" || *jwkFile != "":
+		claims, err = keys.Check(token)
+	default:
+		return errors.New("verify needs keys; see -pem, -jwk or -jwks")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := printJSON(stdout, claims.RawHeader); err != nil {
+		return err
+	}
+	if err := printJSON(stdout, claims.Raw); err != nil {
+		return err
+	}
+	if !claims.Valid(time.Now()) {
+		return errors.New("claims not valid at current time")
+	}
+	return nil
+}
+
+func sign(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	alg := flags.String("alg", "", "algorithm `name`, e.g., ES256")
+	keyFile := flags.String("key", "", "private key `file`")
+	kid := flags.String("kid", "", "key `ID` for the JOSE header")
+	exp := flags.Duration("exp", 0, "expiration `duration` from now, which sets iat, nbf and exp")
+	if err := flags.Parse(args); err != nil {
+		return flag.ErrHelp // reported by flags
+	}
+	if *alg == "" || *keyFile == "" {
+		return errors.New("sign needs both -alg and -key")
+	}
+	data, err := input(flags, stdin)
+	if err != nil {
+		return err
+	}
+
+	var c jwt.Claims
+	if err := json.Unmarshal(data, &c.Set); err != nil {
+		return fmt.Errorf("claims not a JSON object: %w", err)
+	}
+	if c.Set == nil {
+		return errors.New("claims not a JSON object")
+	}
+	c.KeyID = *kid
+	if *exp != 0 {
+		c.ExpiresIn(*exp)
+	}
+
+	keyData, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	var key crypto.PrivateKey = keyData
+	if _, ok := jwt.HMACAlgs[*alg]; !ok {
+		key, err = parsePrivateKey(keyData)
+		if err != nil {
+			return fmt.Errorf("%s: %w", *keyFile, err)
+		}
+	}
+
+	token, err := c.Sign(*alg, key)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%s\n", token)
+	return err
+}
+
+// Input returns the first argument, or standard input in absence.
+func input(flags *flag.FlagSet, stdin io.Reader) ([]byte, error) {
+	var data []byte
+	switch flags.NArg() {
+	case 0:
+		var err error
+		data, err = ioutil.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+	case 1:
+		data = []byte(flags.Arg(0))
+	default:
+		return nil, fmt.Errorf("operand %q unexpected", flags.Arg(1))
+	}
+	data = bytes.TrimSpace(data)
+	return bytes.TrimPrefix(data, []byte("Bearer ")), nil
+}
+
+func parsePrivateKey(text []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(text)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("PEM type %q not a private key", block.Type)
+	}
+}
+
+func printJSON(w io.Writer, data []byte) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "\t"); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runTest(t *testing.T, stdin string, args ...string) (status int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	status = run(args, strings.NewReader(stdin), &out, &errOut)
+	return status, out.String(), errOut.String()
+}
+
+func TestSignVerifyDecode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwt-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	status, token, stderr := runTest(t, `{"sub":"test"}`, "sign", "-alg", "ES256", "-key", keyFile, "-kid", "k1", "-exp", "1h")
+	if status != 0 {
+		t.Fatalf("sign got status %d with: %s", status, stderr)
+	}
+
+	status, stdout, stderr := runTest(t, "", "verify", "-pem", keyFile, "Bearer "+strings.TrimSpace(token))
+	if status != 0 {
+		t.Fatalf("verify got status %d with: %s", status, stderr)
+	}
+	for _, want := range []string{`"alg": "ES256"`, `"kid": "k1"`, `"sub": "test"`, `"exp": `} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("verify output %q misses %q", stdout, want)
+		}
+	}
+
+	status, decoded, stderr := runTest(t, token, "decode")
+	if status != 0 {
+		t.Fatalf("decode got status %d with: %s", status, stderr)
+	}
+	if decoded != stdout {
+		t.Errorf("decode got %q, want verify output %q", decoded, stdout)
+	}
+}
+
+func TestDecodeCrit(t *testing.T) {
+	// header {"alg":"HS256","crit":["exp"],"exp":1363284000}, conform the example
+	// of RFC 7515, subsection 4.1.11
+	const token = "eyJhbGciOiJIUzI1NiIsImNyaXQiOlsiZXhwIl0sImV4cCI6MTM2MzI4NDAwMH0.eyJzdWIiOiJ0ZXN0In0.c2ln"
+	status, stdout, stderr := runTest(t, token, "decode")
+	if status != 0 {
+		t.Fatalf("decode got status %d with: %s", status, stderr)
+	}
+	for _, want := range []string{`"crit": [`, `"exp": 1363284000`, `"sub": "test"`} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("decode output %q misses %q", stdout, want)
+		}
+	}
+
+	for _, token := range []string{"e30.e30", "e30.!.", "bm8.e30."} {
+		if status, _, _ := runTest(t, token, "decode"); status != 1 {
+			t.Errorf("decode %q got status %d, want 1", token, status)
+		}
+	}
+}
+
+func TestVerifyFail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwt-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secretFile := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secretFile, []byte("guest"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	jwkFile := filepath.Join(dir, "key.jwk")
+	if err := ioutil.WriteFile(jwkFile, []byte(`{"kty":"oct","k":"aW50cnVkZXI"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	status, token, stderr := runTest(t, `{"exp":1}`, "sign", "-alg", "HS256", "-key", secretFile)
+	if status != 0 {
+		t.Fatalf("sign got status %d with: %s", status, stderr)
+	}
+
+	status, _, stderr = runTest(t, token, "verify", "-jwk", jwkFile)
+	if want := "jwt: signature mismatch\n"; status != 1 || stderr != want {
+		t.Errorf("verify with wrong secret got status %d with %q, want status 1 with %q", status, stderr, want)
+	}
+
+	if err := ioutil.WriteFile(jwkFile, []byte(`{"kty":"oct","k":"Z3Vlc3Q"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	status, _, stderr = runTest(t, token, "verify", "-jwk", jwkFile)
+	if want := "jwt: claims not valid at current time\n"; status != 1 || stderr != want {
+		t.Errorf("verify expired got status %d with %q, want status 1 with %q", status, stderr, want)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"doesntexist"}, {"decode", "-doesntexist"}} {
+		if status, _, _ := runTest(t, "", args...); status != 2 {
+			t.Errorf("%q got status %d, want 2", args, status)
+		}
+	}
+	if status, _, stderr := runTest(t, "", "sign", "-alg", "ES256"); status != 1 || !strings.Contains(stderr, "-key") {
+		t.Errorf("sign without key got status %d with %q", status, stderr)
+	}
+}
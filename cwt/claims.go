@@ -0,0 +1,165 @@
+package cwt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/pascaldekloe/jwt"
+	"github.com/pascaldekloe/jwt/internal/cbor"
+)
+
+// EncodeClaims returns the CBOR map of the claims. Registered field values take
+// precedence over Set, as with the JWT encoding.
+func encodeClaims(c *jwt.Claims) ([]byte, error) {
+	m := make(map[interface{}]interface{}, len(c.Set)+7)
+	for name, v := range c.Set {
+		if key, ok := claimKeys[name]; ok {
+			m[key] = v
+		} else if key, err := strconv.ParseInt(name, 10, 64); err == nil && strconv.FormatInt(key, 10) == name {
+			m[key] = v // restore unregistered integer key
+		} else {
+			m[name] = v
+		}
+	}
+
+	if c.Issuer != "" {
+		m[claimKeys["iss"]] = c.Issuer
+	}
+	if c.Subject != "" {
+		m[claimKeys["sub"]] = c.Subject
+	}
+	switch len(c.Audiences) {
+	case 0:
+		break
+	case 1:
+		m[claimKeys["aud"]] = c.Audiences[0]
+	default:
+		m[claimKeys["aud"]] = c.Audiences
+	}
+	if c.Expires != nil {
+		m[claimKeys["exp"]] = float64(*c.Expires)
+	}
+	if c.NotBefore != nil {
+		m[claimKeys["nbf"]] = float64(*c.NotBefore)
+	}
+	if c.Issued != nil {
+		m[claimKeys["iat"]] = float64(*c.Issued)
+	}
+	if c.ID != "" {
+		m[claimKeys["cti"]] = []byte(c.ID)
+	}
+
+	var e cbor.Encoder
+	if err := e.Map(m); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// DecodeClaims parses a CBOR map conform the package documentation.
+func decodeClaims(payload []byte) (*jwt.Claims, error) {
+	d := cbor.Decoder{Data: payload}
+	v, err := d.Value()
+	if err != nil {
+		return nil, fmt.Errorf("cwt: malformed payload: %w", err)
+	}
+	if len(d.Data) != 0 {
+		return nil, errors.New("cwt: malformed payload: trailing data")
+	}
+	raw, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("cwt: payload not a CBOR map")
+	}
+
+	c := &jwt.Claims{Set: make(map[string]interface{}, len(raw))}
+	for k, v := range raw {
+		var name string
+		switch k := k.(type) {
+		case int64:
+			var ok bool
+			name, ok = claimNames[k]
+			if !ok {
+				name = strconv.FormatInt(k, 10)
+			}
+		case string:
+			name = k
+		}
+		if _, ok := c.Set[name]; ok {
+			return nil, fmt.Errorf("cwt: claim %q both by name and by key", name)
+		}
+		c.Set[name] = setValue(v)
+	}
+
+	// move from Set to Registered on type match
+	m := c.Set
+	if s, ok := m["iss"].(string); ok {
+		delete(m, "iss")
+		c.Issuer = s
+	}
+	if s, ok := m["sub"].(string); ok {
+		delete(m, "sub")
+		c.Subject = s
+	}
+	switch a := m["aud"].(type) {
+	case []interface{}:
+		allStrings := true
+		for _, o := range a {
+			if s, ok := o.(string); ok {
+				c.Audiences = append(c.Audiences, s)
+			} else {
+				allStrings = false
+			}
+		}
+		if allStrings {
+			delete(m, "aud")
+		}
+	case string:
+		delete(m, "aud")
+		c.Audiences = []string{a}
+	}
+	if f, ok := m["exp"].(float64); ok {
+		delete(m, "exp")
+		c.Expires = (*jwt.NumericTime)(&f)
+	}
+	if f, ok := m["nbf"].(float64); ok {
+		delete(m, "nbf")
+		c.NotBefore = (*jwt.NumericTime)(&f)
+	}
+	if f, ok := m["iat"].(float64); ok {
+		delete(m, "iat")
+		c.Issued = (*jwt.NumericTime)(&f)
+	}
+	if b, ok := m["cti"].([]byte); ok {
+		delete(m, "cti")
+		c.ID = string(b)
+	}
+	return c, nil
+}
+
+// SetValue converts a decoded value for use in jwt.Claims.Set. Integers become
+// float64, and map keys become a (decimal) string.
+func setValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case []interface{}:
+		for i, o := range v {
+			v[i] = setValue(o)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, o := range v {
+			switch k := k.(type) {
+			case int64:
+				m[strconv.FormatInt(k, 10)] = setValue(o)
+			case string:
+				m[k] = setValue(o)
+			}
+		}
+		return m
+	default:
+		return v
+	}
+}
@@ -0,0 +1,330 @@
+// Package cwt implements “CBOR Web Token (CWT)” RFC 8392, with the same Claims
+// model and key management as package jwt. Tokens are either a COSE_Sign1 or,
+// for the HMAC algorithms, a COSE_Mac0 structure, conform “CBOR Object Signing
+// and Encryption (COSE)” RFC 9052. Signatures only; no encrypted tokens.
+//
+// The algorithms use their JOSE name, e.g., jwt.ES256 for COSE algorithm -7.
+// Configuration from jwt.ECDSAAlgs, jwt.HMACAlgs and jwt.RSAAlgs applies as is.
+// Algorithms from jwt.RegisterAlg are not supported (for lack of a COSE ID).
+//
+// The integer keys of the registered claims map to the Registered fields, with
+// "cti" to ID. Other claims map by name in Set, including "cnf" and "scope" by
+// their CWT key. Integer keys without registration map by their decimal string
+// in Set. CBOR byte strings decode as []byte, and integers as float64, conform
+// the encoding/json convention of Set. Claims.Raw and Claims.RawHeader remain
+// nil, as the content is not JSON.
+package cwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/pascaldekloe/jwt"
+	"github.com/pascaldekloe/jwt/internal/cbor"
+)
+
+// CBOR tags from RFC 8392, section 6, and RFC 9052, section 2.
+const (
+	tagCWT   = 61
+	tagSign1 = 18
+	tagMac0  = 17
+)
+
+// COSE header labels from RFC 9052, subsection 3.1.
+const (
+	headerAlg         = 1
+	headerContentType = 3
+	headerKID         = 4
+)
+
+// CoseAlgs has the COSE algorithm identifiers from the IANA registry.
+var coseAlgs = map[string]int64{
+	jwt.ES256: -7,
+	jwt.ES384: -35,
+	jwt.ES512: -36,
+	jwt.EdDSA: -8,
+	jwt.PS256: -37,
+	jwt.PS384: -38,
+	jwt.PS512: -39,
+	jwt.RS256: -257,
+	jwt.RS384: -258,
+	jwt.RS512: -259,
+	jwt.HS256: 5, // HMAC 256/256
+	jwt.HS384: 6, // HMAC 384/384
+	jwt.HS512: 7, // HMAC 512/512
+}
+
+// ClaimKeys has the integer keys from the IANA “CBOR Web Token (CWT) Claims”
+// registry.
+var claimKeys = map[string]int64{
+	"iss":   1,
+	"sub":   2,
+	"aud":   3,
+	"exp":   4,
+	"nbf":   5,
+	"iat":   6,
+	"cti":   7,
+	"cnf":   8,
+	"scope": 9,
+}
+
+var claimNames = func() map[int64]string {
+	m := make(map[int64]string, len(claimKeys))
+	for name, key := range claimKeys {
+		m[key] = name
+	}
+	return m
+}()
+
+var errNoTag = errors.New("cwt: token not a tagged COSE_Sign1 nor COSE_Mac0")
+
+// Sign returns a CWT with the claims. Any KeyID goes in the unprotected header.
+// The key type must match the algorithm, as with jwt.Claims.Sign. Hardware
+// keys work as a crypto.Signer, except for HMAC.
+func Sign(c *jwt.Claims, alg string, key crypto.PrivateKey) (token []byte, err error) {
+	coseAlg, ok := coseAlgs[alg]
+	if !ok {
+		return nil, jwt.AlgError(alg)
+	}
+	payload, err := encodeClaims(c)
+	if err != nil {
+		return nil, err
+	}
+	var protected cbor.Encoder
+	protected.Map(map[interface{}]interface{}{int64(headerAlg): coseAlg})
+
+	_, isHMAC := jwt.HMACAlgs[alg]
+	context, tag := "Signature1", uint64(tagSign1)
+	if isHMAC {
+		context, tag = "MAC0", tagMac0
+	}
+	sig, err := signature(alg, key, toBeSigned(context, protected.Bytes(), payload))
+	if err != nil {
+		return nil, err
+	}
+
+	var e cbor.Encoder
+	e.Head(cbor.MajorTag, tag)
+	e.Head(cbor.MajorArray, 4)
+	e.ByteString(protected.Bytes())
+	unprotected := make(map[interface{}]interface{})
+	if c.KeyID != "" {
+		unprotected[int64(headerKID)] = []byte(c.KeyID)
+	}
+	e.Map(unprotected)
+	e.ByteString(payload)
+	e.ByteString(sig)
+	return e.Bytes(), nil
+}
+
+// ToBeSigned returns the Sig_structure or the MAC_structure, with an empty
+// external AAD.
+func toBeSigned(context string, protected, payload []byte) []byte {
+	var e cbor.Encoder
+	e.Head(cbor.MajorArray, 4)
+	e.Text(context)
+	e.ByteString(protected)
+	e.ByteString(nil)
+	e.ByteString(payload)
+	return e.Bytes()
+}
+
+func signature(alg string, key crypto.PrivateKey, content []byte) ([]byte, error) {
+	if secret, ok := key.([]byte); ok {
+		hash, ok := jwt.HMACAlgs[alg]
+		if !ok {
+			return nil, jwt.AlgError(alg)
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("cwt: empty secret rejected")
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(content)
+		return mac.Sum(nil), nil
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("cwt: key type %T not supported", key)
+	}
+	switch pub := signer.Public().(type) {
+	case ed25519.PublicKey:
+		if alg != jwt.EdDSA {
+			return nil, fmt.Errorf("cwt: algorithm %q with Ed25519 key", alg)
+		}
+		return signer.Sign(rand.Reader, content, crypto.Hash(0))
+
+	case *ecdsa.PublicKey:
+		hash, ok := jwt.ECDSAAlgs[alg]
+		if !ok {
+			return nil, jwt.AlgError(alg)
+		}
+		digest := hash.New()
+		digest.Write(content)
+		der, err := signer.Sign(rand.Reader, digest.Sum(nil), hash)
+		if err != nil {
+			return nil, err
+		}
+		r, s, err := parseASN1Sig(der)
+		if err != nil {
+			return nil, err
+		}
+		// fixed-width r || s, as with JWS
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*size)
+		if r.BitLen() > 8*size || s.BitLen() > 8*size {
+			return nil, errors.New("cwt: ECDSA signature exceeds curve size")
+		}
+		rBytes, sBytes := r.Bytes(), s.Bytes()
+		copy(sig[size-len(rBytes):size], rBytes)
+		copy(sig[2*size-len(sBytes):], sBytes)
+		return sig, nil
+
+	case *rsa.PublicKey:
+		hash, ok := jwt.RSAAlgs[alg]
+		if !ok {
+			return nil, jwt.AlgError(alg)
+		}
+		digest := hash.New()
+		digest.Write(content)
+		var opts crypto.SignerOpts = hash
+		if alg[0] == 'P' {
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+		}
+		return signer.Sign(rand.Reader, digest.Sum(nil), opts)
+
+	default:
+		return nil, fmt.Errorf("cwt: public key type %T not supported", pub)
+	}
+}
+
+// Check parses a CWT if, and only if, the signature (or MAC) checks out with
+// any of the keys. The register applies as with jwt.KeyRegister.Check, i.e.,
+// with the key ID selection, PinnedSPKIs, StrictHMAC, ContentTypes, DetailedMiss
+// and UniformTiming. A content type in CoAP Content-Format compares by its
+// decimal string. Use Claims.Valid to complete the verification.
+func Check(token []byte, keys *jwt.KeyRegister) (*jwt.Claims, error) {
+	d := cbor.Decoder{Data: token}
+	major, tag, err := d.Head()
+	if err != nil {
+		return nil, err
+	}
+	if major == cbor.MajorTag && tag == tagCWT {
+		major, tag, err = d.Head()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if major != cbor.MajorTag || (tag != tagSign1 && tag != tagMac0) {
+		return nil, errNoTag
+	}
+	v, err := d.Value()
+	if err != nil {
+		return nil, err
+	}
+	if len(d.Data) != 0 {
+		return nil, errors.New("cwt: trailing data after COSE structure")
+	}
+	a, ok := v.([]interface{})
+	if !ok || len(a) != 4 {
+		return nil, errors.New("cwt: COSE structure not an array of 4")
+	}
+	protected, ok1 := a[0].([]byte)
+	unprotected, ok2 := a[1].(map[interface{}]interface{})
+	payload, ok3 := a[2].([]byte)
+	sig, ok4 := a[3].([]byte)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, errors.New("cwt: malformed COSE structure")
+	}
+
+	params := make(map[interface{}]interface{})
+	if len(protected) != 0 {
+		d := cbor.Decoder{Data: protected}
+		v, err := d.Value()
+		if err != nil {
+			return nil, fmt.Errorf("cwt: malformed protected header: %w", err)
+		}
+		m, ok := v.(map[interface{}]interface{})
+		if !ok || len(d.Data) != 0 {
+			return nil, errors.New("cwt: protected header not a CBOR map")
+		}
+		params = m
+	}
+	for k, v := range unprotected {
+		if _, ok := params[k]; ok {
+			return nil, fmt.Errorf("cwt: header label %v in both protected and unprotected", k)
+		}
+		if k == int64(headerAlg) {
+			return nil, errors.New("cwt: algorithm not in protected header")
+		}
+		params[k] = v
+	}
+
+	coseAlg, ok := params[int64(headerAlg)].(int64)
+	if !ok {
+		return nil, errors.New("cwt: no algorithm in protected header")
+	}
+	alg := ""
+	for name, id := range coseAlgs {
+		if id == coseAlg {
+			alg = name
+		}
+	}
+	if alg == "" {
+		return nil, fmt.Errorf("cwt: COSE algorithm %d not supported", coseAlg)
+	}
+	_, isHMAC := jwt.HMACAlgs[alg]
+	if isHMAC != (tag == tagMac0) {
+		return nil, fmt.Errorf("cwt: algorithm %q not applicable to COSE tag %d", alg, tag)
+	}
+	var kid string
+	if b, ok := params[int64(headerKID)].([]byte); ok {
+		kid = string(b)
+	}
+	var cty string
+	switch v := params[int64(headerContentType)].(type) {
+	case string:
+		cty = v
+	case int64:
+		cty = strconv.FormatInt(v, 10) // CoAP Content-Format
+	}
+	if !keys.AcceptContentType(cty) {
+		return nil, jwt.ContentTypeError(cty)
+	}
+
+	context := "Signature1"
+	if isHMAC {
+		context = "MAC0"
+	}
+	if err := keys.VerifySignature(alg, kid, toBeSigned(context, protected, payload), sig); err != nil {
+		return nil, err
+	}
+
+	c, err := decodeClaims(payload)
+	if err != nil {
+		return nil, err
+	}
+	c.KeyID = kid
+	return c, nil
+}
+
+func parseASN1Sig(der []byte) (r, s *big.Int, err error) {
+	var sig struct{ R, S *big.Int }
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cwt: malformed ECDSA signature from signer: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, nil, errors.New("cwt: trailing data after ECDSA signature from signer")
+	}
+	return sig.R, sig.S, nil
+}
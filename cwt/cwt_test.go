@@ -0,0 +1,212 @@
+package cwt
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/pascaldekloe/jwt"
+	"github.com/pascaldekloe/jwt/internal/cbor"
+)
+
+// Claims Set from RFC 8392, appendix A.1.
+const exampleClaimsHex = "a70175636f61703a2f2f61732e6578616d706c652e636f6d02656572696b77037818636f61703a2f2f6c696768742e6578616d706c652e636f6d041a5612aeb0051a5610d9f0061a5610d9f007420b71"
+
+func TestExampleClaims(t *testing.T) {
+	payload, err := hex.DecodeString(exampleClaimsHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := decodeClaims(payload)
+	if err != nil {
+		t.Fatal("decode error:", err)
+	}
+	if c.Issuer != "coap://as.example.com" {
+		t.Errorf("got issuer %q, want coap://as.example.com", c.Issuer)
+	}
+	if c.Subject != "erikw" {
+		t.Errorf("got subject %q, want erikw", c.Subject)
+	}
+	if !reflect.DeepEqual(c.Audiences, []string{"coap://light.example.com"}) {
+		t.Errorf("got audiences %q, want coap://light.example.com", c.Audiences)
+	}
+	if c.Expires == nil || *c.Expires != 1444064944 {
+		t.Errorf("got expires %v, want 1444064944", c.Expires)
+	}
+	if c.NotBefore == nil || *c.NotBefore != 1443944944 {
+		t.Errorf("got not before %v, want 1443944944", c.NotBefore)
+	}
+	if c.Issued == nil || *c.Issued != 1443944944 {
+		t.Errorf("got issued %v, want 1443944944", c.Issued)
+	}
+	if c.ID != "\x0b\x71" {
+		t.Errorf("got ID %q, want 0x0b71", c.ID)
+	}
+	if len(c.Set) != 0 {
+		t.Errorf("got remaining claims %v", c.Set)
+	}
+
+	again, err := encodeClaims(c)
+	if err != nil {
+		t.Fatal("encode error:", err)
+	}
+	if !bytes.Equal(again, payload) {
+		t.Errorf("got encoding %x, want %x", again, payload)
+	}
+}
+
+func TestSetRoundTrip(t *testing.T) {
+	c := &jwt.Claims{Set: map[string]interface{}{
+		"cnf":   map[string]interface{}{"kid": []byte{1, 2}},
+		"scope": "read write",
+		"nested": []interface{}{
+			true, nil, 1.5, -2.0, "x",
+		},
+		"-65537": "private use",
+	}}
+	c.Audiences = []string{"a1", "a2"}
+
+	payload, err := encodeClaims(c)
+	if err != nil {
+		t.Fatal("encode error:", err)
+	}
+	got, err := decodeClaims(payload)
+	if err != nil {
+		t.Fatal("decode error:", err)
+	}
+	if !reflect.DeepEqual(got.Set, c.Set) {
+		t.Errorf("got claims %#v, want %#v", got.Set, c.Set)
+	}
+	if !reflect.DeepEqual(got.Audiences, c.Audiences) {
+		t.Errorf("got audiences %q, want %q", got.Audiences, c.Audiences)
+	}
+}
+
+func TestSignCheck(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("guest")
+
+	keys := &jwt.KeyRegister{
+		ECDSAs:    []*ecdsa.PublicKey{&ecKey.PublicKey},
+		EdDSAs:    []ed25519.PublicKey{edKey.Public().(ed25519.PublicKey)},
+		RSAs:      []*rsa.PublicKey{&rsaKey.PublicKey},
+		Secrets:   [][]byte{[]byte("intruder"), secret},
+		SecretIDs: []string{"", "k2"},
+	}
+
+	for _, test := range []struct {
+		alg string
+		key interface{}
+	}{
+		{jwt.ES384, ecKey},
+		{jwt.EdDSA, edKey},
+		{jwt.PS256, rsaKey},
+		{jwt.RS512, rsaKey},
+		{jwt.HS256, secret},
+	} {
+		var c jwt.Claims
+		c.Subject = "test"
+		c.ID = "id"
+		c.KeyID = "k2"
+		token, err := Sign(&c, test.alg, test.key)
+		if err != nil {
+			t.Errorf("%s sign error: %s", test.alg, err)
+			continue
+		}
+		got, err := Check(token, keys)
+		if err != nil {
+			t.Errorf("%s check error: %s", test.alg, err)
+			continue
+		}
+		if got.Subject != "test" || got.ID != "id" || got.KeyID != "k2" {
+			t.Errorf("%s got subject %q, ID %q and key ID %q", test.alg, got.Subject, got.ID, got.KeyID)
+		}
+
+		token[len(token)-1] ^= 1
+		if _, err := Check(token, keys); err != jwt.ErrSigMiss {
+			t.Errorf("%s got error %v for altered signature, want %v", test.alg, err, jwt.ErrSigMiss)
+		}
+	}
+}
+
+func TestCheckRegisterPolicies(t *testing.T) {
+	var c jwt.Claims
+	c.Subject = "test"
+	token, err := Sign(&c, jwt.HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+
+	keys := &jwt.KeyRegister{Secrets: [][]byte{[]byte("guest")}, StrictHMAC: true}
+	if _, err := Check(token, keys); err != jwt.ErrSigMiss {
+		t.Errorf("short secret with StrictHMAC got error %v, want %v", err, jwt.ErrSigMiss)
+	}
+	keys = &jwt.KeyRegister{StrictHMAC: true}
+	if _, err := Check(token, keys); err != jwt.AlgError(jwt.HS256) {
+		t.Errorf("no secrets with StrictHMAC got error %v, want %v", err, jwt.AlgError(jwt.HS256))
+	}
+
+	keys = &jwt.KeyRegister{Secrets: [][]byte{[]byte("guest")}, ContentTypes: []string{"cwt"}}
+	if _, err := Check(token, keys); err != jwt.ContentTypeError("") {
+		t.Errorf("no content type got error %v, want %v", err, jwt.ContentTypeError(""))
+	}
+	keys.ContentTypes = append(keys.ContentTypes, "")
+	if _, err := Check(token, keys); err != nil {
+		t.Error("check error:", err)
+	}
+
+	keys = &jwt.KeyRegister{Secrets: [][]byte{[]byte("intruder")}, DetailedMiss: true}
+	_, err = Check(token, keys)
+	var miss *jwt.MissError
+	if !errors.As(err, &miss) || miss.Field != "Secrets" || miss.Candidates != 1 {
+		t.Errorf("got error %v, want a MissError on 1 of the Secrets", err)
+	}
+}
+
+func TestCheckMalformed(t *testing.T) {
+	var c jwt.Claims
+	token, err := Sign(&c, jwt.HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &jwt.KeyRegister{Secrets: [][]byte{[]byte("guest")}}
+
+	if _, err := Check(token[1:], keys); err != errNoTag {
+		t.Errorf("untagged got error %v, want %v", err, errNoTag)
+	}
+	for i := 1; i < len(token); i++ {
+		if _, err := Check(token[:i], keys); err == nil {
+			t.Errorf("truncation at %d accepted", i)
+		}
+	}
+	if _, err := Check(append(token, 0), keys); err == nil {
+		t.Error("trailing data accepted")
+	}
+	// CWT tag prefix
+	if _, err := Check(append([]byte{0xd8, tagCWT}, token...), keys); err != nil {
+		t.Error("CWT tag error:", err)
+	}
+	// nesting limit
+	deep := bytes.Repeat([]byte{0x81}, cbor.MaxDepth+1)
+	if _, err := Check(append([]byte{0xd2}, deep...), keys); err == nil {
+		t.Error("deep nesting accepted")
+	}
+}
@@ -0,0 +1,95 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+)
+
+var errDigestAlg = errors.New("jwt: algorithm can't verify a digest, as it needs the signing input as a whole")
+
+// VerifyDigest checks a JWS with detached content, as in RFC 7515, appendix F,
+// against a digest which was computed elsewhere, e.g., by the storage layer or
+// by hardware, such that multi-megabyte content need not pass through memory.
+// The signature is in the compact serialization without the payload part,
+// i.e., "header..signature". The sum must be of the signing input: the header
+// part of signature up to and including the first dot, followed by the base64url
+// encoding of the content, with hash as the digest function of the algorithm.
+//
+//	digest := crypto.SHA256.New()
+//	digest.Write(signature[:bytes.IndexByte(signature, '.')+1])
+//	enc := base64.NewEncoder(base64.RawURLEncoding, digest)
+//	io.Copy(enc, content)
+//	enc.Close()
+//	header, err := keys.VerifyDigest(signature, crypto.SHA256, digest.Sum(nil))
+//
+// Only ECDSA, RSA, and registered algorithms with a Hash apply. HMAC and EdDSA
+// get an error, as both need the signing input as a whole. The policies of the
+// register apply as they do with Check.
+func (keys *KeyRegister) VerifyDigest(signature []byte, hash crypto.Hash, sum []byte) (*Header, error) {
+	header, err := PeekHeader(signature)
+	if err != nil {
+		return nil, err
+	}
+	firstDot := bytes.IndexByte(signature, '.')
+	lastDot := bytes.LastIndexByte(signature, '.')
+	if lastDot != firstDot+1 {
+		return nil, errors.New("jwt: signature not a detached JWS")
+	}
+	if header.Crit != nil {
+		if len(header.Crit) == 0 {
+			return nil, errCritEmpty
+		}
+		raw := make([]byte, encoding.DecodedLen(firstDot))
+		n, _ := decode(raw, signature[:firstDot]) // PeekHeader did it before
+		if err := EvalCrit(signature, header.Crit, raw[:n]); err != nil {
+			return nil, err
+		}
+	}
+	if !keys.AcceptContentType(header.ContentType) {
+		return nil, ContentTypeError(header.ContentType)
+	}
+
+	sig := make([]byte, encoding.DecodedLen(len(signature)-(lastDot+1)))
+	n, err := decode(sig, signature[lastDot+1:])
+	if err != nil {
+		return nil, fmt.Errorf("jwt: malformed signature: %w", err)
+	}
+	sig = sig[:n]
+
+	alg := header.Alg
+	if _, ok := HMACAlgs[alg]; ok || alg == EdDSA {
+		return nil, errDigestAlg
+	}
+	want, err := digestHash(alg)
+	if err != nil {
+		return nil, err
+	}
+	if hash != want || len(sum) != hash.Size() {
+		return nil, fmt.Errorf("jwt: %s needs a digest of %v", alg, want)
+	}
+
+	if err := keys.verifySig(alg, header.KeyID, nil, sum, sig, nil); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// DigestHash returns the hash function of a digest-based algorithm.
+func digestHash(alg string) (crypto.Hash, error) {
+	if _, ok := RSAAlgs[alg]; ok {
+		return hashLookup(alg, RSAAlgs)
+	}
+	if _, ok := ECDSAAlgs[alg]; ok {
+		return hashLookup(alg, ECDSAAlgs)
+	}
+	a, err := algLookup(alg)
+	if err != nil {
+		return 0, err
+	}
+	if a.Hash() == 0 {
+		return 0, errDigestAlg
+	}
+	return a.Hash(), nil
+}
@@ -0,0 +1,112 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// DetachedSum returns the digest of the signing input for content.
+func detachedSum(hash crypto.Hash, signature, content []byte) []byte {
+	digest := hash.New()
+	digest.Write(signature[:bytes.IndexByte(signature, '.')+1])
+	enc := base64.NewEncoder(base64.RawURLEncoding, digest)
+	enc.Write(content)
+	enc.Close()
+	return digest.Sum(nil)
+}
+
+// Detach removes the payload from a token.
+func detach(token []byte) []byte {
+	firstDot := bytes.IndexByte(token, '.')
+	lastDot := bytes.LastIndexByte(token, '.')
+	return append(token[:firstDot+1:firstDot+1], token[lastDot:]...)
+}
+
+func TestVerifyDigest(t *testing.T) {
+	content := bytes.Repeat([]byte("large payload "), 1e5)
+	keys := &KeyRegister{
+		ECDSAs:   []*ecdsa.PublicKey{&testKeyEC384.PublicKey, &testKeyEC256.PublicKey},
+		RSAs:     []*rsa.PublicKey{&testKeyRSA2048.PublicKey},
+		ECDSAIDs: []string{"", "ec256"},
+	}
+
+	golden := []struct {
+		alg  string
+		key  crypto.PrivateKey
+		hash crypto.Hash
+	}{
+		{ES256, testKeyEC256, crypto.SHA256},
+		{ES384, testKeyEC384, crypto.SHA384},
+		{RS256, testKeyRSA2048, crypto.SHA256},
+		{PS512, testKeyRSA2048, crypto.SHA512},
+	}
+	for _, gold := range golden {
+		var extraHeaders []json.RawMessage
+		if gold.alg == ES256 {
+			extraHeaders = append(extraHeaders, json.RawMessage(`{"kid":"ec256"}`))
+		}
+		token, err := SignBytes(content, gold.alg, gold.key, extraHeaders...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature := detach(token)
+
+		header, err := keys.VerifyDigest(signature, gold.hash, detachedSum(gold.hash, signature, content))
+		if err != nil {
+			t.Errorf("%s: verify error: %s", gold.alg, err)
+			continue
+		}
+		if header.Alg != gold.alg {
+			t.Errorf("%s: got header alg %q", gold.alg, header.Alg)
+		}
+
+		tampered := append(content[:len(content):len(content)], '!')
+		if _, err := keys.VerifyDigest(signature, gold.hash, detachedSum(gold.hash, signature, tampered)); err != ErrSigMiss {
+			t.Errorf("%s: got error %v for tampered content, want %v", gold.alg, err, ErrSigMiss)
+		}
+
+		// register policies apply
+		keys.DetailedMiss = true
+		_, err = keys.VerifyDigest(signature, gold.hash, detachedSum(gold.hash, signature, tampered))
+		keys.DetailedMiss = false
+		var miss *MissError
+		if !errors.As(err, &miss) || miss.Alg != gold.alg {
+			t.Errorf("%s: got error %v with DetailedMiss, want a MissError", gold.alg, err)
+		}
+	}
+}
+
+func TestVerifyDigestErrors(t *testing.T) {
+	keys := &KeyRegister{
+		ECDSAs:  []*ecdsa.PublicKey{&testKeyEC256.PublicKey},
+		Secrets: [][]byte{[]byte("guest")},
+	}
+	content := []byte("content")
+
+	token, err := SignBytes(content, ES256, testKeyEC256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.VerifyDigest(token, crypto.SHA256, detachedSum(crypto.SHA256, token, content)); err == nil {
+		t.Error("no error for attached content")
+	}
+	signature := detach(token)
+	if _, err := keys.VerifyDigest(signature, crypto.SHA512, detachedSum(crypto.SHA512, signature, content)); err == nil {
+		t.Error("no error for hash mismatch")
+	}
+
+	token, err = SignBytes(content, HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature = detach(token)
+	if _, err := keys.VerifyDigest(signature, crypto.SHA256, detachedSum(crypto.SHA256, signature, content)); !errors.Is(err, errDigestAlg) {
+		t.Errorf("HMAC got error %v, want %v", err, errDigestAlg)
+	}
+}
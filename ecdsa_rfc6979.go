@@ -0,0 +1,33 @@
+//go:build go1.24
+
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"math/big"
+)
+
+// EcdsaSignDeterministic returns the signature of a message digest with the
+// nonce generation from RFC 6979. The standard library signs in constant time
+// without a random source, as of Go 1.24, for the NIST curves.
+func ecdsaSignDeterministic(key *ecdsa.PrivateKey, hash crypto.Hash, digest []byte) (r, s *big.Int, err error) {
+	switch key.Curve {
+	case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		break
+	default:
+		return ecdsaSignRFC6979(key, hash, digest)
+	}
+
+	der, err := key.Sign(nil, digest, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, nil, err
+	}
+	return sig.R, sig.S, nil
+}
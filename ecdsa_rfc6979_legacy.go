@@ -0,0 +1,15 @@
+//go:build !go1.24
+
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"math/big"
+)
+
+// EcdsaSignDeterministic returns the signature of a message digest with the
+// nonce generation from RFC 6979, in variable time. See DeterministicECDSA.
+func ecdsaSignDeterministic(key *ecdsa.PrivateKey, hash crypto.Hash, digest []byte) (r, s *big.Int, err error) {
+	return ecdsaSignRFC6979(key, hash, digest)
+}
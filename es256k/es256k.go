@@ -0,0 +1,111 @@
+// Package es256k provides ES256K, i.e., ECDSA using secp256k1 and SHA-256, as
+// per “CBOR Object Signing and Encryption (COSE) and JSON Object Signing and
+// Encryption (JOSE) Registrations for Web Authentication (WebAuthn)
+// Algorithms” RFC 8812. Importing the package registers the algorithm with
+// jwt.RegisterAlg.
+//
+// Sign with jwt.Claims.Sign, using a *secp256k1.PrivateKey. Verify with
+// jwt.KeyRegister.Check, using *secp256k1.PublicKey entries in Others. Use
+// jwt.KeyRegister.LoadJWK for keys with "EC" as the type and "secp256k1" as
+// the curve.
+package es256k
+
+import (
+	"crypto"
+	_ "crypto/sha256" // link into binary
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/pascaldekloe/jwt"
+)
+
+// ES256K is the algorithm identifier, a.k.a. "alg".
+const ES256K = "ES256K"
+
+func init() {
+	jwt.RegisterAlg(alg{})
+}
+
+// Alg implements jwt.Alg and jwt.JWKDecoder.
+type alg struct{}
+
+// Name implements the jwt.Alg interface.
+func (alg) Name() string { return ES256K }
+
+// Hash implements the jwt.Alg interface.
+func (alg) Hash() crypto.Hash { return crypto.SHA256 }
+
+// Sign implements the jwt.Alg interface. The signature contains the pair
+// (r, s) in fixed width, as per RFC 7518, subsection 3.4.
+func (alg) Sign(key crypto.PrivateKey, digest []byte) ([]byte, error) {
+	priv, ok := key.(*secp256k1.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("jwt: ES256K with unsupported key type %T", key)
+	}
+	sig := ecdsa.Sign(priv, digest)
+	r, s := sig.R(), sig.S()
+
+	var buf [64]byte
+	r.PutBytesUnchecked(buf[:32])
+	s.PutBytesUnchecked(buf[32:])
+	return buf[:], nil
+}
+
+// Verify implements the jwt.Alg interface.
+func (alg) Verify(key crypto.PublicKey, digest, sig []byte) error {
+	pub, ok := key.(*secp256k1.PublicKey)
+	if !ok {
+		return fmt.Errorf("jwt: ES256K with unsupported key type %T", key)
+	}
+	if len(sig) != 64 {
+		return jwt.ErrSigMiss
+	}
+
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(sig[:32]) || s.SetByteSlice(sig[32:]) || r.IsZero() || s.IsZero() {
+		return jwt.ErrSigMiss // out of range
+	}
+	if !ecdsa.NewSignature(&r, &s).Verify(digest, pub) {
+		return jwt.ErrSigMiss
+	}
+	return nil
+}
+
+var errJWKParam = errors.New("jwt: ES256K JWK missing or malformed coordinate")
+
+// DecodeJWK implements the jwt.JWKDecoder interface.
+func (alg) DecodeJWK(data json.RawMessage) (crypto.PublicKey, error) {
+	var j struct {
+		Kty, Crv, X, Y string
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	if j.Kty != "EC" || j.Crv != "secp256k1" {
+		return nil, nil // not applicable
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(j.X)
+	if err != nil || len(x) != 32 {
+		return nil, errJWKParam
+	}
+	y, err := base64.RawURLEncoding.DecodeString(j.Y)
+	if err != nil || len(y) != 32 {
+		return nil, errJWKParam
+	}
+
+	// uncompressed SEC 1 encoding
+	serial := make([]byte, 1, 65)
+	serial[0] = 4
+	serial = append(serial, x...)
+	serial = append(serial, y...)
+	key, err := secp256k1.ParsePubKey(serial)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: ES256K JWK: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,105 @@
+package es256k
+
+import (
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/pascaldekloe/jwt"
+)
+
+func TestSignCheck(t *testing.T) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := jwt.Claims{KeyID: "k1"}
+	c.Issuer = "did:ethr:0x06"
+	token, err := c.Sign(ES256K, key)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+
+	keys := jwt.KeyRegister{Others: []crypto.PublicKey{key.PubKey()}}
+	got, err := keys.Check(token)
+	if err != nil {
+		t.Fatalf("%q check error: %s", token, err)
+	}
+	if got.Issuer != c.Issuer {
+		t.Errorf("got issuer %q, want %q", got.Issuer, c.Issuer)
+	}
+
+	other, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.Others[0] = other.PubKey()
+	if _, err := keys.Check(token); err != jwt.ErrSigMiss {
+		t.Errorf("got error %v for other key, want %v", err, jwt.ErrSigMiss)
+	}
+}
+
+func TestLoadJWK(t *testing.T) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := key.PubKey().SerializeUncompressed()
+	jwk := fmt.Sprintf(`{"kty": "EC", "crv": "secp256k1", "kid": "k1", "x": %q, "y": %q}`,
+		base64.RawURLEncoding.EncodeToString(serial[1:33]),
+		base64.RawURLEncoding.EncodeToString(serial[33:]))
+
+	var keys jwt.KeyRegister
+	if n, err := keys.LoadJWK([]byte(jwk)); n != 1 || err != nil {
+		t.Fatalf("got (%d, %v), want (1, nil)", n, err)
+	}
+	if len(keys.OtherIDs) != 1 || keys.OtherIDs[0] != "k1" {
+		t.Errorf("got key IDs %q, want k1", keys.OtherIDs)
+	}
+
+	token, err := (&jwt.Claims{KeyID: "k1"}).Sign(ES256K, key)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := keys.Check(token); err != nil {
+		t.Errorf("%q check error: %s", token, err)
+	}
+
+	// off curve
+	bad := fmt.Sprintf(`{"kty": "EC", "crv": "secp256k1", "x": %q, "y": %q}`,
+		base64.RawURLEncoding.EncodeToString(serial[1:33]),
+		base64.RawURLEncoding.EncodeToString(serial[1:33]))
+	if n, err := keys.LoadJWK([]byte(bad)); n != 0 || err == nil {
+		t.Errorf("got (%d, %v) for point off curve, want error", n, err)
+	}
+}
+
+func TestAttest(t *testing.T) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := jwt.KeyRegister{
+		Others:   []crypto.PublicKey{key.PubKey()},
+		OtherIDs: []string{"k1"},
+	}
+	token, err := keys.Attest(nil, ES256K, key)
+	if err != nil {
+		t.Fatal("attest error:", err)
+	}
+	c, err := keys.Check(token)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	got, err := c.AttestedKeys()
+	if err != nil {
+		t.Fatal("attested keys error:", err)
+	}
+	want := jwt.AttestedKey{Field: "Others", KeyID: "k1"}
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("got inventory %+v, want [%+v]", got, want)
+	}
+}
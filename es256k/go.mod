@@ -0,0 +1,8 @@
+module github.com/pascaldekloe/jwt/es256k
+
+go 1.17
+
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.4.1
+	github.com/pascaldekloe/jwt v1.13.0
+)
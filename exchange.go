@@ -0,0 +1,242 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Token type identifiers from RFC 8693, subsection 3. See OAuthURN for JWTs.
+const (
+	TokenTypeAccessToken  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	TokenTypeIDToken      = "urn:ietf:params:oauth:token-type:id_token"
+)
+
+// GrantTypeTokenExchange is the grant type of RFC 8693, subsection 2.1.
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// TokenExchange is a client for an OAuth 2.0 token endpoint with support for
+// RFC 8693, “OAuth 2.0 Token Exchange”.
+type TokenExchange struct {
+	// Endpoint is the URL of the token endpoint.
+	Endpoint string
+
+	// ClientID and ClientSecret authenticate with HTTP Basic when the
+	// ClientID is not empty.
+	ClientID, ClientSecret string
+
+	// Client performs the requests. Nil defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// ExchangeRequest has the parameters of RFC 8693, subsection 2.1. The token
+// types default to OAuthURN (JWT) when empty.
+type ExchangeRequest struct {
+	SubjectToken     string // required
+	SubjectTokenType string
+
+	// Delegation with an actor. Absence of the actor token requests
+	// impersonation.
+	ActorToken     string
+	ActorTokenType string
+
+	Resource           []string // target service locations
+	Audience           []string // logical names of target services
+	Scope              string   // space-delimited
+	RequestedTokenType string   // optional
+}
+
+// ExchangeResponse has the parameters of RFC 8693, subsection 2.2.1.
+type ExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+}
+
+// ExchangeError is an error response from RFC 6749, subsection 5.2.
+type ExchangeError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	URI         string `json:"error_uri"`
+}
+
+// Error honors the error interface.
+func (e *ExchangeError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("jwt: token exchange error %q", e.Code)
+	}
+	return fmt.Sprintf("jwt: token exchange error %q: %s", e.Code, e.Description)
+}
+
+// Exchange requests a security token from the token endpoint. Errors from the
+// token endpoint get an *ExchangeError.
+func (x *TokenExchange) Exchange(ctx context.Context, r *ExchangeRequest) (*ExchangeResponse, error) {
+	if r.SubjectToken == "" {
+		return nil, errors.New("jwt: token exchange without subject token")
+	}
+
+	form := url.Values{
+		"grant_type":         {GrantTypeTokenExchange},
+		"subject_token":      {r.SubjectToken},
+		"subject_token_type": {tokenTypeOrJWT(r.SubjectTokenType)},
+	}
+	if r.ActorToken != "" {
+		form.Set("actor_token", r.ActorToken)
+		form.Set("actor_token_type", tokenTypeOrJWT(r.ActorTokenType))
+	}
+	for _, s := range r.Resource {
+		form.Add("resource", s)
+	}
+	for _, s := range r.Audience {
+		form.Add("audience", s)
+	}
+	if r.Scope != "" {
+		form.Set("scope", r.Scope)
+	}
+	if r.RequestedTokenType != "" {
+		form.Set("requested_token_type", r.RequestedTokenType)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, x.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if x.ClientID != "" {
+		// RFC 6749, subsection 2.3.1 requires form encoding first
+		req.SetBasicAuth(url.QueryEscape(x.ClientID), url.QueryEscape(x.ClientSecret))
+	}
+
+	client := x.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		e := new(ExchangeError)
+		if err := json.Unmarshal(body, e); err != nil || e.Code == "" {
+			return nil, fmt.Errorf("jwt: token exchange got HTTP status %q", resp.Status)
+		}
+		return nil, e
+	}
+	result := new(ExchangeResponse)
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf("jwt: malformed token exchange response: %w", err)
+	}
+	if result.AccessToken == "" {
+		return nil, errors.New("jwt: token exchange response without access token")
+	}
+	return result, nil
+}
+
+func tokenTypeOrJWT(s string) string {
+	if s == "" {
+		return OAuthURN
+	}
+	return s
+}
+
+// Actor is a party from the "act" claim, i.e., the one which acts on behalf of
+// the subject. See RFC 8693, subsection 4.1.
+type Actor struct {
+	Subject string // "sub" claim, if any
+	Issuer  string // "iss" claim, if any
+
+	// Set has all claims of the actor, with exception of any "act".
+	Set map[string]interface{}
+}
+
+var errActMalformed = errors.New("jwt: act claim not a JSON object")
+
+// Actors returns the delegation chain from the "act" claim, with the current
+// actor first, followed by the prior actors, if any. The return is empty for
+// tokens without delegation.
+//
+// “For the purpose of applying access control policy, the consumer of a token
+// MUST only consider the token's top-level claims and the party identified as
+// the current actor by the act claim. Prior actors identified by any nested
+// act claims are informational only” — RFC 8693, subsection 4.1
+func (c *Claims) Actors() ([]Actor, error) {
+	var chain []Actor
+	v, ok := c.Set["act"]
+	for ok {
+		m, isObject := v.(map[string]interface{})
+		if !isObject {
+			return nil, errActMalformed
+		}
+		a := Actor{Set: make(map[string]interface{}, len(m))}
+		for name, value := range m {
+			if name != "act" {
+				a.Set[name] = value
+			}
+		}
+		a.Subject, _ = m[subject].(string)
+		a.Issuer, _ = m[issuer].(string)
+		chain = append(chain, a)
+
+		v, ok = m["act"]
+	}
+	return chain, nil
+}
+
+// Actor returns the current actor from the "act" claim, i.e., the first of
+// Actors, or nil for tokens without delegation.
+func (c *Claims) Actor() (*Actor, error) {
+	chain, err := c.Actors()
+	if err != nil || len(chain) == 0 {
+		return nil, err
+	}
+	return &chain[0], nil
+}
+
+// ErrDelegationDepth means the "act" claim has more actors than permitted.
+var ErrDelegationDepth = errors.New("jwt: delegation chain exceeds maximum depth")
+
+// CheckDelegation returns an error wrapping ErrDelegationDepth when the chain
+// from Actors has more than maxDepth actors. Zero permits no delegation at all.
+func (c *Claims) CheckDelegation(maxDepth int) error {
+	chain, err := c.Actors()
+	if err != nil {
+		return err
+	}
+	if len(chain) > maxDepth {
+		return fmt.Errorf("%w: %d actors, with a maximum of %d", ErrDelegationDepth, len(chain), maxDepth)
+	}
+	return nil
+}
+
+// MayAct returns whether the "may_act" claim authorizes the party to act on
+// behalf of the subject. Each of the "sub" and the "iss" in the claim, when
+// present, must match, and at least one of them must be present. See RFC 8693,
+// subsection 4.4.
+func (c *Claims) MayAct(subjectName, issuerName string) bool {
+	m, ok := c.Set["may_act"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	sub, hasSub := m[subject].(string)
+	iss, hasIss := m[issuer].(string)
+	return (hasSub || hasIss) &&
+		(!hasSub || sub == subjectName) &&
+		(!hasIss || iss == issuerName)
+}
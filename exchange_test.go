@@ -0,0 +1,152 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTokenExchange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error("form error:", err)
+		}
+		for name, want := range map[string][]string{
+			"grant_type":         {GrantTypeTokenExchange},
+			"subject_token":      {"subject.token"},
+			"subject_token_type": {OAuthURN},
+			"actor_token":        {"actor.token"},
+			"actor_token_type":   {TokenTypeAccessToken},
+			"audience":           {"a1", "a2"},
+			"scope":              {"read"},
+		} {
+			if got := r.PostForm[name]; !reflect.DeepEqual(got, want) {
+				t.Errorf("got form %s %q, want %q", name, got, want)
+			}
+		}
+		if r.PostForm.Get("subject_token") == "" {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"issued.token","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"N_A","expires_in":60}`))
+	}))
+	defer srv.Close()
+
+	x := &TokenExchange{Endpoint: srv.URL, ClientID: "client", ClientSecret: "s3cr3t"}
+	resp, err := x.Exchange(context.Background(), &ExchangeRequest{
+		SubjectToken:   "subject.token",
+		ActorToken:     "actor.token",
+		ActorTokenType: TokenTypeAccessToken,
+		Audience:       []string{"a1", "a2"},
+		Scope:          "read",
+	})
+	if err != nil {
+		t.Fatal("exchange error:", err)
+	}
+	want := &ExchangeResponse{AccessToken: "issued.token", IssuedTokenType: TokenTypeAccessToken, TokenType: "N_A", ExpiresIn: 60}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, want %+v", resp, want)
+	}
+
+	x.ClientSecret = "guest"
+	_, err = x.Exchange(context.Background(), &ExchangeRequest{SubjectToken: "subject.token"})
+	if e, ok := err.(*ExchangeError); !ok || e.Code != "invalid_client" {
+		t.Errorf("got error %v, want invalid_client", err)
+	}
+}
+
+func TestActors(t *testing.T) {
+	var c Claims
+	err := json.Unmarshal([]byte(`{"sub":"user@example.com","act":{"sub":"admin@example.com","act":{"sub":"consumer.example.com","iss":"https://issuer.example.net"}}}`), &c.Set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := c.Actors()
+	if err != nil {
+		t.Fatal("actors error:", err)
+	}
+	want := []Actor{
+		{Subject: "admin@example.com", Set: map[string]interface{}{"sub": "admin@example.com"}},
+		{Subject: "consumer.example.com", Issuer: "https://issuer.example.net", Set: map[string]interface{}{"sub": "consumer.example.com", "iss": "https://issuer.example.net"}},
+	}
+	if !reflect.DeepEqual(chain, want) {
+		t.Errorf("got %+v, want %+v", chain, want)
+	}
+
+	c.Set = map[string]interface{}{"act": "admin"}
+	if _, err := c.Actors(); err != errActMalformed {
+		t.Errorf("got error %v, want %v", err, errActMalformed)
+	}
+	c.Set = nil
+	if chain, err := c.Actors(); err != nil || len(chain) != 0 {
+		t.Errorf("got %+v, %v without act claim", chain, err)
+	}
+}
+
+func TestActor(t *testing.T) {
+	var c Claims
+	if a, err := c.Actor(); err != nil || a != nil {
+		t.Errorf("got %+v, %v without act claim", a, err)
+	}
+	if err := c.CheckDelegation(0); err != nil {
+		t.Error("got delegation error without act claim:", err)
+	}
+
+	err := json.Unmarshal([]byte(`{"sub":"user@example.com","act":{"sub":"admin@example.com","act":{"sub":"consumer.example.com"}}}`), &c.Set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := c.Actor()
+	if err != nil {
+		t.Fatal("actor error:", err)
+	}
+	if a == nil || a.Subject != "admin@example.com" {
+		t.Errorf("got actor %+v, want admin@example.com", a)
+	}
+	if err := c.CheckDelegation(2); err != nil {
+		t.Error("got delegation error within maximum depth:", err)
+	}
+	if err := c.CheckDelegation(1); !errors.Is(err, ErrDelegationDepth) {
+		t.Errorf("got error %v, want %v", err, ErrDelegationDepth)
+	}
+
+	c.Set = map[string]interface{}{"act": "admin"}
+	if _, err := c.Actor(); err != errActMalformed {
+		t.Errorf("got error %v, want %v", err, errActMalformed)
+	}
+	if err := c.CheckDelegation(1); err != errActMalformed {
+		t.Errorf("got delegation error %v, want %v", err, errActMalformed)
+	}
+}
+
+func TestMayAct(t *testing.T) {
+	c := Claims{Set: map[string]interface{}{
+		"may_act": map[string]interface{}{"sub": "admin@example.com", "iss": "https://issuer.example.net"},
+	}}
+	if !c.MayAct("admin@example.com", "https://issuer.example.net") {
+		t.Error("authorized actor denied")
+	}
+	if c.MayAct("admin@example.com", "https://other.example.net") {
+		t.Error("actor from other issuer authorized")
+	}
+	if c.MayAct("intruder@example.com", "https://issuer.example.net") {
+		t.Error("other actor authorized")
+	}
+	c.Set["may_act"] = map[string]interface{}{}
+	if c.MayAct("", "") {
+		t.Error("empty may_act authorized")
+	}
+	delete(c.Set, "may_act")
+	if c.MayAct("admin@example.com", "") {
+		t.Error("absent may_act authorized")
+	}
+}
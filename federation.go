@@ -0,0 +1,123 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Media types from OpenID Federation 1.0.
+const (
+	EntityStatementType = "entity-statement+jwt"
+	SignedJWKSType      = "jwk-set+jwt"
+)
+
+var (
+	errTrustChainEmpty = errors.New("jwt: empty trust chain")
+	errTrustChainLeaf  = errors.New("jwt: trust chain leaf is not an entity configuration")
+	errNoJWKSClaim     = errors.New("jwt: entity statement without jwks claim")
+	errNoKeysClaim     = errors.New("jwt: signed JWK Set without keys claim")
+)
+
+// TypeError signals a "typ" header other than the media type expected.
+type TypeError string
+
+// Error honors the error interface.
+func (e TypeError) Error() string {
+	return fmt.Sprintf("jwt: token type %q not accepted", string(e))
+}
+
+// TrustChain verifies a chain of OpenID Federation entity statements, and it
+// returns the federation keys of the subject on success. The chain starts with
+// the entity configuration of the subject, i.e., the statement it issued about
+// itself, and each statement thereafter is issued by the superior of the one
+// before. The last statement must be signed by one of the anchors, and all of
+// them must be valid at the time given. No metadata policy is applied.
+//
+// “A Trust Chain is a sequence of Entity Statements that represents a chain
+// starting at a Leaf Entity and ending in a Trust Anchor.”
+// — OpenID Federation 1.0, section 4
+func TrustChain(chain [][]byte, anchors *KeyRegister, now time.Time) (*KeyRegister, error) {
+	if len(chain) == 0 {
+		return nil, errTrustChainEmpty
+	}
+
+	keys := anchors
+	var superior *Claims
+	for i := len(chain) - 1; i >= 0; i-- {
+		c, err := checkTyped(chain[i], keys, EntityStatementType, now)
+		if err != nil {
+			return nil, fmt.Errorf("%w (trust chain statement %d)", err, i)
+		}
+		if superior != nil && superior.Subject != c.Issuer {
+			return nil, fmt.Errorf("jwt: trust chain statement %d issued by %q, want %q", i, c.Issuer, superior.Subject)
+		}
+		keys, err = entityKeys(c)
+		if err != nil {
+			return nil, fmt.Errorf("%w (trust chain statement %d)", err, i)
+		}
+		superior = c
+	}
+
+	// the entity configuration must be self-signed too
+	if superior.Issuer != superior.Subject {
+		return nil, errTrustChainLeaf
+	}
+	if _, err := checkTyped(chain[0], keys, EntityStatementType, now); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// EntityKeys returns the "jwks" claim of an entity statement.
+func entityKeys(c *Claims) (*KeyRegister, error) {
+	jwks, ok := c.Set["jwks"]
+	if !ok {
+		return nil, errNoJWKSClaim
+	}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		return nil, err
+	}
+	keys := new(KeyRegister)
+	if _, err := keys.LoadJWK(data); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// CheckTyped returns the claims of a token with the "typ" header, which must be
+// valid at the time given, with an expiry.
+func checkTyped(token []byte, keys *KeyRegister, typ string, now time.Time) (*Claims, error) {
+	c, err := keys.Check(token)
+	if err != nil {
+		return nil, err
+	}
+	header, err := PeekHeader(token)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(mediaType(header.Type), mediaType(typ)) {
+		return nil, TypeError(header.Type)
+	}
+	if c.Expires == nil || !c.Valid(now) {
+		return nil, errTimeConstraints
+	}
+	return c, nil
+}
+
+// SignedJWKS returns the JWK Set from a signed JWK Set, as served from the
+// signed_jwks_uri of OpenID Federation 1.0, subsection 5.2.1.
+func signedJWKS(token []byte, signers *KeyRegister, now time.Time) ([]byte, error) {
+	c, err := checkTyped(token, signers, SignedJWKSType, now)
+	if err != nil {
+		return nil, err
+	}
+	keys, ok := c.Set["keys"]
+	if !ok {
+		return nil, errNoKeysClaim
+	}
+	return json.Marshal(map[string]interface{}{"keys": keys})
+}
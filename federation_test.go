@@ -0,0 +1,153 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newFederationKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public, private
+}
+
+func federationJWKS(keys ...ed25519.PublicKey) map[string]interface{} {
+	var set []interface{}
+	for _, k := range keys {
+		set = append(set, map[string]interface{}{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(k),
+		})
+	}
+	return map[string]interface{}{"keys": set}
+}
+
+// EntityStatement returns a signed statement by iss about sub.
+func entityStatement(t *testing.T, iss, sub string, jwks ed25519.PublicKey, key ed25519.PrivateKey, expires time.Time) []byte {
+	t.Helper()
+	var c Claims
+	c.Issuer = iss
+	c.Subject = sub
+	c.Issued = NewNumericTime(expires.Add(-time.Hour))
+	c.Expires = NewNumericTime(expires)
+	c.Set = map[string]interface{}{"jwks": federationJWKS(jwks)}
+	token, err := c.EdDSASign(key, []byte(`{"typ":"entity-statement+jwt"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestTrustChain(t *testing.T) {
+	leafPub, leafKey := newFederationKey(t)
+	iaPub, iaKey := newFederationKey(t)
+	taPub, taKey := newFederationKey(t)
+	anchors := &KeyRegister{EdDSAs: []ed25519.PublicKey{taPub}}
+	now := time.Now()
+	exp := now.Add(time.Hour)
+
+	chain := [][]byte{
+		entityStatement(t, "https://rp.example.com", "https://rp.example.com", leafPub, leafKey, exp),
+		entityStatement(t, "https://ia.example.com", "https://rp.example.com", leafPub, iaKey, exp),
+		entityStatement(t, "https://ta.example.com", "https://ia.example.com", iaPub, taKey, exp),
+	}
+	keys, err := TrustChain(chain, anchors, now)
+	if err != nil {
+		t.Fatal("trust chain error:", err)
+	}
+	if want := []ed25519.PublicKey{leafPub}; !reflect.DeepEqual(keys.EdDSAs, want) {
+		t.Errorf("got EdDSA keys %x, want %x", keys.EdDSAs, want)
+	}
+
+	// leaf directly under trust anchor
+	if _, err := TrustChain(chain[:1], &KeyRegister{EdDSAs: []ed25519.PublicKey{leafPub}}, now); err != nil {
+		t.Error("single statement error:", err)
+	}
+
+	if _, err := TrustChain(nil, anchors, now); err != errTrustChainEmpty {
+		t.Errorf("got error %v for an empty chain, want %v", err, errTrustChainEmpty)
+	}
+	if _, err := TrustChain(chain[:2], anchors, now); !errors.Is(err, ErrSigMiss) {
+		t.Errorf("got error %v without trust anchor statement, want %v", err, ErrSigMiss)
+	}
+	if _, err := TrustChain(chain, anchors, exp.Add(time.Second)); !errors.Is(err, errTimeConstraints) {
+		t.Errorf("got error %v for expired chain, want %v", err, errTimeConstraints)
+	}
+
+	wrongSubject := [][]byte{chain[0], chain[1],
+		entityStatement(t, "https://ta.example.com", "https://other.example.com", iaPub, taKey, exp),
+	}
+	if _, err := TrustChain(wrongSubject, anchors, now); err == nil {
+		t.Error("no error for a subject mismatch")
+	}
+
+	notSelfIssued := [][]byte{
+		entityStatement(t, "https://ia.example.com", "https://rp.example.com", leafPub, iaKey, exp),
+		chain[2],
+	}
+	if _, err := TrustChain(notSelfIssued, anchors, now); err != errTrustChainLeaf {
+		t.Errorf("got error %v without entity configuration, want %v", err, errTrustChainLeaf)
+	}
+
+	var untyped Claims
+	untyped.Issuer = "https://ta.example.com"
+	untyped.Subject = "https://ia.example.com"
+	untyped.Expires = NewNumericTime(exp)
+	untyped.Set = map[string]interface{}{"jwks": federationJWKS(iaPub)}
+	token, err := untyped.EdDSASign(taKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TrustChain([][]byte{chain[0], chain[1], token}, anchors, now); !errors.Is(err, TypeError("")) {
+		t.Errorf("got error %v without type, want %v", err, TypeError(""))
+	}
+}
+
+func TestRemoteJWKSSigners(t *testing.T) {
+	signerPub, signerKey := newFederationKey(t)
+
+	var jwks Claims
+	jwks.Issuer = "https://rp.example.com"
+	jwks.Expires = NewNumericTime(time.Now().Add(time.Hour))
+	jwks.Set = map[string]interface{}{
+		"keys": []interface{}{map[string]interface{}{
+			"kty": "oct",
+			"kid": "a",
+			"k":   base64.RawURLEncoding.EncodeToString([]byte("secret a")),
+		}},
+	}
+	signed, err := jwks.EdDSASign(signerKey, []byte(`{"typ":"jwk-set+jwt"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept"); got != "application/jwk-set+jwt" {
+			t.Errorf("got Accept %q, want application/jwk-set+jwt", got)
+		}
+		w.Header().Set("Content-Type", "application/jwk-set+jwt")
+		w.Write(signed)
+	}))
+	defer srv.Close()
+
+	j := &RemoteJWKS{URL: srv.URL, Signers: &KeyRegister{EdDSAs: []ed25519.PublicKey{signerPub}}}
+	if _, err := j.Check(jwksToken(t, "a")); err != nil {
+		t.Error("check error:", err)
+	}
+
+	otherPub, _ := newFederationKey(t)
+	j = &RemoteJWKS{URL: srv.URL, Signers: &KeyRegister{EdDSAs: []ed25519.PublicKey{otherPub}}}
+	if _, err := j.Check(jwksToken(t, "a")); err != ErrSigMiss {
+		t.Errorf("got error %v for untrusted signer, want %v", err, ErrSigMiss)
+	}
+}
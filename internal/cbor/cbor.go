@@ -0,0 +1,359 @@
+// Package cbor provides the subset of “Concise Binary Object Representation
+// (CBOR)” RFC 8949 in use for COSE and CWT.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CBOR major types from RFC 8949, subsection 3.1.
+const (
+	MajorUint = iota
+	MajorNegInt
+	MajorBytes
+	MajorText
+	MajorArray
+	MajorMap
+	MajorTag
+	MajorSimple
+)
+
+// MaxDepth limits the nesting of arrays and maps on decoding.
+const MaxDepth = 32
+
+// ErrTruncated signals an incomplete data item.
+var ErrTruncated = errors.New("cbor: data truncated")
+
+// Decoder reads a subset of CBOR, conform the core deterministic encoding
+// requirements of RFC 8949, subsection 4.2.1, with the exception of the map
+// key order. Indefinite lengths are rejected.
+type Decoder struct {
+	Data    []byte
+	depth   int
+	argSize int // number of bytes for the argument of the last head
+}
+
+// Head reads the initial byte with its argument.
+func (d *Decoder) Head() (major byte, arg uint64, err error) {
+	if len(d.Data) == 0 {
+		return 0, 0, ErrTruncated
+	}
+	major, info := d.Data[0]>>5, d.Data[0]&31
+	d.Data = d.Data[1:]
+
+	var n int
+	switch {
+	case info < 24:
+		d.argSize = 0
+		return major, uint64(info), nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	case info == 31:
+		return 0, 0, errors.New("cbor: indefinite length not supported")
+	default:
+		return 0, 0, fmt.Errorf("cbor: additional information %d reserved", info)
+	}
+	if len(d.Data) < n {
+		return 0, 0, ErrTruncated
+	}
+	for _, b := range d.Data[:n] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.Data = d.Data[n:]
+	d.argSize = n
+	return major, arg, nil
+}
+
+// Bytes reads the content of a string with the length argument.
+func (d *Decoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.Data)) {
+		return nil, ErrTruncated
+	}
+	b := d.Data[:n:n]
+	d.Data = d.Data[n:]
+	return b, nil
+}
+
+// Value reads the next data item. Integers decode as int64, floating-points
+// as float64, byte strings as []byte, text strings as string, arrays as
+// []interface{}, and maps as map[interface{}]interface{}, in which the keys
+// are either an int64 or a string. Tags are dropped from the content.
+func (d *Decoder) Value() (interface{}, error) {
+	major, arg, err := d.Head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case MajorUint:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("cbor: integer exceeds 64-bit range")
+		}
+		return int64(arg), nil
+	case MajorNegInt:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("cbor: integer exceeds 64-bit range")
+		}
+		return -1 - int64(arg), nil
+	case MajorBytes:
+		return d.bytes(arg)
+	case MajorText:
+		b, err := d.bytes(arg)
+		return string(b), err
+	case MajorArray:
+		if arg > uint64(len(d.Data)) {
+			return nil, ErrTruncated // one byte per item minimum
+		}
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		a := make([]interface{}, arg)
+		for i := range a {
+			a[i], err = d.Value()
+			if err != nil {
+				return nil, err
+			}
+		}
+		d.depth--
+		return a, nil
+	case MajorMap:
+		if arg > uint64(len(d.Data))/2 {
+			return nil, ErrTruncated // two bytes per entry minimum
+		}
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := d.Value()
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+				break
+			default:
+				return nil, fmt.Errorf("cbor: map key type %T not supported", k)
+			}
+			if _, ok := m[k]; ok {
+				return nil, fmt.Errorf("cbor: map with duplicate key %v", k)
+			}
+			m[k], err = d.Value()
+			if err != nil {
+				return nil, err
+			}
+		}
+		d.depth--
+		return m, nil
+	case MajorTag:
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		v, err := d.Value()
+		d.depth--
+		return v, err
+	default: // MajorSimple
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23: // null & undefined
+			return nil, nil
+		}
+		// floating-points have their bits as the argument
+		switch d.argSize {
+		case 2:
+			return halfToFloat(uint16(arg)), nil
+		case 4:
+			return float64(math.Float32frombits(uint32(arg))), nil
+		case 8:
+			return math.Float64frombits(arg), nil
+		}
+		return nil, fmt.Errorf("cbor: simple value %d not supported", arg)
+	}
+}
+
+func (d *Decoder) enter() error {
+	d.depth++
+	if d.depth > MaxDepth {
+		return errors.New("cbor: nesting exceeds depth limit")
+	}
+	return nil
+}
+
+// HalfToFloat converts an IEEE 754 half-precision value.
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		v = -v
+	}
+	return v
+}
+
+// Encoder writes deterministic CBOR conform RFC 8949, subsection 4.2.1.
+type Encoder struct {
+	bytes.Buffer
+}
+
+// Head writes the initial byte with the argument in its shortest form.
+func (e *Encoder) Head(major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		e.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		e.Write([]byte{major | 24, byte(arg)})
+	case arg <= math.MaxUint16:
+		e.Write([]byte{major | 25, byte(arg >> 8), byte(arg)})
+	case arg <= math.MaxUint32:
+		e.WriteByte(major | 26)
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(arg))
+		e.Write(buf[:])
+	default:
+		e.WriteByte(major | 27)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], arg)
+		e.Write(buf[:])
+	}
+}
+
+// Int writes an integer as either major type 0 or 1.
+func (e *Encoder) Int(i int64) {
+	if i < 0 {
+		e.Head(MajorNegInt, uint64(-1-i))
+	} else {
+		e.Head(MajorUint, uint64(i))
+	}
+}
+
+// ByteString writes a definite-length byte string.
+func (e *Encoder) ByteString(b []byte) {
+	e.Head(MajorBytes, uint64(len(b)))
+	e.Write(b)
+}
+
+// Text writes a definite-length text string.
+func (e *Encoder) Text(s string) {
+	e.Head(MajorText, uint64(len(s)))
+	e.WriteString(s)
+}
+
+// Value writes a data item. Floating-points with an integer value encode as
+// an integer, as does JSON in effect.
+func (e *Encoder) Value(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		e.WriteByte(MajorSimple<<5 | 22)
+	case bool:
+		if v {
+			e.WriteByte(MajorSimple<<5 | 21)
+		} else {
+			e.WriteByte(MajorSimple<<5 | 20)
+		}
+	case int:
+		e.Int(int64(v))
+	case int64:
+		e.Int(v)
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			e.Int(int64(v))
+			break
+		}
+		if f := float32(v); float64(f) == v || math.IsNaN(v) {
+			e.WriteByte(MajorSimple<<5 | 26)
+			var buf [4]byte
+			binary.BigEndian.PutUint32(buf[:], math.Float32bits(f))
+			e.Write(buf[:])
+			break
+		}
+		e.WriteByte(MajorSimple<<5 | 27)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+		e.Write(buf[:])
+	case string:
+		e.Text(v)
+	case []byte:
+		e.ByteString(v)
+	case []string:
+		e.Head(MajorArray, uint64(len(v)))
+		for _, s := range v {
+			e.Text(s)
+		}
+	case []interface{}:
+		e.Head(MajorArray, uint64(len(v)))
+		for _, o := range v {
+			if err := e.Value(o); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for k, o := range v {
+			m[k] = o
+		}
+		return e.Value(m)
+	case map[interface{}]interface{}:
+		return e.Map(v)
+	default:
+		return fmt.Errorf("cbor: type %T not supported", v)
+	}
+	return nil
+}
+
+// Map writes the entries with their keys in bytewise lexicographic order
+// of their encoding.
+func (e *Encoder) Map(m map[interface{}]interface{}) error {
+	type entry struct{ key, value []byte }
+	entries := make([]entry, 0, len(m))
+	for k, v := range m {
+		var key, value Encoder
+		switch k := k.(type) {
+		case int64:
+			key.Int(k)
+		case string:
+			key.Text(k)
+		default:
+			return fmt.Errorf("cbor: map key type %T not supported", k)
+		}
+		if err := value.Value(v); err != nil {
+			return err
+		}
+		entries = append(entries, entry{key.Bytes(), value.Bytes()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	e.Head(MajorMap, uint64(len(entries)))
+	for _, entry := range entries {
+		e.Write(entry.key)
+		e.Write(entry.value)
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for RemoteJWKS.
+const (
+	DefaultRefreshInterval = time.Hour
+	DefaultMinInterval     = time.Minute
+	DefaultFetchTimeout    = 10 * time.Second
+)
+
+// MaxJWKSSize limits the response body of a JWKS fetch in bytes.
+const MaxJWKSSize = 1 << 20
+
+// RemoteJWKS maintains a KeyRegister with the JWK Set (JSON Web Key Set) from
+// a URL. Fetches happen on first use, periodically in the background with Run,
+// and on demand for tokens with a key identifier not in use. Concurrent demand
+// results in a single fetch, and MinInterval limits the fetch rate on demand,
+// such that a flood of bad tokens can't hammer the key server. A failed fetch
+// leaves the current keys in place. Any modifications to the exported fields
+// should be made before first use. Multiple goroutines may invoke methods on a
+// RemoteJWKS simultaneously.
+type RemoteJWKS struct {
+	// URL locates the JWK Set.
+	URL string
+
+	// Client performs the fetches. Nil defaults to http.DefaultClient.
+	Client *http.Client
+
+	// RefreshInterval is the maximum age of the keys. A lower max-age
+	// from the Cache-Control header takes precedence. Zero defaults to
+	// DefaultRefreshInterval.
+	RefreshInterval time.Duration
+
+	// MinInterval is the minimum time between fetches on demand. It
+	// also applies as a lower bound on the refresh rate. Zero defaults
+	// to DefaultMinInterval.
+	MinInterval time.Duration
+
+	// FetchTimeout limits the duration of each fetch. Zero defaults to
+	// DefaultFetchTimeout.
+	FetchTimeout time.Duration
+
+	// Error receives any failure from a background refresh. Nil
+	// discards the errors.
+	Error func(err error)
+
+	// Signers expects the JWK Set as a signed JWT with a "keys" claim,
+	// conform the signed_jwks_uri of OpenID Federation 1.0, instead of
+	// plain JSON. The token must verify with any of the keys, e.g., the
+	// return of TrustChain, and it must be valid at the time of fetch.
+	// Nil reads the JWK Set as is.
+	Signers *KeyRegister
+
+	// Clock provides the time for the fetch schedule, and for the
+	// validity of the token with Signers. Nil defaults to time.Now.
+	Clock func() time.Time
+
+	// FetchHook is invoked, when not nil, at the start of each fetch.
+	// The context returned applies to the HTTP request, e.g., with a
+	// tracing span. The function returned, when not nil, receives the
+	// outcome of the fetch, with the number of keys on success. Any
+	// modifications should be made before first use.
+	FetchHook func(ctx context.Context) (context.Context, func(keysAdded int, err error))
+
+	keys atomic.Value // *KeyRegister
+
+	// After replaces time.NewTimer in Run, when not nil, for tests.
+	after func(d time.Duration) <-chan time.Time
+
+	mutex     sync.Mutex
+	flight    *jwksFlight   // pending fetch, if any
+	lastFetch time.Time     // start of latest fetch attempt
+	lastOK    time.Time     // start of latest successful fetch
+	maxAge    time.Duration // from latest successful fetch, if any
+}
+
+// JwksFlight is a single fetch with any number of waiting callers.
+type jwksFlight struct {
+	done chan struct{} // closed on completion
+	err  error
+}
+
+var errJWKSRateLimit = errors.New("jwt: JWKS fetch rate limit")
+
+// Keys returns the current register, or nil before the first fetch succeeds.
+// The register must not be modified.
+func (j *RemoteJWKS) Keys() *KeyRegister {
+	keys, _ := j.keys.Load().(*KeyRegister)
+	return keys
+}
+
+// Check parses a JWT if, and only if, the signature checks out with any of the
+// remote keys. Tokens with a key identifier that is not in use cause a fetch,
+// rate limited by MinInterval, before they fail. Use Claims.Valid to complete
+// the verification.
+func (j *RemoteJWKS) Check(token []byte) (*Claims, error) {
+	return observe(j.check(token))
+}
+
+func (j *RemoteJWKS) check(token []byte) (c *Claims, alg string, err error) {
+	keys := j.Keys()
+	if keys == nil {
+		if err := j.refresh(context.Background(), true); err != nil {
+			return nil, "", err
+		}
+		keys = j.Keys()
+	}
+
+	c, alg, err = keys.check(token)
+	if !errors.Is(err, ErrSigMiss) {
+		return c, alg, err
+	}
+
+	// unknown key identifier may be due to key rotation
+	var header Claims
+	if _, _, _, _, err := header.scan(token); err != nil || header.KeyID == "" || keys.usesKeyID(header.KeyID) {
+		return nil, alg, ErrSigMiss
+	}
+	if err := j.refresh(context.Background(), true); err != nil {
+		return nil, alg, ErrSigMiss
+	}
+	return j.Keys().check(token)
+}
+
+// Refresh fetches the keys, regardless of MinInterval. Concurrent invocation
+// results in a single fetch, which error is then returned to each caller.
+func (j *RemoteJWKS) Refresh(ctx context.Context) error {
+	return j.refresh(ctx, false)
+}
+
+// Run refreshes the keys in the background until ctx is done. Each refresh is
+// scheduled somewhere in the last 10% of RefreshInterval (or max-age), i.e.,
+// before expiry with random jitter, such that a fleet of instances doesn't
+// fetch in synchronisation. Failed attempts retry after MinInterval.
+func (j *RemoteJWKS) Run(ctx context.Context) error {
+	for {
+		j.mutex.Lock()
+		last, interval := j.lastFetch, j.interval()
+		j.mutex.Unlock()
+
+		var wait time.Duration
+		if !last.IsZero() {
+			jitter := time.Duration(rand.Int63n(int64(interval/10) + 1))
+			wait = last.Add(interval - jitter).Sub(j.now())
+		}
+		if err := j.sleep(ctx, wait); err != nil {
+			return err
+		}
+
+		j.mutex.Lock()
+		rescheduled := !j.lastFetch.Equal(last)
+		j.mutex.Unlock()
+		if rescheduled {
+			continue // fetched on demand meanwhile
+		}
+
+		err := j.refresh(ctx, false)
+		if err != nil && ctx.Err() == nil && j.Error != nil {
+			j.Error(err)
+		}
+	}
+}
+
+// Interval returns the refresh interval. The mutex must be held.
+func (j *RemoteJWKS) interval() time.Duration {
+	interval := j.RefreshInterval
+	if interval == 0 {
+		interval = DefaultRefreshInterval
+	}
+	if j.maxAge != 0 && j.maxAge < interval {
+		interval = j.maxAge
+	}
+	if min := j.minInterval(); interval < min {
+		interval = min
+	}
+	if !j.lastFetch.Equal(j.lastOK) {
+		// retry failure
+		interval = j.minInterval()
+	}
+	return interval
+}
+
+// Sleep pauses for d, or until ctx is done.
+func (j *RemoteJWKS) sleep(ctx context.Context, d time.Duration) error {
+	var expire <-chan time.Time
+	if j.after != nil {
+		expire = j.after(d)
+	} else {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		expire = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-expire:
+		return nil
+	}
+}
+
+func (j *RemoteJWKS) now() time.Time {
+	if j.Clock != nil {
+		return j.Clock()
+	}
+	return time.Now()
+}
+
+func (j *RemoteJWKS) minInterval() time.Duration {
+	if j.MinInterval == 0 {
+		return DefaultMinInterval
+	}
+	return j.MinInterval
+}
+
+// Refresh fetches the keys once, with single-flight semantics.
+func (j *RemoteJWKS) refresh(ctx context.Context, rateLimit bool) error {
+	j.mutex.Lock()
+	if f := j.flight; f != nil {
+		j.mutex.Unlock()
+		select {
+		case <-f.done:
+			return f.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if rateLimit && !j.lastFetch.IsZero() && j.now().Sub(j.lastFetch) < j.minInterval() {
+		j.mutex.Unlock()
+		return errJWKSRateLimit
+	}
+	f := &jwksFlight{done: make(chan struct{})}
+	j.flight = f
+	start := j.now()
+	j.lastFetch = start
+	j.mutex.Unlock()
+
+	keys, maxAge, err := j.fetch(ctx)
+	if err == nil {
+		j.keys.Store(keys)
+	}
+	f.err = err
+
+	j.mutex.Lock()
+	j.flight = nil
+	if err == nil {
+		j.lastOK = start
+		j.maxAge = maxAge
+	}
+	j.mutex.Unlock()
+	close(f.done)
+	return err
+}
+
+func (j *RemoteJWKS) fetch(ctx context.Context) (keys *KeyRegister, maxAge time.Duration, err error) {
+	var keysAdded int
+	if j.FetchHook != nil {
+		var done func(keysAdded int, err error)
+		ctx, done = j.FetchHook(ctx)
+		if done != nil {
+			defer func() { done(keysAdded, err) }()
+		}
+	}
+
+	timeout := j.FetchTimeout
+	if timeout == 0 {
+		timeout = DefaultFetchTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.URL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if j.Signers != nil {
+		req.Header.Set("Accept", "application/"+SignedJWKSType)
+	} else {
+		req.Header.Set("Accept", "application/jwk-set+json, application/json")
+	}
+
+	client := j.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, MaxJWKSSize))
+		return nil, 0, fmt.Errorf("jwt: JWKS fetch got HTTP status %q", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxJWKSSize+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(body) > MaxJWKSSize {
+		return nil, 0, errors.New("jwt: JWKS exceeds MaxJWKSSize")
+	}
+
+	if j.Signers != nil {
+		body, err = signedJWKS(bytes.TrimSpace(body), j.Signers, j.now())
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	keys = new(KeyRegister)
+	n, err := keys.LoadJWK(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	keysAdded = n
+	return keys, cacheMaxAge(resp.Header), nil
+}
+
+// CacheMaxAge returns the max-age directive from Cache-Control, if any.
+func cacheMaxAge(h http.Header) time.Duration {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		seconds, err := strconv.ParseUint(directive[len("max-age="):], 10, 31)
+		if err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return 0
+}
+
+// UsesKeyID returns whether any of the keys has the identifier.
+func (keys *KeyRegister) usesKeyID(kid string) bool {
+	for _, ids := range [][]string{keys.ECDSAIDs, keys.EdDSAIDs, keys.RSAIDs, keys.SecretIDs, keys.OtherIDs} {
+		for _, id := range ids {
+			if id == kid {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package jwt
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// JWKSServer serves a JWK Set with one secret per key identifier.
+type jwksServer struct {
+	mutex   sync.Mutex
+	kids    []string
+	fetches int32
+	maxAge  int
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.fetches, 1)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.maxAge != 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", s.maxAge))
+	}
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	fmt.Fprint(w, `{"keys":[`)
+	for i, kid := range s.kids {
+		if i != 0 {
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprintf(w, `{"kty":"oct","kid":%q,"k":%q}`, kid, base64.RawURLEncoding.EncodeToString([]byte("secret "+kid)))
+	}
+	fmt.Fprint(w, "]}")
+}
+
+func (s *jwksServer) addKID(kid string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.kids = append(s.kids, kid)
+}
+
+func jwksToken(t *testing.T, kid string) []byte {
+	t.Helper()
+	var c Claims
+	c.KeyID = kid
+	c.Subject = "test"
+	token, err := c.HMACSign(HS256, []byte("secret "+kid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRemoteJWKSCheck(t *testing.T) {
+	s := &jwksServer{kids: []string{"a"}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	now := time.Unix(1e9, 0)
+	j := &RemoteJWKS{URL: srv.URL, MinInterval: time.Minute,
+		Clock: func() time.Time { return now }}
+
+	if c, err := j.Check(jwksToken(t, "a")); err != nil {
+		t.Fatal("check error:", err)
+	} else if c.Subject != "test" {
+		t.Errorf("got subject %q, want test", c.Subject)
+	}
+	if _, err := j.Check(jwksToken(t, "a")); err != nil {
+		t.Fatal("check error:", err)
+	}
+	if n := atomic.LoadInt32(&s.fetches); n != 1 {
+		t.Errorf("got %d fetches for known key, want 1", n)
+	}
+
+	// rotation within MinInterval is rate limited
+	s.addKID("b")
+	if _, err := j.Check(jwksToken(t, "b")); err != ErrSigMiss {
+		t.Errorf("got error %v within MinInterval, want %v", err, ErrSigMiss)
+	}
+	if n := atomic.LoadInt32(&s.fetches); n != 1 {
+		t.Errorf("got %d fetches within MinInterval, want 1", n)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := j.Check(jwksToken(t, "b")); err != nil {
+		t.Error("check error after rotation:", err)
+	}
+	if n := atomic.LoadInt32(&s.fetches); n != 2 {
+		t.Errorf("got %d fetches after rotation, want 2", n)
+	}
+}
+
+func TestRemoteJWKSSingleFlight(t *testing.T) {
+	s := &jwksServer{kids: []string{"a"}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	j := &RemoteJWKS{URL: srv.URL, MinInterval: time.Hour}
+	if err := j.Refresh(context.Background()); err != nil {
+		t.Fatal("refresh error:", err)
+	}
+	j.mutex.Lock()
+	j.lastFetch = time.Time{} // permit one on demand
+	j.lastOK = time.Time{}
+	j.mutex.Unlock()
+
+	// flood of unknown key identifiers
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := j.Check(jwksToken(t, fmt.Sprint("bad", i)))
+			if err != ErrSigMiss {
+				t.Errorf("got error %v, want %v", err, ErrSigMiss)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&s.fetches); n != 2 {
+		t.Errorf("got %d fetches, want 2", n)
+	}
+}
+
+func TestRemoteJWKSRun(t *testing.T) {
+	s := &jwksServer{kids: []string{"a"}, maxAge: 3600}
+	var fail int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) != 0 {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	var now int64 = 1e18 // Unix nanoseconds
+	waits := make(chan time.Duration)
+	fire := make(chan time.Time)
+	errs := make(chan error, 1)
+	j := &RemoteJWKS{
+		URL:             srv.URL,
+		RefreshInterval: 100 * time.Second,
+		MinInterval:     10 * time.Second,
+		Clock:           func() time.Time { return time.Unix(0, atomic.LoadInt64(&now)) },
+		Error:           func(err error) { errs <- err },
+		after: func(d time.Duration) <-chan time.Time {
+			waits <- d
+			return fire
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- j.Run(ctx) }()
+
+	if d := <-waits; d != 0 {
+		t.Errorf("got initial wait %s, want 0", d)
+	}
+	// initial fetch plus three refreshes, each within the last 10%
+	for i := 1; i <= 4; i++ {
+		fire <- time.Time{}
+		d := <-waits // next iteration after the fetch
+		if n := atomic.LoadInt32(&s.fetches); n != int32(i) {
+			t.Errorf("got %d fetches, want %d", n, i)
+		}
+		if d < 90*time.Second || d > 100*time.Second {
+			t.Errorf("fetch %d got wait %s, want within 90s and 100s", i, d)
+		}
+		atomic.AddInt64(&now, int64(d))
+	}
+	if j.Keys() == nil || !j.Keys().usesKeyID("a") {
+		t.Error("keys not loaded")
+	}
+
+	// failures retry after MinInterval
+	atomic.StoreInt32(&fail, 1)
+	fire <- time.Time{}
+	if err := <-errs; err == nil {
+		t.Error("no error for failed refresh")
+	}
+	if d := <-waits; d < 9*time.Second || d > 10*time.Second {
+		t.Errorf("retry got wait %s, want within 9s and 10s", d)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("got run error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRemoteJWKSFetchError(t *testing.T) {
+	s := &jwksServer{kids: []string{"a"}}
+	var fail int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) != 0 {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	j := &RemoteJWKS{URL: srv.URL}
+	if err := j.Refresh(context.Background()); err != nil {
+		t.Fatal("refresh error:", err)
+	}
+	atomic.StoreInt32(&fail, 1)
+	const want = `jwt: JWKS fetch got HTTP status "503 Service Unavailable"`
+	if err := j.Refresh(context.Background()); err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+	if _, err := j.Check(jwksToken(t, "a")); err != nil {
+		t.Error("previous keys lost on fetch error:", err)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	golden := []struct {
+		cacheControl string
+		want         time.Duration
+	}{
+		{"", 0},
+		{"no-store", 0},
+		{"max-age=60", time.Minute},
+		{"public, max-age=3600, must-revalidate", time.Hour},
+		{"max-age=-1", 0},
+	}
+	for _, gold := range golden {
+		h := make(http.Header)
+		h.Set("Cache-Control", gold.cacheControl)
+		if got := cacheMaxAge(h); got != gold.want {
+			t.Errorf("%q: got %s, want %s", gold.cacheControl, got, gold.want)
+		}
+	}
+}
@@ -5,7 +5,12 @@ import (
 	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -222,6 +227,59 @@ func TestClaimsValid(t *testing.T) {
 	}
 }
 
+func TestClaimsExpiresIn(t *testing.T) {
+	var c Claims
+	if got := c.Remaining(time.Now()); got != math.MaxInt64 {
+		t.Errorf("got %s remaining without expiry, want maximum duration", got)
+	}
+
+	c.ExpiresIn(time.Hour)
+	if c.Issued == nil || c.NotBefore == nil || c.Expires == nil {
+		t.Fatalf("got iat %s, nbf %s, exp %s; want all set", c.Issued, c.NotBefore, c.Expires)
+	}
+	if *c.Issued != *c.NotBefore || *c.Expires != *c.Issued+3600 {
+		t.Errorf("got iat %s, nbf %s, exp %s; want nbf at iat and exp one hour later", c.Issued, c.NotBefore, c.Expires)
+	}
+	if *c.Issued != NumericTime(math.Trunc(float64(*c.Issued))) {
+		t.Errorf("got iat %s, want whole seconds", c.Issued)
+	}
+	if !c.Valid(time.Now()) {
+		t.Errorf("got iat %s, nbf %s, exp %s; want valid now", c.Issued, c.NotBefore, c.Expires)
+	}
+
+	issued := c.Issued.Time()
+	if got := c.Remaining(issued.Add(15 * time.Minute)); got != 45*time.Minute {
+		t.Errorf("got %s remaining, want 45m", got)
+	}
+	if got := c.Remaining(issued.Add(2 * time.Hour)); got != -time.Hour {
+		t.Errorf("got %s remaining, want -1h", got)
+	}
+
+	c.Issued = nil
+	c.IssuedNow()
+	if c.Issued == nil || time.Since(c.Issued.Time()) > time.Minute {
+		t.Errorf("got iat %s, want now", c.Issued)
+	}
+}
+
+func TestClaimsShouldRenew(t *testing.T) {
+	now := time.Unix(1537622794, 0)
+	var r Registered
+	if r.ShouldRenew(time.Hour, now) {
+		t.Error("renewal without expiry")
+	}
+	r.Expires = NewNumericTime(now.Add(time.Minute))
+	if r.ShouldRenew(time.Minute, now) {
+		t.Error("renewal with a minute remaining on threshold of a minute")
+	}
+	if !r.ShouldRenew(time.Minute+time.Second, now) {
+		t.Error("no renewal with a minute remaining on threshold above a minute")
+	}
+	if !r.ShouldRenew(0, now.Add(time.Hour)) {
+		t.Error("no renewal when expired")
+	}
+}
+
 func TestClaimsNull(t *testing.T) {
 	const name = "x"
 	c := Claims{Set: map[string]interface{}{name: nil}}
@@ -258,3 +316,229 @@ func mustParseRSAKey(s string) *rsa.PrivateKey {
 	}
 	return key
 }
+
+func TestClaimsHeader(t *testing.T) {
+	c := Claims{RawHeader: []byte(`{"alg":"ES256","kid":"№1","typ":"JWT","cty":"JWT","x5t":"AA","x5t#S256":"BB","crit":["exp"],"exp":1,"typ2":null}`)}
+	h, err := c.Header()
+	if err != nil {
+		t.Fatal("header error:", err)
+	}
+	want := Header{
+		Alg:         "ES256",
+		KeyID:       "№1",
+		Type:        "JWT",
+		ContentType: "JWT",
+		CertSHA1:    "AA",
+		CertSHA256:  "BB",
+		Crit:        []string{"exp"},
+		Set:         map[string]interface{}{"exp": 1.0, "typ2": nil},
+	}
+	if !reflect.DeepEqual(*h, want) {
+		t.Errorf("got %#v, want %#v", *h, want)
+	}
+
+	// round trip
+	bytes, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+	const wantJSON = `{"alg":"ES256","crit":["exp"],"cty":"JWT","exp":1,"kid":"№1","typ":"JWT","typ2":null,"x5t":"AA","x5t#S256":"BB"}`
+	if string(bytes) != wantJSON {
+		t.Errorf("got JSON %s, want %s", bytes, wantJSON)
+	}
+}
+
+func TestClaimsHeaderTypeMismatch(t *testing.T) {
+	c := Claims{RawHeader: []byte(`{"alg":null,"kid":2,"crit":["a",true]}`)}
+	h, err := c.Header()
+	if err != nil {
+		t.Fatal("header error:", err)
+	}
+	if h.Alg != "" || h.KeyID != "" || h.Crit != nil {
+		t.Errorf("got mismatched types in fields: %#v", h)
+	}
+	if len(h.Set) != 3 {
+		t.Errorf("got %d entries in header set %#v, want 3", len(h.Set), h.Set)
+	}
+
+	c.RawHeader = []byte("broken")
+	if _, err := c.Header(); err == nil {
+		t.Error("no error for malformed header")
+	}
+}
+
+func TestClaimsClone(t *testing.T) {
+	c := &Claims{
+		Registered: Registered{
+			Issuer:    "MI6",
+			Audiences: []string{"Q"},
+			Expires:   NewNumericTime(time.Unix(1537622794, 0)),
+		},
+		Set: map[string]interface{}{
+			"gadgets": []interface{}{"watch", map[string]interface{}{"pen": true}},
+		},
+		Raw:   json.RawMessage(`{}`),
+		KeyID: "k1",
+	}
+	clone := c.Clone()
+	if !reflect.DeepEqual(clone, c) {
+		t.Fatalf("got clone %#v, want %#v", clone, c)
+	}
+
+	// no shared memory
+	clone.Audiences[0] = "M"
+	*clone.Expires = 0
+	clone.Set["gadgets"].([]interface{})[1].(map[string]interface{})["pen"] = false
+	clone.Raw[0] = '['
+	if c.Audiences[0] != "Q" {
+		t.Error("audiences modified through clone")
+	}
+	if *c.Expires != 1537622794 {
+		t.Error("expiry modified through clone")
+	}
+	if !c.Set["gadgets"].([]interface{})[1].(map[string]interface{})["pen"].(bool) {
+		t.Error("claims set modified through clone")
+	}
+	if string(c.Raw) != "{}" {
+		t.Error("raw modified through clone")
+	}
+}
+
+func TestClaimsMerge(t *testing.T) {
+	template := &Claims{
+		Registered: Registered{
+			Issuer:    "MI6",
+			Subject:   "nobody",
+			Audiences: []string{"Q"},
+		},
+		Set: map[string]interface{}{"clearance": "top"},
+	}
+	c := template.Clone()
+	other := &Claims{
+		Registered: Registered{
+			Subject: "007",
+			ID:      "a1",
+		},
+		Set:   map[string]interface{}{"gadgets": []interface{}{"watch"}},
+		KeyID: "k2",
+	}
+	c.Merge(other)
+
+	want := &Claims{
+		Registered: Registered{
+			Issuer:    "MI6",
+			Subject:   "007",
+			Audiences: []string{"Q"},
+			ID:        "a1",
+		},
+		Set: map[string]interface{}{
+			"clearance": "top",
+			"gadgets":   []interface{}{"watch"},
+		},
+		KeyID: "k2",
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %#v, want %#v", c, want)
+	}
+	if len(template.Set) != 1 || template.Subject != "nobody" {
+		t.Errorf("template modified: %#v", template)
+	}
+	other.Set["gadgets"].([]interface{})[0] = "pen"
+	if c.Set["gadgets"].([]interface{})[0] != "watch" {
+		t.Error("claims set modified through merge source")
+	}
+
+	// nil Set gets allocated
+	var empty Claims
+	empty.Merge(other)
+	if len(empty.Set) != 1 {
+		t.Errorf("got claims set %#v, want gadgets entry", empty.Set)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := &Claims{
+		Registered: Registered{
+			Issuer:    "https://old.example.com",
+			Subject:   "alice",
+			Audiences: []string{"api"},
+			Expires:   NewNumericTime(time.Unix(1600000000, 0)),
+		},
+		Set: map[string]interface{}{
+			"email":  "alice@example.com",
+			"groups": []string{"admin", "dev"},
+			"level":  3,
+		},
+	}
+	b := &Claims{
+		Registered: Registered{
+			Issuer:  "https://new.example.com",
+			Subject: "alice",
+			Expires: NewNumericTime(time.Unix(1600000000, 0)),
+		},
+		Set: map[string]interface{}{
+			"aud":    "api",
+			"groups": []interface{}{"admin", "dev"},
+			"level":  float64(3),
+			"tenant": "acme",
+		},
+		KeyID: "other",
+	}
+
+	d := Diff(a, b)
+	want := &ClaimsDiff{
+		Added:   []string{"tenant"},
+		Removed: []string{"email"},
+		Changed: []string{"iss"},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got %+v, want %+v", d, want)
+	}
+	if d.Empty() {
+		t.Error("diff empty")
+	}
+
+	if d := Diff(a, a.Clone()); !d.Empty() {
+		t.Errorf("got %+v for clone, want empty", d)
+	}
+}
+
+func TestClaimsRedacted(t *testing.T) {
+	c := &Claims{
+		Registered: Registered{
+			Issuer:  "MI6",
+			Subject: "007",
+			Expires: NewNumericTime(time.Unix(1537622794, 0)),
+		},
+		Set: map[string]interface{}{
+			"sub":     "ignored",
+			"name":    "James Bond",
+			"gadgets": []interface{}{"watch", "pen"},
+		},
+		KeyID: "k1",
+	}
+
+	const all = `iss="MI6" sub="007" exp=2018-09-22T13:26:34Z kid="k1" gadgets=["watch","pen"] name="James Bond"`
+	if got := c.Redacted(nil); got != all {
+		t.Errorf("got %s, want %s", got, all)
+	}
+
+	r := &Redaction{HashSubject: true, Mask: []string{"name", "iss"}}
+	const masked = `iss=*** sub=sha256:Yp9M-TN7DQx2 exp=2018-09-22T13:26:34Z kid="k1" gadgets=["watch","pen"] name=***`
+	if got := c.Redacted(r); got != masked {
+		t.Errorf("got %s, want %s", got, masked)
+	}
+	r.Salt = []byte("pepper")
+	if got := c.Redacted(r); got == masked || strings.Contains(got, "007") {
+		t.Errorf("salted got %s", got)
+	}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if got := fmt.Sprintf(format, c); strings.Contains(got, "007") || !strings.Contains(got, "sub=sha256:") {
+			t.Errorf("%s got %s", format, got)
+		}
+	}
+	if got, want := fmt.Sprintf("%d", c), "%!d(*jwt.Claims)"; got != want {
+		t.Errorf("%%d got %q, want %q", got, want)
+	}
+}
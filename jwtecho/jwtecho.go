@@ -0,0 +1,47 @@
+// Package jwtecho provides Echo middleware for the jwt package. Verification
+// conforms jwt.Handler, including the header bindings and the custom function.
+package jwtecho
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pascaldekloe/jwt"
+)
+
+// ClaimsKey is the name of the verified jwt.Claims in each echo.Context.
+const ClaimsKey = "jwt.claims"
+
+type privateKey struct{}
+
+// Middleware returns h as Echo middleware. The Target of h is ignored, as
+// the next handler in the chain takes its place. The claims are set in the
+// echo.Context as ClaimsKey, and in the request context as h.ContextKey when
+// not nil.
+func Middleware(h jwt.Handler) echo.MiddlewareFunc {
+	contextKey := h.ContextKey
+	if contextKey == nil {
+		contextKey = privateKey{}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var err error
+			h := h // copy per request
+			h.ContextKey = contextKey
+			h.Target = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c.Set(ClaimsKey, r.Context().Value(contextKey))
+				c.SetRequest(r)
+				err = next(c)
+			})
+			h.ServeHTTP(c.Response(), c.Request())
+			return err
+		}
+	}
+}
+
+// Claims returns the verified claims from Middleware, if any.
+func Claims(c echo.Context) *jwt.Claims {
+	claims, _ := c.Get(ClaimsKey).(*jwt.Claims)
+	return claims
+}
@@ -0,0 +1,49 @@
+// Package jwtgin provides Gin middleware for the jwt package. Verification
+// conforms jwt.Handler, including the header bindings and the custom function.
+package jwtgin
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pascaldekloe/jwt"
+)
+
+// ClaimsKey is the name of the verified jwt.Claims in each gin.Context.
+const ClaimsKey = "jwt.claims"
+
+type privateKey struct{}
+
+// Middleware returns h as Gin middleware. The Target of h is ignored, as the
+// remaining handlers in the chain take its place. Requests which fail
+// verification are aborted. The claims are set in the gin.Context as
+// ClaimsKey, and in the request context as h.ContextKey when not nil.
+func Middleware(h jwt.Handler) gin.HandlerFunc {
+	contextKey := h.ContextKey
+	if contextKey == nil {
+		contextKey = privateKey{}
+	}
+
+	return func(c *gin.Context) {
+		var pass bool
+		h := h // copy per request
+		h.ContextKey = contextKey
+		h.Target = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pass = true
+			c.Set(ClaimsKey, r.Context().Value(contextKey))
+			c.Request = r
+			c.Next()
+		})
+		h.ServeHTTP(c.Writer, c.Request)
+		if !pass {
+			c.Abort()
+		}
+	}
+}
+
+// Claims returns the verified claims from Middleware, if any.
+func Claims(c *gin.Context) *jwt.Claims {
+	v, _ := c.Get(ClaimsKey)
+	claims, _ := v.(*jwt.Claims)
+	return claims
+}
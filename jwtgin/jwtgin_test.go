@@ -0,0 +1,50 @@
+package jwtgin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pascaldekloe/jwt"
+)
+
+func TestMiddleware(t *testing.T) {
+	var c jwt.Claims
+	c.Subject = "alice"
+	token, err := c.HMACSign(jwt.HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(Middleware(jwt.Handler{
+		Keys:          &jwt.KeyRegister{Secrets: [][]byte{[]byte("guest")}},
+		HeaderBinding: map[string]string{"sub": "X-Verified-Subject"},
+	}))
+	e.GET("/", func(c *gin.Context) {
+		if got := Claims(c); got == nil || got.Subject != "alice" {
+			t.Errorf("got claims %v, want subject alice", got)
+		}
+		c.String(http.StatusOK, c.Request.Header.Get("X-Verified-Subject"))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+string(token))
+	resp := httptest.NewRecorder()
+	e.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || resp.Body.String() != "alice" {
+		t.Errorf("got status %d with body %q, want 200 with alice", resp.Code, resp.Body)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	resp = httptest.NewRecorder()
+	e.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d without token, want 401", resp.Code)
+	}
+	if resp.Header().Get("WWW-Authenticate") == "" {
+		t.Error("no WWW-Authenticate header without token")
+	}
+}
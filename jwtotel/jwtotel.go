@@ -0,0 +1,134 @@
+// Package jwtotel provides OpenTelemetry tracing for the jwt package. Spans
+// carry the algorithm, the key identifier, the issuer and the outcome of each
+// operation. Tokens are never recorded. Header values and claims are recorded
+// only when the signature checks out, as anything else is unverified input.
+package jwtotel
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+
+	"github.com/pascaldekloe/jwt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName identifies the tracer.
+const InstrumentationName = "github.com/pascaldekloe/jwt/jwtotel"
+
+// Span attribute keys
+const (
+	AlgKey     = attribute.Key("jwt.alg")     // "alg" header parameter
+	KeyIDKey   = attribute.Key("jwt.kid")     // "kid" header parameter
+	IssuerKey  = attribute.Key("jwt.iss")     // "iss" claim
+	OutcomeKey = attribute.Key("jwt.outcome") // "ok" or jwt.ErrorClass
+	URLKey     = attribute.Key("url.full")    // JWKS location
+	KeysKey    = attribute.Key("jwt.keys")    // number of keys fetched
+)
+
+// Tracer wraps the jwt functions in spans. The zero value uses the global
+// tracer provider from the otel package.
+type Tracer struct {
+	// Provider creates the tracer. Nil defaults to otel.GetTracerProvider.
+	Provider trace.TracerProvider
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	provider := t.Provider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(InstrumentationName).Start(ctx, name, trace.WithSpanKind(kind))
+}
+
+// End records the outcome. Error messages are left out, as they may include
+// unverified content of the token.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.SetAttributes(OutcomeKey.String(jwt.ErrorClass(err)))
+		span.SetStatus(codes.Error, jwt.ErrorClass(err))
+	} else {
+		span.SetAttributes(OutcomeKey.String("ok"))
+	}
+	span.End()
+}
+
+// Check returns keys.Check(token) in a span named "jwt.Check".
+func (t *Tracer) Check(ctx context.Context, keys *jwt.KeyRegister, token []byte) (*jwt.Claims, error) {
+	_, span := t.start(ctx, "jwt.Check", trace.SpanKindInternal)
+	claims, err := keys.Check(token)
+	if err == nil {
+		setClaims(span, claims)
+	}
+	end(span, err)
+	return claims, err
+}
+
+// CheckSet returns set.Check(token) in a span named "jwt.Check".
+func (t *Tracer) CheckSet(ctx context.Context, set jwt.RegisterSet, token []byte) (*jwt.Claims, error) {
+	_, span := t.start(ctx, "jwt.Check", trace.SpanKindInternal)
+	claims, err := set.Check(token)
+	if err == nil {
+		setClaims(span, claims)
+	}
+	end(span, err)
+	return claims, err
+}
+
+// CheckRemote returns j.Check(token) in a span named "jwt.Check". Use
+// Instrument for spans on the fetches of j.
+func (t *Tracer) CheckRemote(ctx context.Context, j *jwt.RemoteJWKS, token []byte) (*jwt.Claims, error) {
+	_, span := t.start(ctx, "jwt.Check", trace.SpanKindInternal)
+	claims, err := j.Check(token)
+	if err == nil {
+		setClaims(span, claims)
+	}
+	end(span, err)
+	return claims, err
+}
+
+// Instrument sets the FetchHook of j such that each fetch runs in a span
+// named "jwt.JWKS.fetch", including the ones from Run and from Check on an
+// unknown key identifier. The outcome is either "ok" or "fetch". Instrument
+// must be called before first use of j.
+func (t *Tracer) Instrument(j *jwt.RemoteJWKS) {
+	j.FetchHook = func(ctx context.Context) (context.Context, func(int, error)) {
+		ctx, span := t.start(ctx, "jwt.JWKS.fetch", trace.SpanKindClient)
+		span.SetAttributes(URLKey.String(j.URL))
+		return ctx, func(keysAdded int, err error) {
+			if err != nil {
+				span.SetAttributes(OutcomeKey.String("fetch"))
+				span.SetStatus(codes.Error, "fetch")
+			} else {
+				span.SetAttributes(KeysKey.Int(keysAdded), OutcomeKey.String("ok"))
+			}
+			span.End()
+		}
+	}
+}
+
+// Sign returns c.Sign(alg, key, extraHeaders...) in a span named "jwt.Sign".
+func (t *Tracer) Sign(ctx context.Context, c *jwt.Claims, alg string, key crypto.PrivateKey, extraHeaders ...json.RawMessage) ([]byte, error) {
+	_, span := t.start(ctx, "jwt.Sign", trace.SpanKindInternal)
+	token, err := c.Sign(alg, key, extraHeaders...)
+	if err == nil {
+		setClaims(span, c)
+	}
+	end(span, err)
+	return token, err
+}
+
+func setClaims(span trace.Span, c *jwt.Claims) {
+	if header, err := c.Header(); err == nil {
+		span.SetAttributes(AlgKey.String(header.Alg))
+	}
+	if c.KeyID != "" {
+		span.SetAttributes(KeyIDKey.String(c.KeyID))
+	}
+	if c.Issuer != "" {
+		span.SetAttributes(IssuerKey.String(c.Issuer))
+	}
+}
@@ -0,0 +1,144 @@
+package jwtotel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pascaldekloe/jwt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCheckSign(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := &Tracer{Provider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))}
+	ctx := context.Background()
+
+	c := jwt.Claims{KeyID: "k1"}
+	c.Issuer = "Cheryl"
+	token, err := tracer.Sign(ctx, &c, jwt.HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	keys := &jwt.KeyRegister{Secrets: [][]byte{[]byte("guest")}}
+	if _, err := tracer.Check(ctx, keys, token); err != nil {
+		t.Fatal("check error:", err)
+	}
+	keys.Secrets[0] = []byte("wrong")
+	if _, err := tracer.Check(ctx, keys, token); err != jwt.ErrSigMiss {
+		t.Fatalf("got error %v, want %v", err, jwt.ErrSigMiss)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	want := [][]attribute.KeyValue{
+		{AlgKey.String(jwt.HS256), KeyIDKey.String("k1"), IssuerKey.String("Cheryl"), OutcomeKey.String("ok")},
+		{AlgKey.String(jwt.HS256), KeyIDKey.String("k1"), IssuerKey.String("Cheryl"), OutcomeKey.String("ok")},
+		{OutcomeKey.String("signature")},
+	}
+	for i, span := range spans {
+		got := span.Attributes()
+		if len(got) != len(want[i]) {
+			t.Errorf("span %d %s got attributes %v, want %v", i, span.Name(), got, want[i])
+			continue
+		}
+		for j := range got {
+			if got[j] != want[i][j] {
+				t.Errorf("span %d %s got attribute %v, want %v", i, span.Name(), got[j], want[i][j])
+			}
+		}
+	}
+	if spans[0].Name() != "jwt.Sign" || spans[1].Name() != "jwt.Check" {
+		t.Errorf("got span names %q and %q", spans[0].Name(), spans[1].Name())
+	}
+	if spans[2].Status().Code != codes.Error {
+		t.Errorf("got status %v for signature mismatch, want error", spans[2].Status())
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	const jwks = `{"keys":[{"kty":"oct","kid":"k1","k":"Z3Vlc3Q"}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/jwks" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(jwks))
+	}))
+	defer srv.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := &Tracer{Provider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))}
+	ctx := context.Background()
+
+	j := &jwt.RemoteJWKS{URL: srv.URL + "/jwks", Client: srv.Client()}
+	tracer.Instrument(j)
+	token, err := (&jwt.Claims{KeyID: "k1"}).HMACSign(jwt.HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	// unknown key identifier fetches on demand
+	if _, err := tracer.CheckRemote(ctx, j, token); err != nil {
+		t.Fatal("check error:", err)
+	}
+	j.URL = srv.URL + "/absent"
+	tracer.Instrument(j)
+	if err := j.Refresh(ctx); err == nil {
+		t.Fatal("refresh on absent JWKS got no error")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	if spans[0].Name() != "jwt.JWKS.fetch" || spans[1].Name() != "jwt.Check" || spans[2].Name() != "jwt.JWKS.fetch" {
+		t.Fatalf("got span names %q, %q and %q", spans[0].Name(), spans[1].Name(), spans[2].Name())
+	}
+	if got := spans[0].SpanKind(); got != trace.SpanKindClient {
+		t.Errorf("fetch got span kind %v, want %v", got, trace.SpanKindClient)
+	}
+	want := []attribute.KeyValue{URLKey.String(srv.URL + "/jwks"), KeysKey.Int(1), OutcomeKey.String("ok")}
+	got := spans[0].Attributes()
+	if len(got) != len(want) {
+		t.Errorf("fetch got attributes %v, want %v", got, want)
+	} else {
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("fetch got attribute %v, want %v", got[i], want[i])
+			}
+		}
+	}
+	if spans[2].Status().Code != codes.Error {
+		t.Errorf("got status %v for fetch failure, want error", spans[2].Status())
+	}
+}
+
+func TestCheckErrorUnrecorded(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := &Tracer{Provider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))}
+
+	var c jwt.Claims
+	c.Issuer = "unverified secret"
+	token, err := c.HMACSign(jwt.HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := tracer.CheckSet(context.Background(), jwt.RegisterSet{}, token); err == nil {
+		t.Fatal("no error for unknown issuer")
+	}
+
+	span := recorder.Ended()[0]
+	if events := span.Events(); len(events) != 0 {
+		t.Errorf("got events %v, want none", events)
+	}
+	if got := span.Status(); got.Code != codes.Error || got.Description != "issuer" {
+		t.Errorf("got status %v, want error with description issuer", got)
+	}
+}
@@ -0,0 +1,198 @@
+// Package jwttest provides an in-memory token issuer for tests of services
+// which verify JWTs. Keys derive from a seed, such that tokens are identical
+// across test runs with a fixed Clock, and the issuer serves its JWK Set over
+// HTTP for code with jwt.RemoteJWKS. Helpers mint tokens which are valid, and
+// tokens which should fail verification in specific ways.
+package jwttest
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// Defaults for an Issuer.
+const (
+	DefaultAudience = "test-audience"
+	DefaultSubject  = "test-subject"
+	DefaultLifetime = time.Hour
+)
+
+// Issuer mints EdDSA tokens with a key derived from its seed. Any modifications
+// to the exported fields should be made before first use. Multiple goroutines
+// may invoke methods on an Issuer simultaneously.
+type Issuer struct {
+	// Name is the "iss" claim.
+	Name string
+	// KeyID is the "kid" header, and the key identifier in the JWK Set.
+	KeyID string
+
+	// Audience is the default "aud" claim. Empty defaults to
+	// DefaultAudience.
+	Audience string
+	// Lifetime is the default validity of tokens. Zero defaults to
+	// DefaultLifetime.
+	Lifetime time.Duration
+
+	// Clock provides the time for issuance. Nil defaults to time.Now.
+	Clock func() time.Time
+
+	key    ed25519.PrivateKey
+	serial uint64 // token ID sequence
+}
+
+// NewIssuer returns an issuer named after the seed, with a key derived from the
+// seed. Issuers with the same seed have the same key.
+func NewIssuer(seed string) *Issuer {
+	sum := sha256.Sum256([]byte("jwttest " + seed))
+	return &Issuer{
+		Name:  "https://" + seed + ".example.com",
+		KeyID: seed + "-key",
+		key:   ed25519.NewKeyFromSeed(sum[:]),
+	}
+}
+
+func (i *Issuer) now() time.Time {
+	if i.Clock != nil {
+		return i.Clock()
+	}
+	return time.Now()
+}
+
+// PublicKey returns the public key of the issuer.
+func (i *Issuer) PublicKey() ed25519.PublicKey {
+	return i.key.Public().(ed25519.PublicKey)
+}
+
+// Keys returns a register with the public key of the issuer.
+func (i *Issuer) Keys() *jwt.KeyRegister {
+	return &jwt.KeyRegister{
+		EdDSAs:   []ed25519.PublicKey{i.PublicKey()},
+		EdDSAIDs: []string{i.KeyID},
+	}
+}
+
+// JWKS returns the JWK Set with the public key of the issuer.
+func (i *Issuer) JWKS() []byte {
+	set := map[string]interface{}{
+		"keys": []interface{}{map[string]interface{}{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": i.KeyID,
+			"use": "sig",
+			"alg": jwt.EdDSA,
+			"x":   base64.RawURLEncoding.EncodeToString(i.PublicKey()),
+		}},
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		panic(err) // can't happen
+	}
+	return data
+}
+
+// ServeHTTP honors the http.Handler interface. Each request gets the JWKS,
+// regardless of the method and path.
+func (i *Issuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Write(i.JWKS())
+}
+
+// NewServer starts an HTTP server with the JWKS of the issuer, for use with
+// jwt.RemoteJWKS. The caller should Close the server when done.
+func (i *Issuer) NewServer() *httptest.Server {
+	return httptest.NewServer(i)
+}
+
+// Claims returns a template for tokens, with the issuer name, the default
+// audience and subject, a unique ID, and the time of issuance. The expiry is
+// after the Lifetime.
+func (i *Issuer) Claims() *jwt.Claims {
+	now := i.now().Truncate(time.Second)
+	lifetime := i.Lifetime
+	if lifetime == 0 {
+		lifetime = DefaultLifetime
+	}
+	audience := i.Audience
+	if audience == "" {
+		audience = DefaultAudience
+	}
+
+	c := new(jwt.Claims)
+	c.Issuer = i.Name
+	c.Subject = DefaultSubject
+	c.Audiences = []string{audience}
+	c.Issued = jwt.NewNumericTime(now)
+	c.NotBefore = jwt.NewNumericTime(now)
+	c.Expires = jwt.NewNumericTime(now.Add(lifetime))
+	c.ID = fmt.Sprintf("%s-%d", i.KeyID, atomic.AddUint64(&i.serial, 1))
+	return c
+}
+
+// Sign returns the token of the claims, with the KeyID of the issuer set, or it
+// fails the test. Nil claims default to the Claims template.
+func (i *Issuer) Sign(t testing.TB, c *jwt.Claims) []byte {
+	t.Helper()
+	if c == nil {
+		c = i.Claims()
+	}
+	c.KeyID = i.KeyID
+	token, err := c.EdDSASign(i.key)
+	if err != nil {
+		t.Fatal("jwttest: sign error:", err)
+	}
+	return token
+}
+
+// Valid returns a token from the Claims template.
+func (i *Issuer) Valid(t testing.TB) []byte {
+	t.Helper()
+	return i.Sign(t, i.Claims())
+}
+
+// Expired returns a token from the Claims template, which expired a minute ago.
+func (i *Issuer) Expired(t testing.TB) []byte {
+	t.Helper()
+	c := i.Claims()
+	now := i.now().Truncate(time.Second)
+	c.Issued = jwt.NewNumericTime(now.Add(-time.Hour))
+	c.NotBefore = jwt.NewNumericTime(now.Add(-time.Hour))
+	c.Expires = jwt.NewNumericTime(now.Add(-time.Minute))
+	return i.Sign(t, c)
+}
+
+// NotYetValid returns a token from the Claims template, with a not-before a
+// minute from now.
+func (i *Issuer) NotYetValid(t testing.TB) []byte {
+	t.Helper()
+	c := i.Claims()
+	c.NotBefore = jwt.NewNumericTime(i.now().Truncate(time.Second).Add(time.Minute))
+	return i.Sign(t, c)
+}
+
+// WrongAudience returns a token from the Claims template, with another
+// audience.
+func (i *Issuer) WrongAudience(t testing.TB) []byte {
+	t.Helper()
+	c := i.Claims()
+	c.Audiences = []string{"https://other.example.com"}
+	return i.Sign(t, c)
+}
+
+// Forged returns a token from the Claims template, with the key ID of the
+// issuer, yet signed by another key.
+func (i *Issuer) Forged(t testing.TB) []byte {
+	t.Helper()
+	other := NewIssuer(i.Name + " forgery")
+	other.KeyID = i.KeyID
+	return other.Sign(t, i.Claims())
+}
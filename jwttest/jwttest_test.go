@@ -0,0 +1,76 @@
+package jwttest
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+func TestIssuer(t *testing.T) {
+	issuer := NewIssuer("test")
+	keys := issuer.Keys()
+
+	c, err := keys.Check(issuer.Valid(t))
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if !c.Valid(time.Now()) {
+		t.Error("valid token not valid")
+	}
+	if c.Issuer != "https://test.example.com" || !c.AcceptAudience(DefaultAudience) {
+		t.Errorf("got issuer %q and audiences %q", c.Issuer, c.Audiences)
+	}
+
+	c, err = keys.Check(issuer.Expired(t))
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if c.Valid(time.Now()) {
+		t.Error("expired token valid")
+	}
+
+	c, err = keys.Check(issuer.NotYetValid(t))
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if c.Valid(time.Now()) {
+		t.Error("not-yet-valid token valid")
+	}
+
+	c, err = keys.Check(issuer.WrongAudience(t))
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if c.AcceptAudience(DefaultAudience) {
+		t.Error("wrong audience accepted")
+	}
+
+	if _, err := keys.Check(issuer.Forged(t)); err != jwt.ErrSigMiss {
+		t.Errorf("forged token got error %v, want %v", err, jwt.ErrSigMiss)
+	}
+}
+
+func TestIssuerDeterministic(t *testing.T) {
+	clock := func() time.Time { return time.Unix(1e9, 0) }
+	a, b := NewIssuer("same"), NewIssuer("same")
+	a.Clock, b.Clock = clock, clock
+	if got, want := a.Valid(t), b.Valid(t); !bytes.Equal(got, want) {
+		t.Errorf("got token %q, want %q", got, want)
+	}
+	if bytes.Equal(a.JWKS(), NewIssuer("other").JWKS()) {
+		t.Error("different seeds got the same JWKS")
+	}
+}
+
+func TestIssuerServer(t *testing.T) {
+	issuer := NewIssuer("remote")
+	srv := issuer.NewServer()
+	defer srv.Close()
+
+	remote := &jwt.RemoteJWKS{URL: srv.URL + "/.well-known/jwks.json"}
+	if _, err := remote.Check(issuer.Valid(t)); err != nil {
+		t.Error("remote check error:", err)
+	}
+}
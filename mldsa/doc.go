@@ -0,0 +1,18 @@
+// Package mldsa provides the ML-DSA signature algorithms from “Module-Lattice-
+// Based Digital Signature Standard” FIPS 204, with the JOSE identifiers from
+// the Internet-Draft “ML-DSA for JOSE and COSE” (draft-ietf-cose-dilithium).
+// Importing the package registers ML-DSA-44, ML-DSA-65 and ML-DSA-87 with
+// jwt.RegisterAlg.
+//
+// The package is EXPERIMENTAL. Identifiers and key formats may change with
+// the specification, at which point this package follows without backwards
+// compatibility. The implementation requires Go 1.27 or later, as it builds on
+// crypto/mldsa from the standard library. Older versions compile an empty
+// package, without any registrations.
+//
+// Sign with jwt.Claims.Sign, using a *mldsa.PrivateKey from the standard
+// library. Verify with jwt.KeyRegister.Check, using *mldsa.PublicKey entries
+// in Others. Use jwt.KeyRegister.LoadJWK for keys with "AKP" as the type.
+// Signatures apply on the JWS Signing Input directly (“pure” ML-DSA), with an
+// empty context string.
+package mldsa
@@ -0,0 +1,91 @@
+//go:build go1.27
+
+package mldsa
+
+import (
+	"crypto"
+	"crypto/mldsa"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// Algorithm Identification Tokens
+const (
+	MLDSA44 = "ML-DSA-44" // ML-DSA with parameter set ML-DSA-44
+	MLDSA65 = "ML-DSA-65" // ML-DSA with parameter set ML-DSA-65
+	MLDSA87 = "ML-DSA-87" // ML-DSA with parameter set ML-DSA-87
+)
+
+func init() {
+	jwt.RegisterAlg(alg{MLDSA44, mldsa.MLDSA44()})
+	jwt.RegisterAlg(alg{MLDSA65, mldsa.MLDSA65()})
+	jwt.RegisterAlg(alg{MLDSA87, mldsa.MLDSA87()})
+}
+
+// Alg implements jwt.Alg and jwt.JWKDecoder for one parameter set.
+type alg struct {
+	name   string
+	params mldsa.Parameters
+}
+
+// Name implements the jwt.Alg interface.
+func (a alg) Name() string { return a.name }
+
+// Hash implements the jwt.Alg interface. ML-DSA signs the input as is.
+func (alg) Hash() crypto.Hash { return 0 }
+
+// Sign implements the jwt.Alg interface.
+func (a alg) Sign(key crypto.PrivateKey, signingInput []byte) ([]byte, error) {
+	priv, ok := key.(*mldsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("jwt: %s with unsupported key type %T", a.name, key)
+	}
+	if priv.PublicKey().Parameters() != a.params {
+		return nil, fmt.Errorf("jwt: %s with %s key", a.name, priv.PublicKey().Parameters())
+	}
+	return priv.Sign(rand.Reader, signingInput, nil)
+}
+
+// Verify implements the jwt.Alg interface.
+func (a alg) Verify(key crypto.PublicKey, signingInput, sig []byte) error {
+	pub, ok := key.(*mldsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("jwt: %s with unsupported key type %T", a.name, key)
+	}
+	if pub.Parameters() != a.params || len(sig) != a.params.SignatureSize() {
+		return jwt.ErrSigMiss
+	}
+	if mldsa.Verify(pub, signingInput, sig, nil) != nil {
+		return jwt.ErrSigMiss
+	}
+	return nil
+}
+
+// DecodeJWK implements the jwt.JWKDecoder interface. Keys of type "AKP"
+// (Algorithm Key Pair) identify the parameter set with the "alg" field, and
+// they have the encoded public key in the "pub" field.
+func (a alg) DecodeJWK(data json.RawMessage) (crypto.PublicKey, error) {
+	var j struct {
+		Kty, Alg, Pub string
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	if j.Kty != "AKP" || j.Alg != a.name {
+		return nil, nil // not applicable
+	}
+
+	bytes, err := base64.RawURLEncoding.DecodeString(j.Pub)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %s JWK with malformed \"pub\" field: %w", a.name, err)
+	}
+	key, err := mldsa.NewPublicKey(a.params, bytes)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %s JWK: %w", a.name, err)
+	}
+	return key, nil
+}
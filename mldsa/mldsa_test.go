@@ -0,0 +1,93 @@
+//go:build go1.27
+
+package mldsa
+
+import (
+	"crypto"
+	"crypto/mldsa"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+func TestSignCheck(t *testing.T) {
+	for name, params := range map[string]mldsa.Parameters{
+		MLDSA44: mldsa.MLDSA44(),
+		MLDSA65: mldsa.MLDSA65(),
+		MLDSA87: mldsa.MLDSA87(),
+	} {
+		key, err := mldsa.GenerateKey(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := jwt.Claims{KeyID: "pq1"}
+		c.Subject = "Barry"
+		token, err := c.Sign(name, key)
+		if err != nil {
+			t.Fatalf("%s sign error: %s", name, err)
+		}
+
+		keys := jwt.KeyRegister{Others: []crypto.PublicKey{key.PublicKey()}}
+		got, err := keys.Check(token)
+		if err != nil {
+			t.Fatalf("%s check error: %s", name, err)
+		}
+		if got.Subject != "Barry" {
+			t.Errorf("%s got subject %q, want Barry", name, got.Subject)
+		}
+
+		other, err := mldsa.GenerateKey(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys.Others[0] = other.PublicKey()
+		if _, err := keys.Check(token); err != jwt.ErrSigMiss {
+			t.Errorf("%s got error %v for other key, want %v", name, err, jwt.ErrSigMiss)
+		}
+	}
+}
+
+func TestSignParamsMismatch(t *testing.T) {
+	key, err := mldsa.GenerateKey(mldsa.MLDSA44())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := new(jwt.Claims).Sign(MLDSA65, key); err == nil {
+		t.Error("no error for ML-DSA-44 key with ML-DSA-65")
+	}
+}
+
+func TestLoadJWK(t *testing.T) {
+	key, err := mldsa.GenerateKey(mldsa.MLDSA65())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := fmt.Sprintf(`{"keys": [{"kty": "AKP", "alg": "ML-DSA-65", "kid": "pq1", "pub": %q}]}`,
+		base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()))
+
+	var keys jwt.KeyRegister
+	if n, err := keys.LoadJWK([]byte(jwk)); n != 1 || err != nil {
+		t.Fatalf("got (%d, %v), want (1, nil)", n, err)
+	}
+	if len(keys.OtherIDs) != 1 || keys.OtherIDs[0] != "pq1" {
+		t.Errorf("got key IDs %q, want pq1", keys.OtherIDs)
+	}
+
+	token, err := (&jwt.Claims{KeyID: "pq1"}).Sign(MLDSA65, key)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := keys.Check(token); err != nil {
+		t.Error("check error:", err)
+	}
+
+	// public key size of another parameter set
+	bad := fmt.Sprintf(`{"kty": "AKP", "alg": "ML-DSA-44", "pub": %q}`,
+		base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()))
+	if n, err := keys.LoadJWK([]byte(bad)); n != 0 || err == nil {
+		t.Errorf("got (%d, %v) for wrong key size, want error", n, err)
+	}
+}
@@ -0,0 +1,161 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// AuthorizationDetailsClaim is the claim name from RFC 9396, section 9.1.
+const AuthorizationDetailsClaim = "authorization_details"
+
+var errDetailType = errors.New("jwt: authorization detail without type")
+
+// AuthorizationDetail is an entry of the authorization_details claim, with the
+// common data fields from “OAuth 2.0 Rich Authorization Requests” RFC 9396,
+// section 2.2. The semantics of each field depend on the Type.
+type AuthorizationDetail struct {
+	Type       string   `json:"type"`
+	Locations  []string `json:"locations,omitempty"`
+	Actions    []string `json:"actions,omitempty"`
+	DataTypes  []string `json:"datatypes,omitempty"`
+	Identifier string   `json:"identifier,omitempty"`
+	Privileges []string `json:"privileges,omitempty"`
+
+	// Raw has the JSON object as is, for any fields specific to the Type.
+	// Encoding applies the fields above on top of Raw.
+	Raw json.RawMessage `json:"-"`
+}
+
+// MarshalJSON honors the json.Marshaler interface.
+func (d AuthorizationDetail) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{})
+	if len(d.Raw) != 0 {
+		if err := json.Unmarshal(d.Raw, &m); err != nil {
+			return nil, err
+		}
+		for _, name := range []string{"type", "locations", "actions", "datatypes", "identifier", "privileges"} {
+			delete(m, name)
+		}
+	}
+
+	type fields AuthorizationDetail // prevents recursion
+	common, err := json.Marshal(fields(d))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(common, &m); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON honors the json.Unmarshaler interface.
+func (d *AuthorizationDetail) UnmarshalJSON(data []byte) error {
+	type fields AuthorizationDetail // prevents recursion
+	if err := json.Unmarshal(data, (*fields)(d)); err != nil {
+		return err
+	}
+	if d.Type == "" {
+		return errDetailType
+	}
+	d.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// AuthorizationDetails is the content of an authorization_details claim.
+type AuthorizationDetails []AuthorizationDetail
+
+// AuthorizationDetails returns the authorization_details claim, if any. Each
+// entry must have a type. The return is nil without error when the claim is
+// not present.
+func (c *Claims) AuthorizationDetails() (AuthorizationDetails, error) {
+	v, ok := c.Set[AuthorizationDetailsClaim]
+	if !ok {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var details AuthorizationDetails
+	if err := json.Unmarshal(data, &details); err != nil {
+		return nil, fmt.Errorf("jwt: malformed %s claim: %w", AuthorizationDetailsClaim, err)
+	}
+	return details, nil
+}
+
+// SetAuthorizationDetails defines the authorization_details claim in Set, in
+// the same form as a Check would produce.
+func (c *Claims) SetAuthorizationDetails(details AuthorizationDetails) error {
+	for _, d := range details {
+		if d.Type == "" {
+			return errDetailType
+		}
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	var a []interface{}
+	if err := json.Unmarshal(data, &a); err != nil {
+		return err
+	}
+	if c.Set == nil {
+		c.Set = make(map[string]interface{})
+	}
+	c.Set[AuthorizationDetailsClaim] = a
+	return nil
+}
+
+// OfType returns the entries with the type, in order of appearance.
+func (details AuthorizationDetails) OfType(typ string) AuthorizationDetails {
+	var filtered AuthorizationDetails
+	for _, d := range details {
+		if d.Type == typ {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
+}
+
+// Permits returns whether any of the entries with the type lists the action
+// and the location. Empty strings match any entry for their respective field.
+func (details AuthorizationDetails) Permits(typ, action, location string) bool {
+	for _, d := range details {
+		if d.Type == typ && (action == "" || contains(d.Actions, action)) && (location == "" || contains(d.Locations, location)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Require returns an error wrapping ErrScope when no single entry of the type
+// lists all of the actions and all of the locations, such that Handler.Func
+// can respond with a 403 (Forbidden).
+func (details AuthorizationDetails) Require(typ string, actions, locations []string) error {
+	for _, d := range details.OfType(typ) {
+		if containsAll(d.Actions, actions) && containsAll(d.Locations, locations) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: want %s authorization with actions %q at locations %q", ErrScope, typ, actions, locations)
+}
+
+func contains(a []string, s string) bool {
+	for _, o := range a {
+		if o == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(a, subset []string) bool {
+	for _, s := range subset {
+		if !contains(a, s) {
+			return false
+		}
+	}
+	return true
+}
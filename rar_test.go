@@ -0,0 +1,100 @@
+package jwt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Example from RFC 9396, section 2.
+const rarExample = `{"sub":"24400320","authorization_details":[
+	{"type":"account_information",
+	 "actions":["list_accounts","read_balances","read_transactions"],
+	 "locations":["https://example.com/accounts"]},
+	{"type":"payment_initiation",
+	 "actions":["initiate","status","cancel"],
+	 "locations":["https://example.com/payments"],
+	 "instructedAmount":{"currency":"EUR","amount":"123.50"},
+	 "creditorName":"Merchant A",
+	 "creditorAccount":{"iban":"DE02100100109307118603"},
+	 "remittanceInformationUnstructured":"Ref Number Merchant"}
+]}`
+
+func TestAuthorizationDetails(t *testing.T) {
+	token, err := SignBytes([]byte(rarExample), HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := (&KeyRegister{Secrets: [][]byte{[]byte("guest")}}).Check(token)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	details, err := c.AuthorizationDetails()
+	if err != nil {
+		t.Fatal("authorization details error:", err)
+	}
+	if len(details) != 2 {
+		t.Fatalf("got %d authorization details, want 2", len(details))
+	}
+
+	payments := details.OfType("payment_initiation")
+	if len(payments) != 1 {
+		t.Fatalf("got %d payment initiations, want 1", len(payments))
+	}
+	if want := []string{"initiate", "status", "cancel"}; !reflect.DeepEqual(payments[0].Actions, want) {
+		t.Errorf("got actions %q, want %q", payments[0].Actions, want)
+	}
+
+	if !details.Permits("account_information", "read_balances", "https://example.com/accounts") {
+		t.Error("read_balances not permitted")
+	}
+	if !details.Permits("payment_initiation", "cancel", "") {
+		t.Error("cancel not permitted at any location")
+	}
+	if details.Permits("account_information", "initiate", "") {
+		t.Error("initiate permitted on account_information")
+	}
+	if details.Permits("payment_initiation", "status", "https://example.com/accounts") {
+		t.Error("payment status permitted at the accounts location")
+	}
+
+	if err := details.Require("payment_initiation", []string{"initiate", "status"}, []string{"https://example.com/payments"}); err != nil {
+		t.Error("require error:", err)
+	}
+	err = details.Require("account_information", []string{"list_accounts", "initiate"}, nil)
+	if !errors.Is(err, ErrScope) {
+		t.Errorf("got error %v, want ErrScope", err)
+	}
+
+	// round trip keeps the type-specific fields
+	var o Claims
+	if err := o.SetAuthorizationDetails(details); err != nil {
+		t.Fatal("set error:", err)
+	}
+	if !reflect.DeepEqual(o.Set[AuthorizationDetailsClaim], c.Set[AuthorizationDetailsClaim]) {
+		t.Errorf("got claim %v, want %v", o.Set[AuthorizationDetailsClaim], c.Set[AuthorizationDetailsClaim])
+	}
+}
+
+func TestAuthorizationDetailsErrors(t *testing.T) {
+	var c Claims
+	if details, err := c.AuthorizationDetails(); details != nil || err != nil {
+		t.Errorf("got %v, %v without claim, want nil, nil", details, err)
+	}
+
+	golden := []interface{}{
+		"payment_initiation",
+		[]interface{}{map[string]interface{}{"actions": []interface{}{"read"}}},
+		[]interface{}{map[string]interface{}{"type": "x", "actions": "read"}},
+	}
+	for _, v := range golden {
+		c.Set = map[string]interface{}{AuthorizationDetailsClaim: v}
+		if _, err := c.AuthorizationDetails(); err == nil {
+			t.Errorf("%v: no error", v)
+		}
+	}
+
+	if err := c.SetAuthorizationDetails(AuthorizationDetails{{Actions: []string{"read"}}}); err != errDetailType {
+		t.Errorf("got error %v, want %v", err, errDetailType)
+	}
+}
@@ -2,17 +2,30 @@ package jwt
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pascaldekloe/jwt/internal/cbor"
 )
 
 // KeyRegister is a collection of recognized credentials.
@@ -21,6 +34,7 @@ type KeyRegister struct {
 	EdDSAs  []ed25519.PublicKey // EdDSA credentials
 	RSAs    []*rsa.PublicKey    // RSA credentials
 	Secrets [][]byte            // HMAC credentials
+	Others  []crypto.PublicKey  // credentials for RegisterAlg algorithms
 
 	// Optional key identification. See Claims.KeyID for details.
 	// Non-empty strings match the respective key or secret by index.
@@ -28,123 +42,677 @@ type KeyRegister struct {
 	EdDSAIDs  []string // EdDSA key ID mapping
 	RSAIDs    []string // RSAs key ID mapping
 	SecretIDs []string // Secrets key ID mapping
+	OtherIDs  []string // Others key ID mapping
+
+	// Keys for encryption only never verify any signature. LoadJWK puts
+	// keys with "enc" as their "use", and keys with "key_ops" without
+	// "verify" in here, instead of the slots above.
+	Encryptions   []crypto.PublicKey
+	EncryptionIDs []string // Encryptions key ID mapping
+
+	// Optional public key pinning, by the SHA-256 of each DER-encoded
+	// SubjectPublicKeyInfo. See SPKIPin for details. When not empty,
+	// then keys without a pin can not verify any signature, and that
+	// includes all of the Secrets.
+	PinnedSPKIs [][sha256.Size]byte
+
+	// Optional constraints on certificates from LoadPEM. Nil accepts
+	// the public key of any certificate as is.
+	CertPolicy *CertPolicy
+
+	// StrictHMAC rejects secrets shorter than the output size of the hash
+	// function. “The key for HMAC can be of any length (keys longer than B
+	// bytes are first hashed using H). However, less than L bytes is
+	// strongly discouraged as it would decrease the security strength of
+	// the function.” — RFC 2104, section 3
+	//
+	// LoadJWK and LoadCOSE fail on secrets shorter than 32 bytes, i.e.,
+	// the output size of HS256. Check ignores any of the Secrets shorter
+	// than the output size of the algorithm in use, and HMAC tokens get
+	// an AlgError when the register has no Secrets at all.
+	StrictHMAC bool
+
+	// Optional constraint on the "cty" header, i.e., Claims.ContentType.
+	// Tokens with a media type not in the list get a ContentTypeError.
+	// The empty string matches tokens without "cty". Matches are case-
+	// insensitive, with the "application/" prefix optional conform RFC
+	// 7515, subsection 4.1.10. Nil accepts any content type.
+	ContentTypes []string
+
+	// DetailedMiss makes the Check functions return a *MissError, with
+	// the reason why none of the keys verified the signature, instead of
+	// ErrSigMiss as is. Either way, errors.Is(err, ErrSigMiss) holds.
+	DetailedMiss bool
+
+	// UniformTiming makes the Check functions verify the signature with
+	// a dummy key when none of the keys apply, such that the response
+	// time does not reveal to a probe whether the register has any keys
+	// for the algorithm. Others get no dummy, as their key type is not
+	// known. Tokens for an algorithm which is not supported at all fail
+	// early regardless, with an AlgError.
+	UniformTiming bool
+}
+
+// ContentTypeError signals a "cty" header not in KeyRegister.ContentTypes.
+type ContentTypeError string
+
+// Error honors the error interface.
+func (e ContentTypeError) Error() string {
+	return fmt.Sprintf("jwt: content type %q not accepted", string(e))
+}
+
+// MissError is the ErrSigMiss of a KeyRegister with DetailedMiss set.
+type MissError struct {
+	Alg string // "alg" header
+	// Field is the name of the KeyRegister field for the algorithm, i.e.,
+	// one of "ECDSAs", "EdDSAs", "RSAs", "Secrets" or "Others".
+	Field string
+	// KeyID is the "kid" header, if any. KeyIDKnown is whether any of
+	// the keys in Field has the identifier.
+	KeyID      string
+	KeyIDKnown bool
+	// Candidates is the number of keys which failed on the signature.
+	// Secrets skipped by StrictHMAC are not included.
+	Candidates int
+}
+
+// Error honors the error interface.
+func (e *MissError) Error() string {
+	switch {
+	case e.Candidates == 0:
+		return fmt.Sprintf("jwt: signature mismatch: no %s keys for %s", e.Field, e.Alg)
+	case e.KeyID != "" && !e.KeyIDKnown:
+		return fmt.Sprintf("jwt: signature mismatch: key ID %q unknown, with %d %s keys tried", e.KeyID, e.Candidates, e.Field)
+	case e.Candidates == 1:
+		return fmt.Sprintf("jwt: signature mismatch on 1 %s candidate", e.Field)
+	default:
+		return fmt.Sprintf("jwt: signature mismatch on %d %s candidates", e.Candidates, e.Field)
+	}
+}
+
+// Is returns whether target is ErrSigMiss, for use with errors.Is.
+func (e *MissError) Is(target error) bool {
+	return target == ErrSigMiss
+}
+
+// AcceptContentType returns whether cty matches ContentTypes, conform the
+// Check functions.
+func (keys *KeyRegister) AcceptContentType(cty string) bool {
+	if keys.ContentTypes == nil {
+		return true
+	}
+	for _, s := range keys.ContentTypes {
+		if strings.EqualFold(mediaType(s), mediaType(cty)) {
+			return true
+		}
+	}
+	return false
+}
+
+// MediaType returns the cty value in full.
+// “To keep messages compact in common situations, it is RECOMMENDED that
+// producers omit an "application/" prefix of a media type value in a "cty"
+// Header Parameter when no other '/' appears in the media type value. A
+// recipient using the media type value MUST treat it as if "application/"
+// were prepended to any "cty" value not containing a '/'.”
+// — “JSON Web Signature (JWS)” RFC 7515, subsection 4.1.10
+func mediaType(cty string) string {
+	if cty == "" || strings.IndexByte(cty, '/') >= 0 {
+		return cty
+	}
+	return "application/" + cty
+}
+
+// CertPolicy constrains the certificates which may provide keys. Certificates
+// must be valid at the current time, they must have the digitalSignature key
+// usage, and they must not be self-signed, unless AllowSelfSigned.
+type CertPolicy struct {
+	// AllowSelfSigned permits certificates which are signed by their
+	// own key.
+	AllowSelfSigned bool
+
+	// Skip leaves offenders out, instead of a rejection with LoadPEM.
+	Skip bool
+
+	// Clock provides the time for validity checks. Nil defaults to
+	// time.Now.
+	Clock func() time.Time
+}
+
+// CertError signals a certificate in violation of a CertPolicy.
+type CertError struct {
+	Cert   *x509.Certificate
+	Reason string
+}
+
+// Error honors the error interface.
+func (e *CertError) Error() string {
+	return fmt.Sprintf("jwt: certificate %q (serial %s) rejected: %s", e.Cert.Subject.String(), e.Cert.SerialNumber, e.Reason)
+}
+
+// Eval returns the policy violation, if any. Self-signed certificates need no
+// CA constraints, so CheckSignatureFrom does not apply.
+func (p *CertPolicy) eval(c *x509.Certificate) *CertError {
+	now := time.Now()
+	if p.Clock != nil {
+		now = p.Clock()
+	}
+	switch {
+	case now.Before(c.NotBefore):
+		return &CertError{c, "not valid before " + c.NotBefore.UTC().Format(time.RFC3339)}
+	case now.After(c.NotAfter):
+		return &CertError{c, "expired at " + c.NotAfter.UTC().Format(time.RFC3339)}
+	case c.KeyUsage&x509.KeyUsageDigitalSignature == 0:
+		return &CertError{c, "no digitalSignature key usage"}
+	case !p.AllowSelfSigned && bytes.Equal(c.RawIssuer, c.RawSubject) && c.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature) == nil:
+		return &CertError{c, "self-signed"}
+	}
+	return nil
+}
+
+// SPKIPin returns the SHA-256 of the DER-encoded SubjectPublicKeyInfo, for use
+// in KeyRegister.PinnedSPKIs. The key types are conform x509.MarshalPKIXPublicKey.
+// The base64 encoding of the return is equal to the pin-sha256 of HTTP Public
+// Key Pinning, as described in RFC 7469.
+func SPKIPin(pub crypto.PublicKey) (pin [sha256.Size]byte, err error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return pin, err
+	}
+	return sha256.Sum256(der), nil
+}
+
+// Pinned returns whether the key is allowed to verify signatures.
+func (keys *KeyRegister) pinned(pub crypto.PublicKey) bool {
+	if len(keys.PinnedSPKIs) == 0 {
+		return true
+	}
+	pin, err := SPKIPin(pub)
+	if err != nil {
+		return false
+	}
+	for _, p := range keys.PinnedSPKIs {
+		if p == pin {
+			return true
+		}
+	}
+	return false
 }
 
 // Check parses a JWT if, and only if, the signature checks out.
 // Use Claims.Valid to complete the verification.
 func (keys *KeyRegister) Check(token []byte) (*Claims, error) {
+	return observe(keys.check(token))
+}
+
+// Acceptance describes which key of a KeyRegister verified a token, e.g., for
+// audit logging, or to confirm that a key rotation took effect.
+type Acceptance struct {
+	// Alg is the algorithm from the JOSE header.
+	Alg string
+	// KeyType is the name of the KeyRegister field with the key, i.e.,
+	// one of "ECDSAs", "EdDSAs", "RSAs", "Secrets" or "Others".
+	KeyType string
+	// KeyIndex is the position of the key in its KeyType field.
+	KeyIndex int
+	// KeyID is the identifier of the key from the register, if any.
+	KeyID string
+}
+
+// Set records the key position conform ids.
+func (r *Acceptance) set(keyType string, index int, ids []string) {
+	if r == nil {
+		return
+	}
+	r.KeyType = keyType
+	r.KeyIndex = index
+	if index < len(ids) {
+		r.KeyID = ids[index]
+	}
+}
+
+// CheckAcceptance is like Check, with an Acceptance on success.
+func (keys *KeyRegister) CheckAcceptance(token []byte) (*Claims, *Acceptance, error) {
+	c := new(Claims)
+	report := new(Acceptance)
+	firstDot, lastDot, sig, alg, err := keys.verify(c, token, report)
+	if err == nil {
+		report.Alg = alg
+		err = c.applyPayload(token[firstDot+1:lastDot], sig)
+	}
+	if err != nil {
+		c, report = nil, nil
+	}
+	c, err = observe(c, alg, err)
+	return c, report, err
+}
+
+// CheckRegistered is like Check, yet it reads the Registered claims only,
+// which saves the memory allocation of Set. Raw has the payload for any other
+// claims. Use Claims.Valid to complete the verification.
+func (keys *KeyRegister) CheckRegistered(token []byte) (*Claims, error) {
+	c := new(Claims)
+	firstDot, lastDot, sig, alg, err := keys.verify(c, token, nil)
+	if err == nil {
+		err = c.applyRegistered(token[firstDot+1:lastDot], sig)
+	}
+	if err != nil {
+		c = nil
+	}
+	return observe(c, alg, err)
+}
+
+func (keys *KeyRegister) check(token []byte) (c *Claims, alg string, err error) {
+	c = new(Claims)
+	firstDot, lastDot, sig, alg, err := keys.verify(c, token, nil)
+	if err != nil {
+		return nil, alg, err
+	}
+	return c, alg, c.applyPayload(token[firstDot+1:lastDot], sig)
+}
+
+// VerifyBytes returns the payload of a JWS if, and only if, the signature
+// checks out. The payload is not interpreted in any way, which makes it fit
+// for content other than a JSON claims set. Note that StrictJSON only applies
+// to the JOSE header in this case. Size limits and the JOSE header constraints
+// apply the same as with Check.
+func (keys *KeyRegister) VerifyBytes(token []byte) (payload []byte, err error) {
 	var c Claims
-	firstDot, lastDot, sig, alg, err := c.scan(token)
+	firstDot, lastDot, sig, alg, err := keys.verify(&c, token, nil)
+	if err == nil {
+		buf := sig[:cap(sig)]
+		var n int
+		n, err = decode(buf, token[firstDot+1:lastDot])
+		if err != nil {
+			err = fmt.Errorf("jwt: malformed payload: %w", err)
+		} else {
+			payload = buf[:n]
+		}
+	}
+	if CheckHook != nil {
+		CheckHook(alg, "", err)
+	}
+	return payload, err
+}
+
+// CheckAll applies Check on each of the tokens, in parallel for larger
+// batches, with up to GOMAXPROCS goroutines. Both return slices are index
+// aligned with tokens. Either the claims or the error is nil per token.
+func (keys *KeyRegister) CheckAll(tokens [][]byte) ([]*Claims, []error) {
+	claims := make([]*Claims, len(tokens))
+	errs := make([]error, len(tokens))
+
+	workers := runtime.GOMAXPROCS(0)
+	if n := len(tokens) / checkAllMinPerWorker; n < workers {
+		workers = n
+	}
+	check := func(i int) {
+		c, err := keys.Check(tokens[i])
+		if err != nil {
+			c = nil // payload errors come with claims
+		}
+		claims[i], errs[i] = c, err
+	}
+	if workers < 2 {
+		for i := range tokens {
+			check(i)
+		}
+		return claims, errs
+	}
+
+	var next int64 = -1 // index counter
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(tokens) {
+					return
+				}
+				check(i)
+			}
+		}()
+	}
+	wg.Wait()
+	return claims, errs
+}
+
+// CheckAllMinPerWorker is the batch size threshold for each goroutine of
+// CheckAll, as concurrency does not pay off for a few tokens.
+const checkAllMinPerWorker = 8
+
+// CheckJSON parses a JWT in the JWS JSON Serialization, either general or
+// flattened, if, and only if, any of the signatures checks out. See RFC 7515,
+// subsection 7.2. Each signature applies like Check does with the compact
+// serialization. The unprotected "header" parameters are ignored, which means
+// that "alg" and "kid" must be in the protected header. When none of the
+// signatures checks out, then the return has the error of the last one. Use
+// Claims.Valid to complete the verification.
+func (keys *KeyRegister) CheckJSON(serialization []byte) (*Claims, error) {
+	type signature struct {
+		Protected string `json:"protected"`
+		Signature string `json:"signature"`
+	}
+	var j struct {
+		Payload    *string     `json:"payload"`
+		Signatures []signature `json:"signatures"`
+		signature
+	}
+	if err := json.Unmarshal(serialization, &j); err != nil {
+		return nil, fmt.Errorf("jwt: malformed JWS JSON serialization: %w", err)
+	}
+	if j.Payload == nil {
+		return nil, errors.New("jwt: JWS JSON serialization without payload")
+	}
+	if j.Signatures == nil {
+		// flattened syntax
+		j.Signatures = []signature{j.signature}
+	}
+
+	var c *Claims
+	var alg string
+	err := ErrSigMiss
+	for _, sig := range j.Signatures {
+		token := sig.Protected + "." + *j.Payload + "." + sig.Signature
+		c, alg, err = keys.check([]byte(token))
+		if err == nil {
+			break
+		}
+	}
+	return observe(c, alg, err)
+}
+
+// Verify applies the appropriate key on the signature. Claims gets the header
+// fields, without the payload.
+func (keys *KeyRegister) verify(c *Claims, token []byte, report *Acceptance) (firstDot, lastDot int, sig []byte, alg string, err error) {
+	firstDot, lastDot, sig, alg, err = c.scan(token)
 	if err != nil {
-		return nil, err
+		return 0, 0, nil, alg, err
 	}
+	if !keys.AcceptContentType(c.ContentType) {
+		return 0, 0, nil, alg, ContentTypeError(c.ContentType)
+	}
+
+	if err := keys.verifySig(alg, c.KeyID, token[:lastDot], nil, sig, report); err != nil {
+		return 0, 0, nil, alg, err
+	}
+	return firstDot, lastDot, sig, alg, nil
+}
+
+// VerifySignature checks sig on the signing input of a format other than JWS,
+// such as COSE, with the key ID selection, PinnedSPKIs, StrictHMAC, DetailedMiss
+// and UniformTiming of the register. ContentTypes is up to the caller, with
+// AcceptContentType.
+func (keys *KeyRegister) VerifySignature(alg, kid string, input, sig []byte) error {
+	// capacity of sig may not be ours to use
+	return keys.verifySig(alg, kid, input, nil, sig[:len(sig):len(sig)], nil)
+}
 
+// VerifySig applies the appropriate key on the signature of alg, with the key
+// ID selection, PinnedSPKIs, StrictHMAC, DetailedMiss and UniformTiming of the
+// register. The signing input is either input as is, or the digest sum of its
+// hash function, in which case input is nil. Sum buffers may use the capacity
+// of sig.
+func (keys *KeyRegister) verifySig(alg, kid string, input, sum, sig []byte, report *Acceptance) error {
 	if alg == EdDSA {
+		if input == nil {
+			return errDigestAlg
+		}
 		keyOptions := keys.EdDSAs
-		if c.KeyID != "" {
-			for i, kid := range keys.EdDSAIDs {
-				if kid == c.KeyID && i < len(keyOptions) {
+		var offset int
+		var known bool // key ID match
+		if kid != "" {
+			for i, id := range keys.EdDSAIDs {
+				if id == kid && i < len(keyOptions) {
 					keyOptions = keyOptions[i : i+1]
+					offset = i
+					known = true
 					break
 				}
 			}
 		}
 
-		for _, key := range keyOptions {
-			if ed25519.Verify(key, token[:lastDot], sig) {
-				return &c, c.applyPayload(token[firstDot+1:lastDot], sig)
+		for j, key := range keyOptions {
+			if ed25519.Verify(key, input, sig) && keys.pinned(key) {
+				report.set("EdDSAs", offset+j, keys.EdDSAIDs)
+				return nil
 			}
 		}
-		return nil, ErrSigMiss
+		if len(keyOptions) == 0 && keys.UniformTiming {
+			ed25519.Verify(dummyEdDSAKey, input, sig)
+		}
+		return keys.miss(alg, "EdDSAs", len(keyOptions), kid, known)
 	}
 
 	switch hash, err := hashLookup(alg, HMACAlgs); err.(type) {
 	case nil:
+		if input == nil {
+			return errDigestAlg
+		}
+		if keys.StrictHMAC && len(keys.Secrets) == 0 {
+			return AlgError(alg)
+		}
 		keyOptions := keys.Secrets
-		if c.KeyID != "" {
-			for i, kid := range keys.SecretIDs {
-				if kid == c.KeyID && i < len(keyOptions) {
+		var offset int
+		var known bool // key ID match
+		if len(keys.PinnedSPKIs) != 0 {
+			keyOptions = nil // no public key
+		}
+		if kid != "" {
+			for i, id := range keys.SecretIDs {
+				if id == kid && i < len(keyOptions) {
 					keyOptions = keyOptions[i : i+1]
+					offset = i
+					known = true
 					break
 				}
 			}
 		}
 
-		for _, secret := range keyOptions {
+		var tried int // StrictHMAC skips
+		for j, secret := range keyOptions {
+			if keys.StrictHMAC && len(secret) < hash.Size() {
+				continue
+			}
+			tried++
 			digest := hmac.New(hash.New, secret)
-			digest.Write(token[:lastDot])
+			digest.Write(input)
 			if hmac.Equal(sig, digest.Sum(sig[len(sig):])) {
-				return &c, c.applyPayload(token[firstDot+1:lastDot], sig)
+				report.set("Secrets", offset+j, keys.SecretIDs)
+				return nil
 			}
 		}
-		return nil, ErrSigMiss
+		if tried == 0 && keys.UniformTiming {
+			digest := hmac.New(hash.New, make([]byte, hash.Size()))
+			digest.Write(input)
+			hmac.Equal(sig, digest.Sum(sig[len(sig):]))
+		}
+		return keys.miss(alg, "Secrets", tried, kid, known)
 
 	case AlgError:
 		break // next
 	default:
-		return nil, err
+		return err
 	}
 
 	switch hash, err := hashLookup(alg, RSAAlgs); err.(type) {
 	case nil:
 		keyOptions := keys.RSAs
-		if c.KeyID != "" {
-			for i, kid := range keys.RSAIDs {
-				if kid == c.KeyID && i < len(keyOptions) {
+		var offset int
+		var known bool // key ID match
+		if kid != "" {
+			for i, id := range keys.RSAIDs {
+				if id == kid && i < len(keyOptions) {
 					keyOptions = keyOptions[i : i+1]
+					offset = i
+					known = true
 					break
 				}
 			}
 		}
 
-		digest := hash.New()
-		digest.Write(token[:lastDot])
-		digestSum := digest.Sum(sig[len(sig):])
-		for _, key := range keyOptions {
+		digestSum := sum
+		if digestSum == nil {
+			digest := hash.New()
+			digest.Write(input)
+			digestSum = digest.Sum(sig[len(sig):])
+		}
+		for j, key := range keyOptions {
 			if alg != "" && alg[0] == 'P' {
 				err = rsa.VerifyPSS(key, hash, digestSum, sig, &pSSOptions)
 			} else {
 				err = rsa.VerifyPKCS1v15(key, hash, digestSum, sig)
 			}
-			if err == nil {
-				return &c, c.applyPayload(token[firstDot+1:lastDot], sig)
+			if err == nil && keys.pinned(key) {
+				report.set("RSAs", offset+j, keys.RSAIDs)
+				return nil
 			}
 		}
-		return nil, ErrSigMiss
+		if len(keyOptions) == 0 && keys.UniformTiming {
+			if alg != "" && alg[0] == 'P' {
+				rsa.VerifyPSS(dummyRSAKey(sig), hash, digestSum, sig, &pSSOptions)
+			} else {
+				rsa.VerifyPKCS1v15(dummyRSAKey(sig), hash, digestSum, sig)
+			}
+		}
+		return keys.miss(alg, "RSAs", len(keyOptions), kid, known)
 
 	case AlgError:
 		break // next
 	default:
-		return nil, err
+		return err
 	}
 
-	switch hash, err := hashLookup(alg, ECDSAAlgs); err {
+	switch hash, err := hashLookup(alg, ECDSAAlgs); err.(type) {
 	case nil:
 		keyOptions := keys.ECDSAs
-		if c.KeyID != "" {
-			for i, kid := range keys.ECDSAIDs {
-				if kid == c.KeyID && i < len(keyOptions) {
+		var offset int
+		var known bool // key ID match
+		if kid != "" {
+			for i, id := range keys.ECDSAIDs {
+				if id == kid && i < len(keyOptions) {
 					keyOptions = keyOptions[i : i+1]
+					offset = i
+					known = true
 					break
 				}
 			}
 		}
 
-		r := new(big.Int).SetBytes(sig[:len(sig)/2])
-		s := new(big.Int).SetBytes(sig[len(sig)/2:])
-		digest := hash.New()
-		digest.Write(token[:lastDot])
-		digestSum := digest.Sum(sig[:0])
-		for _, key := range keyOptions {
-			if ecdsa.Verify(key, digestSum, r, s) {
-				return &c, c.applyPayload(token[firstDot+1:lastDot], sig)
+		digestSum := sum
+		if digestSum == nil {
+			digest := hash.New()
+			digest.Write(input)
+			digestSum = digest.Sum(sig[len(sig):])
+		}
+		for j, key := range keyOptions {
+			if ecdsaVerify(key, digestSum, sig) && keys.pinned(key) {
+				report.set("ECDSAs", offset+j, keys.ECDSAIDs)
+				return nil
 			}
 		}
-		return nil, ErrSigMiss
+		if len(keyOptions) == 0 && keys.UniformTiming {
+			ecdsaVerify(dummyECDSAKey(sig), digestSum, sig)
+		}
+		return keys.miss(alg, "ECDSAs", len(keyOptions), kid, known)
 
+	case AlgError:
+		break // next
 	default:
-		return nil, err
+		return err
+	}
+
+	a, err := algLookup(alg)
+	if err != nil {
+		return err
+	}
+	keyOptions := keys.Others
+	var offset int
+	var known bool // key ID match
+	if kid != "" {
+		for i, id := range keys.OtherIDs {
+			if id == kid && i < len(keyOptions) {
+				keyOptions = keyOptions[i : i+1]
+				offset = i
+				known = true
+				break
+			}
+		}
 	}
+
+	digestSum := sum
+	if digestSum == nil {
+		digestSum = input
+		if hash := a.Hash(); hash != 0 {
+			digest := hash.New()
+			digest.Write(input)
+			digestSum = digest.Sum(sig[len(sig):])
+		}
+	}
+	for j, key := range keyOptions {
+		if a.Verify(key, digestSum, sig) == nil && keys.pinned(key) {
+			report.set("Others", offset+j, keys.OtherIDs)
+			return nil
+		}
+	}
+	return keys.miss(alg, "Others", len(keyOptions), kid, known)
+}
+
+// Miss returns the signature mismatch conform DetailedMiss.
+func (keys *KeyRegister) miss(alg, field string, candidates int, kid string, kidKnown bool) error {
+	if !keys.DetailedMiss {
+		return ErrSigMiss
+	}
+	return &MissError{
+		Alg:        alg,
+		Field:      field,
+		KeyID:      kid,
+		KeyIDKnown: kidKnown,
+		Candidates: candidates,
+	}
+}
+
+// IssuerError signals that the issuer has no entry in a RegisterSet.
+type IssuerError string
+
+// Error honors the error interface.
+func (e IssuerError) Error() string {
+	return fmt.Sprintf("jwt: issuer %q not in use", string(e))
+}
+
+// RegisterSet maps trusted credentials by issuer, i.e., the "iss" claim.
+// Tokens without an issuer only match an entry with the empty string.
+type RegisterSet map[string]*KeyRegister
+
+// Check parses a JWT if, and only if, the signature checks out with a key from
+// the register of its issuer. Keys from other issuers are never considered.
+// The return is an IssuerError when the issuer is not in the set.
+// Use Claims.Valid to complete the verification.
+func (set RegisterSet) Check(token []byte) (*Claims, error) {
+	return observe(set.check(token))
+}
+
+func (set RegisterSet) check(token []byte) (c *Claims, alg string, err error) {
+	unverified, err := ParseWithoutCheck(token)
+	if err != nil {
+		return nil, "", err
+	}
+	keys := set[unverified.Issuer]
+	if keys == nil {
+		if header, err := unverified.Header(); err == nil {
+			alg = header.Alg
+		}
+		return nil, alg, IssuerError(unverified.Issuer)
+	}
+
+	c, alg, err = keys.check(token)
+	if err != nil {
+		return nil, alg, err
+	}
+	// same payload means same issuer
+	return c, alg, nil
 }
 
 var errUnencryptedPEM = errors.New("jwt: unencrypted PEM rejected due password expectation")
@@ -152,11 +720,17 @@ var errUnencryptedPEM = errors.New("jwt: unencrypted PEM rejected due password e
 // LoadPEM scans text for PEM-encoded keys. Each occurrence found is then added
 // to the register. Extraction works with certificates, public keys and private
 // keys. PEM encryption is enforced with a non-empty password to ensure security
-// when ordered.
+// when ordered. Certificates are subject to the CertPolicy, if any. Offenders
+// get a CertError. With CertPolicy.Skip, the load continues without offenders,
+// and it returns the CertError of the last one, if any, on completion.
 func (keys *KeyRegister) LoadPEM(text, password []byte) (keysAdded int, err error) {
+	var skipped *CertError // last offender with CertPolicy.Skip
 	for {
 		block, remainder := pem.Decode(text)
 		if block == nil {
+			if skipped != nil {
+				return keysAdded, skipped
+			}
 			return
 		}
 		text = remainder
@@ -181,6 +755,15 @@ func (keys *KeyRegister) LoadPEM(text, password []byte) (keysAdded int, err erro
 				return keysAdded, err
 			}
 			for _, c := range certs {
+				if keys.CertPolicy != nil {
+					if certErr := keys.CertPolicy.eval(c); certErr != nil {
+						if !keys.CertPolicy.Skip {
+							return keysAdded, certErr
+						}
+						skipped = certErr
+						continue
+					}
+				}
 				if err := keys.add(c.PublicKey, ""); err != nil {
 					return keysAdded, err
 				}
@@ -214,6 +797,8 @@ func (keys *KeyRegister) LoadPEM(text, password []byte) (keysAdded int, err erro
 	}
 }
 
+var errWeakSecret = errors.New("jwt: HMAC secret shorter than hash output rejected due StrictHMAC")
+
 func (keys *KeyRegister) add(key interface{}, kid string) error {
 	var i int
 	var ids *[]string
@@ -244,6 +829,9 @@ func (keys *KeyRegister) add(key interface{}, kid string) error {
 		keys.RSAs = append(keys.RSAs, &t.PublicKey)
 		ids = &keys.RSAIDs
 	case []byte:
+		if keys.StrictHMAC && len(t) < sha256.Size {
+			return errWeakSecret
+		}
 		i = len(keys.Secrets)
 		keys.Secrets = append(keys.Secrets, t)
 		ids = &keys.SecretIDs
@@ -251,14 +839,27 @@ func (keys *KeyRegister) add(key interface{}, kid string) error {
 		return fmt.Errorf("jwt: unsupported key type %T", t)
 	}
 
+	setKeyID(ids, i, kid)
+	return nil
+}
+
+func (keys *KeyRegister) addOther(key crypto.PublicKey, kid string) {
+	keys.Others = append(keys.Others, key)
+	setKeyID(&keys.OtherIDs, len(keys.Others)-1, kid)
+}
+
+func (keys *KeyRegister) addEncryption(key crypto.PublicKey, kid string) {
+	keys.Encryptions = append(keys.Encryptions, key)
+	setKeyID(&keys.EncryptionIDs, len(keys.Encryptions)-1, kid)
+}
+
+func setKeyID(ids *[]string, i int, kid string) {
 	if kid != "" {
 		for len(*ids) <= i {
 			*ids = append(*ids, "")
 		}
 		(*ids)[i] = kid
 	}
-
-	return nil
 }
 
 // PEM exports the (public) keys as PEM-encoded PKIX.
@@ -285,6 +886,164 @@ func (keys *KeyRegister) PEM() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// KeyRegisterState is the serialization of MarshalBinary, with public keys as
+// DER-encoded SubjectPublicKeyInfo.
+type keyRegisterState struct {
+	Version int `json:"v"`
+
+	ECDSAs      [][]byte `json:",omitempty"`
+	EdDSAs      [][]byte `json:",omitempty"`
+	RSAs        [][]byte `json:",omitempty"`
+	Secrets     [][]byte `json:",omitempty"`
+	Others      [][]byte `json:",omitempty"`
+	Encryptions [][]byte `json:",omitempty"`
+
+	ECDSAIDs      []string `json:",omitempty"`
+	EdDSAIDs      []string `json:",omitempty"`
+	RSAIDs        []string `json:",omitempty"`
+	SecretIDs     []string `json:",omitempty"`
+	OtherIDs      []string `json:",omitempty"`
+	EncryptionIDs []string `json:",omitempty"`
+
+	PinnedSPKIs  [][]byte `json:",omitempty"`
+	StrictHMAC   bool     `json:",omitempty"`
+	ContentTypes []string // nil is significant
+}
+
+// MarshalBinary honors the encoding.BinaryMarshaler interface. The snapshot
+// covers all keys, including Secrets, with their key IDs, plus PinnedSPKIs,
+// StrictHMAC and ContentTypes. CertPolicy is not included, as it applies to
+// LoadPEM only. The output contains secrets as is; store accordingly. Keys in
+// Others or Encryptions fail when x509.MarshalPKIXPublicKey does.
+func (keys *KeyRegister) MarshalBinary() ([]byte, error) {
+	state := keyRegisterState{
+		Version:       1,
+		Secrets:       keys.Secrets,
+		ECDSAIDs:      keys.ECDSAIDs,
+		EdDSAIDs:      keys.EdDSAIDs,
+		RSAIDs:        keys.RSAIDs,
+		SecretIDs:     keys.SecretIDs,
+		OtherIDs:      keys.OtherIDs,
+		EncryptionIDs: keys.EncryptionIDs,
+		StrictHMAC:    keys.StrictHMAC,
+		ContentTypes:  keys.ContentTypes,
+	}
+
+	var err error
+	marshal := func(n int, key func(i int) crypto.PublicKey) [][]byte {
+		if n == 0 || err != nil {
+			return nil
+		}
+		ders := make([][]byte, n)
+		for i := range ders {
+			ders[i], err = x509.MarshalPKIXPublicKey(key(i))
+			if err != nil {
+				err = fmt.Errorf("jwt: key register snapshot: %w", err)
+				return nil
+			}
+		}
+		return ders
+	}
+	state.ECDSAs = marshal(len(keys.ECDSAs), func(i int) crypto.PublicKey { return keys.ECDSAs[i] })
+	state.EdDSAs = marshal(len(keys.EdDSAs), func(i int) crypto.PublicKey { return keys.EdDSAs[i] })
+	state.RSAs = marshal(len(keys.RSAs), func(i int) crypto.PublicKey { return keys.RSAs[i] })
+	state.Others = marshal(len(keys.Others), func(i int) crypto.PublicKey { return keys.Others[i] })
+	state.Encryptions = marshal(len(keys.Encryptions), func(i int) crypto.PublicKey { return keys.Encryptions[i] })
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pin := range keys.PinnedSPKIs {
+		state.PinnedSPKIs = append(state.PinnedSPKIs, append([]byte(nil), pin[:]...))
+	}
+	return json.Marshal(&state)
+}
+
+var errKeyRegisterState = errors.New("jwt: malformed key register snapshot")
+
+// UnmarshalBinary honors the encoding.BinaryUnmarshaler interface. The state
+// from MarshalBinary replaces all of the keys, key IDs, PinnedSPKIs, StrictHMAC
+// and ContentTypes in the register. CertPolicy, DetailedMiss
+// and UniformTiming remain as is.
+func (keys *KeyRegister) UnmarshalBinary(data []byte) error {
+	var state keyRegisterState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("jwt: key register snapshot: %w", err)
+	}
+	if state.Version != 1 {
+		return fmt.Errorf("jwt: key register snapshot version %d not supported", state.Version)
+	}
+
+	var err error
+	parse := func(ders [][]byte, add func(key crypto.PublicKey) bool) {
+		for _, der := range ders {
+			if err != nil {
+				return
+			}
+			var key crypto.PublicKey
+			key, err = x509.ParsePKIXPublicKey(der)
+			if err != nil {
+				err = fmt.Errorf("jwt: key register snapshot: %w", err)
+			} else if !add(key) {
+				err = errKeyRegisterState
+			}
+		}
+	}
+	var r KeyRegister
+	parse(state.ECDSAs, func(key crypto.PublicKey) bool {
+		k, ok := key.(*ecdsa.PublicKey)
+		r.ECDSAs = append(r.ECDSAs, k)
+		return ok
+	})
+	parse(state.EdDSAs, func(key crypto.PublicKey) bool {
+		k, ok := key.(ed25519.PublicKey)
+		r.EdDSAs = append(r.EdDSAs, k)
+		return ok
+	})
+	parse(state.RSAs, func(key crypto.PublicKey) bool {
+		k, ok := key.(*rsa.PublicKey)
+		r.RSAs = append(r.RSAs, k)
+		return ok
+	})
+	parse(state.Others, func(key crypto.PublicKey) bool {
+		r.Others = append(r.Others, key)
+		return true
+	})
+	parse(state.Encryptions, func(key crypto.PublicKey) bool {
+		r.Encryptions = append(r.Encryptions, key)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, pin := range state.PinnedSPKIs {
+		if len(pin) != sha256.Size {
+			return errKeyRegisterState
+		}
+		var a [sha256.Size]byte
+		copy(a[:], pin)
+		r.PinnedSPKIs = append(r.PinnedSPKIs, a)
+	}
+	if len(state.ECDSAIDs) > len(r.ECDSAs) || len(state.EdDSAIDs) > len(r.EdDSAs) || len(state.RSAIDs) > len(r.RSAs) || len(state.SecretIDs) > len(state.Secrets) || len(state.OtherIDs) > len(r.Others) || len(state.EncryptionIDs) > len(r.Encryptions) {
+		return errKeyRegisterState
+	}
+
+	r.Secrets = state.Secrets
+	r.ECDSAIDs = state.ECDSAIDs
+	r.EdDSAIDs = state.EdDSAIDs
+	r.RSAIDs = state.RSAIDs
+	r.SecretIDs = state.SecretIDs
+	r.OtherIDs = state.OtherIDs
+	r.EncryptionIDs = state.EncryptionIDs
+	r.StrictHMAC = state.StrictHMAC
+	r.ContentTypes = state.ContentTypes
+	r.CertPolicy = keys.CertPolicy
+	r.DetailedMiss = keys.DetailedMiss
+	r.UniformTiming = keys.UniformTiming
+	*keys = r
+	return nil
+}
+
 func encodePEM(buf *bytes.Buffer, key interface{}) error {
 	der, err := x509.MarshalPKIXPublicKey(key)
 	if err != nil {
@@ -299,16 +1058,39 @@ func encodePEM(buf *bytes.Buffer, key interface{}) error {
 type jwk struct {
 	Keys []*jwk
 
-	Kid string
-	Kty *string
-	Crv string
+	Kid    string
+	Kty    *string
+	Crv    string
+	Use    string
+	KeyOps []string `json:"key_ops"`
 
 	K, X, Y, N, E *string
+
+	raw json.RawMessage
+}
+
+// UnmarshalJSON honors the json.Unmarshaler interface.
+func (j *jwk) UnmarshalJSON(data []byte) error {
+	type fields jwk // prevents recursion
+	j.raw = append(json.RawMessage(nil), data...)
+	return json.Unmarshal(data, (*fields)(j))
+}
+
+// JWKDecoder is an optional interface for Alg implementations, to extend
+// LoadJWK. Keys with a type or curve which is not supported by this package
+// are passed to each registered JWKDecoder, in order of algorithm name. The
+// first match goes into KeyRegister.Others.
+type JWKDecoder interface {
+	// DecodeJWK returns the public key from a JSON Web Key, or nil when
+	// the key type and/or curve doesn't apply.
+	DecodeJWK(jwk json.RawMessage) (crypto.PublicKey, error)
 }
 
 // LoadJWK adds keys from the JSON data to the register, including the key ID,
 // a.k.a "kid", when present. If the object has a "keys" attribute, then data is
 // read as a JWKS (JSON Web Key Set). Otherwise, data is read as a single JWK.
+// Keys intended for encryption, conform their "use" or "key_ops", go into
+// Encryptions.
 func (keys *KeyRegister) LoadJWK(data []byte) (keysAdded int, err error) {
 	j := new(jwk)
 	if err := json.Unmarshal(data, j); err != nil {
@@ -336,17 +1118,153 @@ var (
 
 	errJWKCurveSize = errors.New("jwt: JWK curve parameters don't match curve size")
 	errJWKCurveMiss = errors.New("jwt: JWK curve parameters are not on the curve")
+
+	errJWKUseKeyOps = errors.New("jwt: JWK \"use\" and \"key_ops\" fields are inconsistent")
 )
 
+// Encryption returns whether the key is intended for encryption only.
+func (j *jwk) encryption() (bool, error) {
+	// “The "use" and "key_ops" JWK members SHOULD NOT be used together;
+	// however, if both are used, the information they convey MUST be
+	// consistent.” — RFC 7517, subsection 4.3
+	var enc bool
+	if j.KeyOps != nil {
+		enc = true
+		for _, op := range j.KeyOps {
+			if op == "verify" || op == "sign" {
+				enc = false
+				break
+			}
+		}
+	}
+
+	switch j.Use {
+	case "":
+		return enc, nil
+	case "sig":
+		if enc {
+			return false, errJWKUseKeyOps
+		}
+		return false, nil
+	case "enc":
+		if j.KeyOps != nil && !enc {
+			return false, errJWKUseKeyOps
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("jwt: JWK with unsupported use %q", j.Use)
+	}
+}
+
+// LoadDir adds the keys from each file in directory path, as either PEM or JWK
+// content. Files with a name that starts with a dot are ignored, and so are
+// subdirectories. The file name, without its extension, is the key ID for keys
+// without one, e.g., "2024-04.pem" gives "2024-04". Files with more than one
+// key (without ID) get no key ID at all, as key IDs match the first key only.
+//
+// Symbolic links are followed, which matches the layout of Kubernetes projected
+// volumes and Vault Agent templates, where files get replaced atomically on key
+// rotation. Load into a new KeyRegister on changes to get rid of retired keys.
+func (keys *KeyRegister) LoadDir(path string) (keysAdded int, err error) {
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return 0, err
+	}
+	var skipped *CertError // last offender with CertPolicy.Skip
+	for _, info := range infos {
+		name := info.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		file := filepath.Join(path, name)
+		if info.Mode()&os.ModeSymlink != 0 {
+			info, err = os.Stat(file)
+			if err != nil {
+				return keysAdded, err
+			}
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return keysAdded, err
+		}
+		n, err := keys.loadFile(data, strings.TrimSuffix(name, filepath.Ext(name)))
+		keysAdded += n
+		if certErr, ok := err.(*CertError); ok && keys.CertPolicy != nil && keys.CertPolicy.Skip {
+			skipped = certErr
+			err = nil
+		}
+		if err != nil {
+			return keysAdded, fmt.Errorf("%w (file %q)", err, file)
+		}
+	}
+	if skipped != nil {
+		return keysAdded, skipped
+	}
+	return keysAdded, nil
+}
+
+// LoadFile adds the keys from PEM or JWK data, with kid as the default key ID.
+func (keys *KeyRegister) loadFile(data []byte, kid string) (keysAdded int, err error) {
+	file := KeyRegister{CertPolicy: keys.CertPolicy, StrictHMAC: keys.StrictHMAC}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) != 0 && trimmed[0] == '{' {
+		keysAdded, err = file.LoadJWK(trimmed)
+	} else {
+		keysAdded, err = file.LoadPEM(data, nil)
+		if err == nil && keysAdded == 0 {
+			err = errors.New("jwt: no PEM or JWK content")
+		}
+	}
+	if keysAdded != 1 {
+		kid = ""
+	}
+	keyID := func(ids []string, i int) string {
+		if i < len(ids) && ids[i] != "" {
+			return ids[i]
+		}
+		return kid
+	}
+
+	// merge; keys passed add with the same constraints already
+	for i, key := range file.ECDSAs {
+		keys.add(key, keyID(file.ECDSAIDs, i))
+	}
+	for i, key := range file.EdDSAs {
+		keys.add(key, keyID(file.EdDSAIDs, i))
+	}
+	for i, key := range file.RSAs {
+		keys.add(key, keyID(file.RSAIDs, i))
+	}
+	for i, secret := range file.Secrets {
+		keys.add(secret, keyID(file.SecretIDs, i))
+	}
+	for i, key := range file.Others {
+		keys.addOther(key, keyID(file.OtherIDs, i))
+	}
+	for i, key := range file.Encryptions {
+		keys.addEncryption(key, keyID(file.EncryptionIDs, i))
+	}
+	return keysAdded, err
+}
+
 func (keys *KeyRegister) addJWK(j *jwk) error {
 	// See RFC 7518, subsection 6.1
 
 	if j.Kty == nil {
 		return errJWKNoKty
 	}
+	enc, err := j.encryption()
+	if err != nil {
+		return err
+	}
+
+	var key interface{}
 	switch *j.Kty {
 	default:
-		return fmt.Errorf("jwt: JWK with unsupported key type %q", *j.Kty)
+		return keys.addOtherJWK(j, enc, fmt.Errorf("jwt: JWK with unsupported key type %q", *j.Kty))
 
 	case "EC":
 		var curve elliptic.Curve
@@ -358,29 +1276,33 @@ func (keys *KeyRegister) addJWK(j *jwk) error {
 		case "P-521":
 			curve = elliptic.P521()
 		default:
-			return fmt.Errorf("jwt: JWK with unsupported elliptic curve %q", j.Crv)
+			return keys.addOtherJWK(j, enc, fmt.Errorf("jwt: JWK with unsupported elliptic curve %q", j.Crv))
 		}
 
-		x, err := intParam(j.X)
+		xBytes, err := dataParam(j.X)
 		if err != nil {
 			return err
 		}
-		y, err := intParam(j.Y)
+		yBytes, err := dataParam(j.Y)
 		if err != nil {
 			return err
 		}
 
+		// “The length of this octet string MUST be the full size of a
+		// coordinate for the curve specified in the "crv" parameter.”
+		// — “JSON Web Algorithms (JWA)” RFC 7518, subsection 6.2.1.2
 		size := (curve.Params().BitSize + 7) / 8
-		xSize, ySize := (x.BitLen()+7)/8, (y.BitLen()+7)/8
-		if xSize != size || ySize != size {
+		if len(xBytes) != size || len(yBytes) != size {
 			return errJWKCurveSize
 		}
+		x := new(big.Int).SetBytes(xBytes)
+		y := new(big.Int).SetBytes(yBytes)
 
 		if !curve.IsOnCurve(x, y) {
 			return errJWKCurveMiss
 		}
 
-		keys.add(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, j.Kid)
+		key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
 
 	case "RSA":
 		n, err := intParam(j.N)
@@ -392,14 +1314,14 @@ func (keys *KeyRegister) addJWK(j *jwk) error {
 			return err
 		}
 
-		keys.add(&rsa.PublicKey{N: n, E: int(e.Int64())}, j.Kid)
+		key = &rsa.PublicKey{N: n, E: int(e.Int64())}
 
 	case "oct":
 		bytes, err := dataParam(j.K)
 		if err != nil {
 			return err
 		}
-		keys.add(bytes, j.Kid)
+		key = bytes
 
 	case "OKP":
 		switch j.Crv {
@@ -408,13 +1330,47 @@ func (keys *KeyRegister) addJWK(j *jwk) error {
 			if err != nil {
 				return err
 			}
-			keys.add(ed25519.PublicKey(bytes), j.Kid)
+			key = ed25519.PublicKey(bytes)
 		default:
-			return fmt.Errorf("jwt: JWK with unsupported elliptic curve %q", j.Crv)
+			return keys.addOtherJWK(j, enc, fmt.Errorf("jwt: JWK with unsupported elliptic curve %q", j.Crv))
 		}
 	}
 
-	return nil
+	if enc {
+		keys.addEncryption(key, j.Kid)
+		return nil
+	}
+	return keys.add(key, j.Kid)
+}
+
+// Each JWKDecoder registered gets a try. The return is unsupported when none
+// of them applies.
+func (keys *KeyRegister) addOtherJWK(j *jwk, enc bool, unsupported error) error {
+	names := make([]string, 0, len(registeredAlgs))
+	for name := range registeredAlgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		decoder, ok := registeredAlgs[name].(JWKDecoder)
+		if !ok {
+			continue
+		}
+		key, err := decoder.DecodeJWK(j.raw)
+		if err != nil {
+			return err
+		}
+		if key != nil {
+			if enc {
+				keys.addEncryption(key, j.Kid)
+			} else {
+				keys.addOther(key, j.Kid)
+			}
+			return nil
+		}
+	}
+	return unsupported
 }
 
 func dataParam(p *string) ([]byte, error) {
@@ -435,3 +1391,228 @@ func intParam(p *string) (*big.Int, error) {
 	}
 	return new(big.Int).SetBytes(bytes), nil
 }
+
+// COSE key types and parameter labels from RFC 9053, section 7.
+const (
+	coseKeyKty    = 1
+	coseKeyKid    = 2
+	coseKeyAlg    = 3
+	coseKeyKeyOps = 4
+
+	coseKtyOKP       = 1
+	coseKtyEC2       = 2
+	coseKtyRSA       = 3
+	coseKtySymmetric = 4
+)
+
+// CoseKeyAlgs maps the COSE algorithm identifiers to their JWT counterpart.
+var coseKeyAlgs = map[int64]string{
+	-7:   ES256,
+	-35:  ES384,
+	-36:  ES512,
+	-8:   EdDSA,
+	-257: RS256,
+	-258: RS384,
+	-259: RS512,
+	-37:  PS256,
+	-38:  PS384,
+	-39:  PS512,
+	5:    HS256,
+	6:    HS384,
+	7:    HS512,
+}
+
+var (
+	errCOSEKeyNoKty = errors.New("jwt: COSE_Key missing kty parameter")
+	errCOSEKeyParam = errors.New("jwt: COSE_Key missing key–parameter field")
+)
+
+// LoadCOSE adds keys from the CBOR data to the register, including the key ID,
+// a.k.a. "kid", when present. If data is an array, then it is read as a
+// COSE_KeySet. Otherwise, data is read as a single COSE_Key. The key types
+// map to the same fields as with LoadJWK. Keys with an algorithm ("alg")
+// parameter must match their key type. Keys with "key_ops" without sign nor
+// verify go into Encryptions.
+//
+// COSE keys are in use with CWT (CBOR Web Token), and with WebAuthn for
+// example, so one register can serve both JOSE and COSE verification.
+func (keys *KeyRegister) LoadCOSE(data []byte) (keysAdded int, err error) {
+	d := cbor.Decoder{Data: data}
+	v, err := d.Value()
+	if err != nil {
+		return 0, fmt.Errorf("jwt: malformed COSE_Key: %w", err)
+	}
+	if len(d.Data) != 0 {
+		return 0, errors.New("jwt: malformed COSE_Key: trailing data")
+	}
+
+	set, ok := v.([]interface{})
+	if !ok {
+		if err := keys.addCOSE(v); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	for i, k := range set {
+		if err := keys.addCOSE(k); err != nil {
+			return i, err
+		}
+	}
+	return len(set), nil
+}
+
+func (keys *KeyRegister) addCOSE(v interface{}) error {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return errors.New("jwt: COSE_Key not a CBOR map")
+	}
+
+	var kid string
+	switch id := m[int64(coseKeyKid)].(type) {
+	case nil:
+		break
+	case []byte:
+		kid = string(id)
+	default:
+		return errors.New("jwt: COSE_Key kid parameter not a byte string")
+	}
+
+	kty, ok := m[int64(coseKeyKty)].(int64)
+	if !ok {
+		return errCOSEKeyNoKty
+	}
+
+	var algs map[string]crypto.Hash
+	var key interface{}
+	switch kty {
+	default:
+		return fmt.Errorf("jwt: COSE_Key with unsupported key type %d", kty)
+
+	case coseKtyEC2:
+		// See RFC 9053, subsection 7.1.1
+		var curve elliptic.Curve
+		crv, _ := m[int64(-1)].(int64)
+		switch crv {
+		case 1:
+			curve = elliptic.P256()
+		case 2:
+			curve = elliptic.P384()
+		case 3:
+			curve = elliptic.P521()
+		default:
+			return fmt.Errorf("jwt: COSE_Key with unsupported elliptic curve %d", crv)
+		}
+
+		xBytes, err := coseParam(m, -2)
+		if err != nil {
+			return err
+		}
+		if _, ok := m[int64(-3)].(bool); ok {
+			return errors.New("jwt: COSE_Key with compressed point not supported")
+		}
+		yBytes, err := coseParam(m, -3)
+		if err != nil {
+			return err
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+		if len(xBytes) != size || len(yBytes) != size {
+			return errJWKCurveSize
+		}
+		x := new(big.Int).SetBytes(xBytes)
+		y := new(big.Int).SetBytes(yBytes)
+		if !curve.IsOnCurve(x, y) {
+			return errJWKCurveMiss
+		}
+
+		algs = ECDSAAlgs
+		key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+
+	case coseKtyOKP:
+		// See RFC 9053, subsection 7.2
+		crv, _ := m[int64(-1)].(int64)
+		if crv != 6 {
+			return fmt.Errorf("jwt: COSE_Key with unsupported elliptic curve %d", crv)
+		}
+		x, err := coseParam(m, -2)
+		if err != nil {
+			return err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return errJWKCurveSize
+		}
+
+		algs = map[string]crypto.Hash{EdDSA: 0}
+		key = ed25519.PublicKey(x)
+
+	case coseKtyRSA:
+		// See RFC 8230, section 4
+		n, err := coseParam(m, -1)
+		if err != nil {
+			return err
+		}
+		e, err := coseParam(m, -2)
+		if err != nil {
+			return err
+		}
+
+		algs = RSAAlgs
+		key = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+
+	case coseKtySymmetric:
+		// See RFC 9053, subsection 7.3
+		k, err := coseParam(m, -1)
+		if err != nil {
+			return err
+		}
+
+		algs = HMACAlgs
+		key = k
+	}
+
+	if a, ok := m[int64(coseKeyAlg)]; ok {
+		id, ok := a.(int64)
+		if !ok {
+			return errors.New("jwt: COSE_Key alg parameter not an integer")
+		}
+		alg, ok := coseKeyAlgs[id]
+		if !ok {
+			return fmt.Errorf("jwt: COSE_Key with unsupported algorithm %d", id)
+		}
+		if _, ok := algs[alg]; !ok {
+			return fmt.Errorf("jwt: COSE_Key algorithm %s does not match key type %d", alg, kty)
+		}
+	}
+
+	if ops, ok := m[int64(coseKeyKeyOps)]; ok {
+		list, ok := ops.([]interface{})
+		if !ok {
+			return errors.New("jwt: COSE_Key key_ops parameter not an array")
+		}
+		enc := true
+		for _, op := range list {
+			// sign (1) and verify (2) from RFC 9052, table 5
+			if op == int64(1) || op == int64(2) {
+				enc = false
+			}
+		}
+		if enc {
+			keys.addEncryption(key, kid)
+			return nil
+		}
+	}
+
+	return keys.add(key, kid)
+}
+
+func coseParam(m map[interface{}]interface{}, label int64) ([]byte, error) {
+	b, ok := m[label].([]byte)
+	if !ok || len(b) == 0 {
+		return nil, errCOSEKeyParam
+	}
+	return b, nil
+}
@@ -8,10 +8,25 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt/internal/cbor"
 )
 
 // Tests the golden cases.
@@ -511,11 +526,8 @@ var GoldenJWKs = []struct {
 				"kid":"2011-04-29"
 			}]
 		}`,
+		// EC key has "use": "enc"
 		PEM: `-----BEGIN PUBLIC KEY-----
-MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEMKBCTNIcKUSDii11ySs3526iDZ8A
-iTo7Tu6KPAqv7D7gS2XpJFbZiItSs3m9+9Ue6GnvHw/GW2ZZaVtszggXIw==
------END PUBLIC KEY-----
------BEGIN PUBLIC KEY-----
 MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA0vx7agoebGcQSuuPiLJX
 ZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tS
 oc/BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ/2W+5JsGY4Hc5n9yBXArwl93lqt
@@ -553,11 +565,8 @@ gwIDAQAB
 				"kid":"2011-04-29"
 			}]
 		}`,
+		// EC key has "use": "enc"
 		PEM: `-----BEGIN PUBLIC KEY-----
-MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEMKBCTNIcKUSDii11ySs3526iDZ8A
-iTo7Tu6KPAqv7D7gS2XpJFbZiItSs3m9+9Ue6GnvHw/GW2ZZaVtszggXIw==
------END PUBLIC KEY-----
------BEGIN PUBLIC KEY-----
 MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA0vx7agoebGcQSuuPiLJX
 ZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tS
 oc/BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ/2W+5JsGY4Hc5n9yBXArwl93lqt
@@ -625,16 +634,7 @@ vQIDAQAB
 			"dq":"AvfS0-gRxvn0bwJoMSnFxYcK1WnuEjQFluMGfwGitQBWtfZ1Er7t1xDkbN9GQTB9yqpDoYaN06H7CFtrkxhJIBQaj6nkF5KKS3TQtQ5qCzkOkmxIe3KRbBymXxkb5qwUpX5ELD5xFc6FeiafWYY63TmmEAu_lRFCOJ3xDea-ots",
 			"qi":"lSQi-w9CpyUReMErP1RsBLk7wNtOvs5EQpPqmuMvqW57NBUczScEoPwmUqqabu9V0-Py4dQ57_bapoKRu1R90bvuFnU63SHWEFglZQvJDMeAvmj4sm-Fp0oYu_neotgQ0hzbI5gry7ajdYy9-2lNx_76aBZoOUu9HCJ-UsfSOI8"
 		}`,
-		PEM: `-----BEGIN PUBLIC KEY-----
-MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAt6Q8PWSi1dkJj9hTP8hN
-YFlvadM7DflW9mWepOJhJ66w7nyoK1gPNqFMSQRyO125Gp+TEkodhWr0iujjHVx7
-BcV0llS4w5ACGgPrcAd6ZcSR0+Iqom+QFcNP8Sjg086MwoqQU/LYywlAGZ21WSdS
-/PERyGFiNnj3QQlO8Yns5jCtLCRwLHL0Pb1fEv45AuRIuUfVcPySBWYnDyGxvjYG
-DSM+AqWS9zIQ2ZilgT+GqUmipg0XOC0Cc20rgLe2ymLHjpHciCKVAbY5+L32+lSe
-ZO+Os6U15/aXrk9Gw8cPUaX1/I8sLGuSiVdt3C/Fn2PZ3Z8i744FPFGGcG1qs2Wz
-+QIDAQAB
------END PUBLIC KEY-----
-`,
+		PEM: "", // encryption only
 	},
 	// RFC 8037, appendix A.1
 	{
@@ -732,11 +732,19 @@ var GoldenJWKErrors = []struct {
 	{`{"kty":"EC", "crv":"P-384",
 		"x": "MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4",
 		"y": "4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM"
+}`, errJWKCurveSize},
+	{`{"kty":"EC", "crv":"P-256",
+		"x":"PpguvKJh1i-yPaFX181o-KcXCyen1X2L1MjABULfpA",
+		"y":"B_E-voPDe2tUUrzh2CvavVfL7k33RxK7zdQXadYLG-0"
 }`, errJWKCurveSize},
 	{`{"kty":"EC", "crv":"P-256",
 		"x":"4Etl6SRW2YiLUrN5vfvVHuhp7x8PxltmWWlbbM4IFyM",
 		"y":"MKBCTNIcKUSDii11ySs3526iDZ8AiTo7Tu6KPAqv7D4"
 }`, errJWKCurveMiss},
+	{`{"kty": "oct", "use": "bad", "k": "c2VjcmV0"}`,
+		errors.New(`jwt: JWK with unsupported use "bad"`)},
+	{`{"kty": "oct", "use": "sig", "key_ops": ["encrypt"], "k": "c2VjcmV0"}`, errJWKUseKeyOps},
+	{`{"kty": "oct", "use": "enc", "key_ops": ["verify"], "k": "c2VjcmV0"}`, errJWKUseKeyOps},
 }
 
 func TestKeyRegisterLoadJWKErrors(t *testing.T) {
@@ -754,3 +762,924 @@ func TestKeyRegisterLoadJWKErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestKeyRegisterLoadJWKLeadingZero(t *testing.T) {
+	// X coordinate with a leading zero byte in full size
+	n, err := new(KeyRegister).LoadJWK([]byte(`{"kty":"EC", "crv":"P-256",
+		"x":"AD6YLryiYdYvsj2hV9fNaPinFwsnp9V9i9TIwAVC36Q",
+		"y":"B_E-voPDe2tUUrzh2CvavVfL7k33RxK7zdQXadYLG-0"
+}`))
+	if n != 1 || err != nil {
+		t.Errorf("got (%d, %v), want (1, nil)", n, err)
+	}
+}
+
+func TestKeyRegisterLoadJWKUse(t *testing.T) {
+	keys := new(KeyRegister)
+	n, err := keys.LoadJWK([]byte(`{"keys": [
+		{"kty": "oct", "kid": "s1", "use": "sig", "k": "c2VjcmV0"},
+		{"kty": "oct", "kid": "e1", "use": "enc", "k": "Z3Vlc3Q"},
+		{"kty": "oct", "kid": "e2", "key_ops": ["encrypt", "decrypt"], "k": "Z3Vlc3Q"},
+		{"kty": "oct", "kid": "s2", "key_ops": ["sign", "verify"], "k": "b3RoZXI"}
+	]}`))
+	if n != 4 || err != nil {
+		t.Fatalf("got (%d, %v), want (4, nil)", n, err)
+	}
+	if !reflect.DeepEqual(keys.SecretIDs, []string{"s1", "s2"}) {
+		t.Errorf("got secret IDs %q, want [s1 s2]", keys.SecretIDs)
+	}
+	if !reflect.DeepEqual(keys.EncryptionIDs, []string{"e1", "e2"}) {
+		t.Errorf("got encryption IDs %q, want [e1 e2]", keys.EncryptionIDs)
+	}
+	if len(keys.Encryptions) != 2 {
+		t.Errorf("got %d encryption keys, want 2", len(keys.Encryptions))
+	}
+
+	for _, kid := range []string{"e1", "e2"} {
+		token, err := (&Claims{KeyID: kid}).Sign(HS256, []byte("guest"))
+		if err != nil {
+			t.Fatal("sign error:", err)
+		}
+		if _, err := keys.Check(token); err == nil {
+			t.Errorf("encryption key %q verified a signature", kid)
+		}
+	}
+
+	token, err := (&Claims{KeyID: "s2"}).Sign(HS256, []byte("other"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := keys.Check(token); err != nil {
+		t.Error("check error:", err)
+	}
+}
+
+func TestKeyRegisterLoadJWKDecoder(t *testing.T) {
+	keys := new(KeyRegister)
+	n, err := keys.LoadJWK([]byte(`{"keys": [
+		{"kty": "oct", "k": "c2VjcmV0"},
+		{"kty": "test-oct", "kid": "k2", "k": "Z3Vlc3Q"}
+	]}`))
+	if n != 2 || err != nil {
+		t.Fatalf("got (%d, %v), want (2, nil)", n, err)
+	}
+	if len(keys.Secrets) != 1 {
+		t.Errorf("got %d secrets, want 1", len(keys.Secrets))
+	}
+	want := []crypto.PublicKey{[]byte("guest")}
+	if !reflect.DeepEqual(keys.Others, want) || !reflect.DeepEqual(keys.OtherIDs, []string{"k2"}) {
+		t.Errorf("got others %q with IDs %q, want %q with ID k2", keys.Others, keys.OtherIDs, want)
+	}
+
+	token, err := (&Claims{KeyID: "k2"}).Sign("XHS256", []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := keys.Check(token); err != nil {
+		t.Error("check error:", err)
+	}
+}
+
+func mustCOSE(v interface{}) []byte {
+	var e cbor.Encoder
+	if err := e.Value(v); err != nil {
+		panic(err)
+	}
+	return e.Bytes()
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestKeyRegisterLoadCOSE(t *testing.T) {
+	// public key from RFC 9052, subsection C.7.1
+	const kid = "meriadoc.brandybuck@buckland.example"
+	ec2 := map[interface{}]interface{}{
+		int64(1):  int64(2),
+		int64(2):  []byte(kid),
+		int64(-1): int64(1),
+		int64(-2): mustHex("65eda5a12577c2bae829437fe338701a10aaa375e1bb5b5de108de439c08551d"),
+		int64(-3): mustHex("1e52ed75701163f7f9e40ddf9f341b3dc9ba860af7e0ca7ca7e9eecd0084d19c"),
+	}
+	keys := new(KeyRegister)
+	n, err := keys.LoadCOSE(mustCOSE(ec2))
+	if n != 1 || err != nil {
+		t.Fatalf("got (%d, %v), want (1, nil)", n, err)
+	}
+	if len(keys.ECDSAs) != 1 || !reflect.DeepEqual(keys.ECDSAIDs, []string{kid}) {
+		t.Errorf("got ECDSAs %v with IDs %q, want 1 with ID %q", keys.ECDSAs, keys.ECDSAIDs, kid)
+	}
+
+	point := elliptic.Marshal(testKeyEC256.Curve, testKeyEC256.X, testKeyEC256.Y)
+	set := []interface{}{
+		map[interface{}]interface{}{
+			int64(1):  int64(2),
+			int64(3):  int64(-7),
+			int64(-1): int64(1),
+			int64(-2): point[1:33],
+			int64(-3): point[33:],
+		},
+		map[interface{}]interface{}{
+			int64(1):  int64(1),
+			int64(3):  int64(-8),
+			int64(-1): int64(6),
+			int64(-2): []byte(testKeyEd25519Public),
+		},
+		map[interface{}]interface{}{
+			int64(1):  int64(3),
+			int64(-1): testKeyRSA2048.N.Bytes(),
+			int64(-2): big.NewInt(int64(testKeyRSA2048.E)).Bytes(),
+		},
+		map[interface{}]interface{}{
+			int64(1):  int64(4),
+			int64(2):  []byte("s1"),
+			int64(3):  int64(5),
+			int64(-1): []byte("guest"),
+		},
+		map[interface{}]interface{}{
+			int64(1):  int64(4),
+			int64(4):  []interface{}{int64(3), int64(4)},
+			int64(-1): []byte("encrypt only"),
+		},
+	}
+	keys = new(KeyRegister)
+	n, err = keys.LoadCOSE(mustCOSE(set))
+	if n != 5 || err != nil {
+		t.Fatalf("got (%d, %v), want (5, nil)", n, err)
+	}
+	if len(keys.Secrets) != 1 || len(keys.Encryptions) != 1 {
+		t.Errorf("got %d secrets and %d encryption keys, want 1 and 1", len(keys.Secrets), len(keys.Encryptions))
+	}
+
+	for alg, key := range map[string]interface{}{
+		ES256: testKeyEC256,
+		EdDSA: testKeyEd25519Private,
+		PS256: testKeyRSA2048,
+		HS256: []byte("guest"),
+	} {
+		token, err := new(Claims).Sign(alg, key)
+		if err != nil {
+			t.Fatalf("%s sign error: %s", alg, err)
+		}
+		if _, err := keys.Check(token); err != nil {
+			t.Errorf("%s check error: %s", alg, err)
+		}
+	}
+}
+
+func TestKeyRegisterLoadCOSEErrors(t *testing.T) {
+	golden := []struct {
+		Key interface{}
+		Err error
+	}{
+		{"not a map", nil},
+		{map[interface{}]interface{}{}, errCOSEKeyNoKty},
+		{map[interface{}]interface{}{int64(1): int64(99)},
+			errors.New("jwt: COSE_Key with unsupported key type 99")},
+		{map[interface{}]interface{}{int64(1): int64(2), int64(-1): int64(99)},
+			errors.New("jwt: COSE_Key with unsupported elliptic curve 99")},
+		{map[interface{}]interface{}{int64(1): int64(2), int64(-1): int64(1)}, errCOSEKeyParam},
+		{map[interface{}]interface{}{int64(1): int64(2), int64(-1): int64(1),
+			int64(-2): make([]byte, 32), int64(-3): true},
+			errors.New("jwt: COSE_Key with compressed point not supported")},
+		{map[interface{}]interface{}{int64(1): int64(2), int64(-1): int64(1),
+			int64(-2): make([]byte, 31), int64(-3): make([]byte, 32)}, errJWKCurveSize},
+		{map[interface{}]interface{}{int64(1): int64(2), int64(-1): int64(1),
+			int64(-2): bytes.Repeat([]byte{1}, 32), int64(-3): bytes.Repeat([]byte{2}, 32)}, errJWKCurveMiss},
+		{map[interface{}]interface{}{int64(1): int64(1), int64(-1): int64(4)},
+			errors.New("jwt: COSE_Key with unsupported elliptic curve 4")},
+		{map[interface{}]interface{}{int64(1): int64(3), int64(-1): []byte{1}}, errCOSEKeyParam},
+		{map[interface{}]interface{}{int64(1): int64(4), int64(2): "text"},
+			errors.New("jwt: COSE_Key kid parameter not a byte string")},
+		{map[interface{}]interface{}{int64(1): int64(4), int64(3): int64(-7), int64(-1): []byte("guest")},
+			errors.New("jwt: COSE_Key algorithm ES256 does not match key type 4")},
+		{map[interface{}]interface{}{int64(1): int64(4), int64(3): int64(-65535), int64(-1): []byte("guest")},
+			errors.New("jwt: COSE_Key with unsupported algorithm -65535")},
+		{[]interface{}{map[interface{}]interface{}{}}, errCOSEKeyNoKty},
+	}
+	for _, gold := range golden {
+		data := mustCOSE(gold.Key)
+		n, err := new(KeyRegister).LoadCOSE(data)
+		if n != 0 {
+			t.Errorf("loaded %d keys for %x, want 0", n, data)
+		}
+		if err == nil {
+			t.Errorf("no error for %x", data)
+			continue
+		}
+		if gold.Err != nil && err.Error() != gold.Err.Error() {
+			t.Errorf("want error %q for %x, got %q", gold.Err, data, err)
+		}
+	}
+}
+
+func TestKeyRegisterCheckAll(t *testing.T) {
+	keys := &KeyRegister{Secrets: [][]byte{[]byte("guest")}}
+
+	for _, n := range []int{0, 3, 100} {
+		tokens := make([][]byte, n)
+		for i := range tokens {
+			var c Claims
+			c.Subject = fmt.Sprint(i)
+			secret := []byte("guest")
+			if i%3 == 2 {
+				secret = []byte("intruder")
+			}
+			token, err := c.HMACSign(HS256, secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens[i] = token
+		}
+
+		claims, errs := keys.CheckAll(tokens)
+		if len(claims) != n || len(errs) != n {
+			t.Fatalf("got %d claims and %d errors for %d tokens", len(claims), len(errs), n)
+		}
+		for i := range tokens {
+			if i%3 == 2 {
+				if errs[i] != ErrSigMiss || claims[i] != nil {
+					t.Errorf("token %d of %d: got claims %v and error %v, want ErrSigMiss", i, n, claims[i], errs[i])
+				}
+				continue
+			}
+			if errs[i] != nil {
+				t.Errorf("token %d of %d: got error %v", i, n, errs[i])
+			} else if want := fmt.Sprint(i); claims[i].Subject != want {
+				t.Errorf("token %d of %d: got subject %q, want %q", i, n, claims[i].Subject, want)
+			}
+		}
+	}
+
+	// valid signature on a malformed payload
+	token := signHS256Guest("eyJhbGciOiJIUzI1NiJ9." + encoding.EncodeToString([]byte("[]")))
+	claims, errs := keys.CheckAll([][]byte{token})
+	if errs[0] == nil || claims[0] != nil {
+		t.Errorf("got claims %v and error %v for malformed payload, want an error only", claims[0], errs[0])
+	}
+}
+
+func TestKeyRegisterVerifyBytes(t *testing.T) {
+	keys := &KeyRegister{Secrets: [][]byte{[]byte("guest")}}
+
+	c := new(Claims)
+	c.ID = "n1"
+	token, err := c.HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	payload, err := keys.VerifyBytes(token)
+	if err != nil {
+		t.Fatal("verify error:", err)
+	}
+	if string(payload) != string(c.Raw) {
+		t.Errorf("got payload %q, want %q", payload, c.Raw)
+	}
+
+	// not JSON
+	token = signHS256Guest("eyJhbGciOiJIUzI1NiJ9." + encoding.EncodeToString([]byte("\x00plain")))
+	payload, err = keys.VerifyBytes(token)
+	if err != nil {
+		t.Fatal("verify error:", err)
+	}
+	if string(payload) != "\x00plain" {
+		t.Errorf("got payload %q, want %q", payload, "\x00plain")
+	}
+	if _, err := keys.Check(token); err == nil {
+		t.Error("check without error on plain payload")
+	}
+
+	keys.Secrets[0] = []byte("wrong")
+	if _, err := keys.VerifyBytes(token); err != ErrSigMiss {
+		t.Errorf("got error %v, want %v", err, ErrSigMiss)
+	}
+}
+
+func TestKeyRegisterCheckAcceptance(t *testing.T) {
+	keys := &KeyRegister{
+		Secrets:   [][]byte{[]byte("old"), []byte("guest")},
+		SecretIDs: []string{"", "s2"},
+		EdDSAs:    []ed25519.PublicKey{testKeyEd25519Public},
+	}
+
+	token, err := new(Claims).HMACSign(HS384, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	_, report, err := keys.CheckAcceptance(token)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	want := Acceptance{Alg: HS384, KeyType: "Secrets", KeyIndex: 1, KeyID: "s2"}
+	if *report != want {
+		t.Errorf("got %+v, want %+v", *report, want)
+	}
+
+	token, err = (&Claims{KeyID: "s2"}).HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	_, report, err = keys.CheckAcceptance(token)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	want = Acceptance{Alg: HS256, KeyType: "Secrets", KeyIndex: 1, KeyID: "s2"}
+	if *report != want {
+		t.Errorf("with key ID got %+v, want %+v", *report, want)
+	}
+
+	token, err = new(Claims).EdDSASign(testKeyEd25519Private)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	_, report, err = keys.CheckAcceptance(token)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	want = Acceptance{Alg: EdDSA, KeyType: "EdDSAs"}
+	if *report != want {
+		t.Errorf("got %+v, want %+v", *report, want)
+	}
+
+	token, err = new(Claims).HMACSign(HS256, []byte("wrong"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	c, report, err := keys.CheckAcceptance(token)
+	if err != ErrSigMiss || c != nil || report != nil {
+		t.Errorf("got (%v, %v, %v), want (nil, nil, %v)", c, report, err, ErrSigMiss)
+	}
+}
+
+func TestKeyRegisterStrictHMAC(t *testing.T) {
+	keys := &KeyRegister{StrictHMAC: true}
+	// 16-byte secret
+	if _, err := keys.LoadJWK([]byte(`{"kty": "oct", "k": "GawgguFyGrWKav7AX4VKUg"}`)); err != errWeakSecret {
+		t.Errorf("got error %v, want %v", err, errWeakSecret)
+	}
+	if len(keys.Secrets) != 0 {
+		t.Errorf("got %d secrets registered, want 0", len(keys.Secrets))
+	}
+
+	token, err := new(Claims).HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := keys.Check(token); err != AlgError(HS256) {
+		t.Errorf("got error %v without secrets, want %v", err, AlgError(HS256))
+	}
+
+	// assigned directly
+	keys.Secrets = [][]byte{[]byte("guest")}
+	if _, err := keys.Check(token); err != ErrSigMiss {
+		t.Errorf("got error %v for short secret, want %v", err, ErrSigMiss)
+	}
+
+	secret := bytes.Repeat([]byte{'s'}, 32)
+	keys.Secrets = [][]byte{secret}
+	token, err = new(Claims).HMACSign(HS256, secret)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := keys.Check(token); err != nil {
+		t.Error("check error:", err)
+	}
+	token, err = new(Claims).HMACSign(HS512, secret)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := keys.Check(token); err != ErrSigMiss {
+		t.Errorf("got error %v for HS512 with 32-byte secret, want %v", err, ErrSigMiss)
+	}
+}
+
+func TestKeyRegisterContentTypes(t *testing.T) {
+	keys := &KeyRegister{Secrets: [][]byte{[]byte("guest")}}
+
+	var c Claims
+	c.Subject = "test"
+	jsonToken, err := c.HMACSign(HS256, []byte("guest"), json.RawMessage(`{"cty":"JSON"}`))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	plainToken, err := c.HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	nestedToken := signHS256Guest(`eyJhbGciOiJIUzI1NiIsImN0eSI6IkpXVCJ9.` + encoding.EncodeToString(plainToken))
+
+	got, err := keys.Check(jsonToken)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if got.ContentType != "JSON" {
+		t.Errorf("got content type %q, want JSON", got.ContentType)
+	}
+
+	keys.ContentTypes = []string{"application/json", ""}
+	if _, err := keys.Check(jsonToken); err != nil {
+		t.Error("check error with application/json:", err)
+	}
+	if _, err := keys.Check(plainToken); err != nil {
+		t.Error("check error without content type:", err)
+	}
+	_, err = keys.VerifyBytes(nestedToken)
+	if want := ContentTypeError("JWT"); err != want {
+		t.Errorf("got error %v, want %v", err, want)
+	}
+
+	keys.ContentTypes = []string{"jwt"}
+	payload, err := keys.VerifyBytes(nestedToken)
+	if err != nil {
+		t.Fatal("verify error:", err)
+	}
+	if string(payload) != string(plainToken) {
+		t.Errorf("got payload %q, want %q", payload, plainToken)
+	}
+	if _, err := keys.Check(plainToken); err != ContentTypeError("") {
+		t.Errorf("got error %v, want %v", err, ContentTypeError(""))
+	}
+}
+
+func TestKeyRegisterCheckJSON(t *testing.T) {
+	c := new(Claims)
+	c.Subject = "Pam"
+	serial, err := c.SignJSON(
+		JSONSigner{Alg: ES256, Key: testKeyEC256, KeyID: "old"},
+		JSONSigner{Alg: EdDSA, Key: testKeyEd25519Private, KeyID: "new"},
+	)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	var general struct {
+		Payload    string
+		Signatures []struct{ Protected, Signature string }
+	}
+	if err := json.Unmarshal(serial, &general); err != nil {
+		t.Fatal("malformed serialization:", err)
+	}
+	if len(general.Signatures) != 2 {
+		t.Fatalf("got %d signatures, want 2", len(general.Signatures))
+	}
+
+	// either key verifies
+	for _, keys := range []*KeyRegister{
+		{ECDSAs: []*ecdsa.PublicKey{&testKeyEC256.PublicKey}, ECDSAIDs: []string{"old"}},
+		{EdDSAs: []ed25519.PublicKey{testKeyEd25519Public}, EdDSAIDs: []string{"new"}},
+	} {
+		got, err := keys.CheckJSON(serial)
+		if err != nil {
+			t.Errorf("check error: %s", err)
+			continue
+		}
+		if got.Subject != "Pam" {
+			t.Errorf("got subject %q, want Pam", got.Subject)
+		}
+	}
+
+	keys := &KeyRegister{ECDSAs: []*ecdsa.PublicKey{&testKeyEC384.PublicKey}}
+	if _, err := keys.CheckJSON(serial); err != ErrSigMiss {
+		t.Errorf("got error %v for unknown keys, want %v", err, ErrSigMiss)
+	}
+
+	// flattened syntax
+	flat := fmt.Sprintf(`{"payload":%q,"protected":%q,"signature":%q}`,
+		general.Payload, general.Signatures[1].Protected, general.Signatures[1].Signature)
+	keys = &KeyRegister{EdDSAs: []ed25519.PublicKey{testKeyEd25519Public}}
+	if _, err := keys.CheckJSON([]byte(flat)); err != nil {
+		t.Errorf("flattened check error: %s", err)
+	}
+
+	if _, err := keys.CheckJSON([]byte(`{"signatures":[]}`)); err == nil {
+		t.Error("no error for absent payload")
+	}
+	if _, err := new(Claims).SignJSON(); err == nil {
+		t.Error("no error for zero signers")
+	}
+}
+
+func TestKeyRegisterPinnedSPKIs(t *testing.T) {
+	pin, err := SPKIPin(&testKeyEC256.PublicKey)
+	if err != nil {
+		t.Fatal("pin error:", err)
+	}
+	keys := &KeyRegister{
+		ECDSAs:      []*ecdsa.PublicKey{&testKeyEC256.PublicKey, &testKeyEC384.PublicKey},
+		Secrets:     [][]byte{[]byte("guest")},
+		PinnedSPKIs: [][sha256.Size]byte{pin},
+	}
+
+	token, err := new(Claims).ECDSASign(ES256, testKeyEC256)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := keys.Check(token); err != nil {
+		t.Error("pinned key got check error:", err)
+	}
+
+	token, err = new(Claims).ECDSASign(ES384, testKeyEC384)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := keys.Check(token); err != ErrSigMiss {
+		t.Errorf("key without pin got error %v, want %v", err, ErrSigMiss)
+	}
+
+	token, err = new(Claims).HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := keys.Check(token); err != ErrSigMiss {
+		t.Errorf("secret got error %v, want %v", err, ErrSigMiss)
+	}
+
+	// openssl ec -pubout -outform DER | openssl dgst -sha256 -binary | base64
+	if got, want := base64.StdEncoding.EncodeToString(pin[:]), "zI92Gb3gpRk0ollKv+qz96xebQxG7kCMzJpnNRWMK4U="; got != want {
+		t.Errorf("got pin-sha256 %q, want %q", got, want)
+	}
+}
+
+func TestKeyRegisterDetailedMiss(t *testing.T) {
+	keys := &KeyRegister{
+		ECDSAs:       []*ecdsa.PublicKey{&testKeyEC384.PublicKey, &testKeyEC521.PublicKey},
+		ECDSAIDs:     []string{"ec384"},
+		Secrets:      [][]byte{[]byte("guest"), []byte("1234567890abcdefghijklmnopqrstuv")},
+		StrictHMAC:   true,
+		DetailedMiss: true,
+	}
+
+	sign := func(alg string, key crypto.PrivateKey, kid string) []byte {
+		t.Helper()
+		c := &Claims{KeyID: kid}
+		token, err := c.Sign(alg, key)
+		if err != nil {
+			t.Fatal("sign error:", err)
+		}
+		return token
+	}
+	tests := []struct {
+		token []byte
+		want  MissError
+	}{
+		{sign(EdDSA, testKeyEd25519Private, ""), MissError{Alg: EdDSA, Field: "EdDSAs"}},
+		{sign(ES256, testKeyEC256, ""), MissError{Alg: ES256, Field: "ECDSAs", Candidates: 2}},
+		{sign(ES256, testKeyEC256, "ec384"), MissError{Alg: ES256, Field: "ECDSAs", KeyID: "ec384", KeyIDKnown: true, Candidates: 1}},
+		{sign(ES256, testKeyEC256, "ec256"), MissError{Alg: ES256, Field: "ECDSAs", KeyID: "ec256", Candidates: 2}},
+		// StrictHMAC skips the short secret
+		{sign(HS256, []byte("wrong"), ""), MissError{Alg: HS256, Field: "Secrets", Candidates: 1}},
+	}
+	for _, test := range tests {
+		_, err := keys.Check(test.token)
+		var got *MissError
+		if !errors.As(err, &got) {
+			t.Errorf("got error %v, want a MissError", err)
+			continue
+		}
+		if *got != test.want {
+			t.Errorf("got %#v, want %#v", *got, test.want)
+		}
+		if !errors.Is(err, ErrSigMiss) {
+			t.Errorf("error %v is not ErrSigMiss", err)
+		}
+		if class := ErrorClass(err); class != "signature" {
+			t.Errorf("got error class %q, want signature", class)
+		}
+	}
+
+	keys.DetailedMiss = false
+	if _, err := keys.Check(tests[0].token); err != ErrSigMiss {
+		t.Errorf("without detail got error %v, want %v", err, ErrSigMiss)
+	}
+}
+
+func TestMissError(t *testing.T) {
+	tests := []struct {
+		err  MissError
+		want string
+	}{
+		{MissError{Alg: HS256, Field: "Secrets"}, "jwt: signature mismatch: no Secrets keys for HS256"},
+		{MissError{Alg: RS256, Field: "RSAs", KeyID: "k1", Candidates: 3}, `jwt: signature mismatch: key ID "k1" unknown, with 3 RSAs keys tried`},
+		{MissError{Alg: RS256, Field: "RSAs", KeyID: "k1", KeyIDKnown: true, Candidates: 1}, "jwt: signature mismatch on 1 RSAs candidate"},
+		{MissError{Alg: ES256, Field: "ECDSAs", Candidates: 2}, "jwt: signature mismatch on 2 ECDSAs candidates"},
+	}
+	for _, test := range tests {
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestRegisterSet(t *testing.T) {
+	set := RegisterSet{
+		"ctunt": &KeyRegister{ECDSAs: []*ecdsa.PublicKey{&testKeyEC256.PublicKey}},
+		"joe":   &KeyRegister{Secrets: [][]byte{goldenHMACs[0].secret}},
+	}
+
+	claims, err := set.Check([]byte(goldenECDSAs[0].token))
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if claims.Issuer != "ctunt" {
+		t.Errorf("got issuer %q, want ctunt", claims.Issuer)
+	}
+	if _, err := set.Check([]byte(goldenHMACs[0].token)); err != nil {
+		t.Error("check error:", err)
+	}
+
+	// signed by a key of another issuer
+	var c Claims
+	c.Issuer = "joe"
+	token, err := c.ECDSASign(ES256, testKeyEC256)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := set.Check(token); err != ErrSigMiss {
+		t.Errorf("foreign key got error %v, want %v", err, ErrSigMiss)
+	}
+
+	// unknown issuers
+	if _, err := set.Check([]byte(goldenHMACs[1].token)); err != IssuerError("ppoovey") {
+		t.Errorf("unknown issuer got error %v, want %v", err, IssuerError("ppoovey"))
+	}
+	if _, err := set.Check([]byte(goldenECDSAs[1].token)); err != IssuerError("") {
+		t.Errorf("no issuer got error %v, want %v", err, IssuerError(""))
+	}
+	if _, err := set.Check([]byte("broken")); err != errPart {
+		t.Errorf("broken token got error %v, want %v", err, errPart)
+	}
+}
+
+func TestKeyRegisterCertPolicy(t *testing.T) {
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &testKeyEC256.PublicKey, testKeyEC256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := func(serial int64, notAfter time.Time, usage x509.KeyUsage) []byte {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "leaf"},
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     notAfter,
+			KeyUsage:     usage,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &testKeyEC384.PublicKey, testKeyEC256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	good := leaf(2, now.Add(time.Hour), x509.KeyUsageDigitalSignature)
+
+	selfTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(5),
+		Subject:               pkix.Name{CommonName: "self"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}
+	selfDER, err := x509.CreateCertificate(rand.Reader, selfTemplate, selfTemplate, &testKeyEC384.PublicKey, testKeyEC384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := []struct {
+		pem    []byte
+		reason string
+	}{
+		{good, ""},
+		{leaf(3, now.Add(-time.Minute), x509.KeyUsageDigitalSignature), "expired at "},
+		{leaf(4, now.Add(time.Hour), x509.KeyUsageKeyEncipherment), "no digitalSignature key usage"},
+		{pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), "self-signed"},
+		{pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: selfDER}), "self-signed"},
+	}
+	for _, gold := range golden {
+		keys := KeyRegister{CertPolicy: new(CertPolicy)}
+		n, err := keys.LoadPEM(gold.pem, nil)
+		if gold.reason == "" {
+			if err != nil || n != 1 {
+				t.Errorf("got %d keys and error %v, want 1 key", n, err)
+			}
+			continue
+		}
+		var certErr *CertError
+		if !errors.As(err, &certErr) || !strings.HasPrefix(certErr.Reason, gold.reason) {
+			t.Errorf("got error %v, want CertError with reason %q", err, gold.reason)
+		}
+		if n != 0 {
+			t.Errorf("got %d keys added, want 0", n)
+		}
+	}
+
+	// skip offenders
+	keys := KeyRegister{CertPolicy: &CertPolicy{Skip: true}}
+	text := append(append(append([]byte{}, golden[3].pem...), good...), golden[1].pem...)
+	n, err := keys.LoadPEM(text, nil)
+	if n != 1 || len(keys.ECDSAs) != 1 {
+		t.Errorf("got %d keys added, want 1", n)
+	}
+	var certErr *CertError
+	if !errors.As(err, &certErr) || certErr.Cert.SerialNumber.Int64() != 3 {
+		t.Errorf("got error %v, want CertError for the last offender (serial 3)", err)
+	}
+
+	// self-signed permitted
+	keys = KeyRegister{CertPolicy: &CertPolicy{AllowSelfSigned: true}}
+	if n, err := keys.LoadPEM(golden[3].pem, nil); err != nil || n != 1 {
+		t.Errorf("got %d keys and error %v with AllowSelfSigned, want 1 key", n, err)
+	}
+
+	// clock
+	keys = KeyRegister{CertPolicy: &CertPolicy{Clock: func() time.Time { return now.Add(-2 * time.Hour) }}}
+	if _, err := keys.LoadPEM(good, nil); !errors.As(err, &certErr) || !strings.HasPrefix(certErr.Reason, "not valid before ") {
+		t.Errorf("got error %v, want CertError for not valid before", err)
+	}
+}
+
+func TestKeyRegisterMarshalBinary(t *testing.T) {
+	pin, err := SPKIPin(&testKeyEC256.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &KeyRegister{
+		ECDSAs:       []*ecdsa.PublicKey{&testKeyEC256.PublicKey, &testKeyEC384.PublicKey},
+		EdDSAs:       []ed25519.PublicKey{testKeyEd25519Public},
+		RSAs:         []*rsa.PublicKey{&testKeyRSA2048.PublicKey},
+		Secrets:      [][]byte{[]byte("guest"), []byte("other")},
+		Encryptions:  []crypto.PublicKey{&testKeyEC521.PublicKey},
+		ECDSAIDs:     []string{"", "ec384"},
+		SecretIDs:    []string{"guest"},
+		PinnedSPKIs:  [][sha256.Size]byte{pin},
+		StrictHMAC:   true,
+		ContentTypes: []string{},
+	}
+	data, err := keys.MarshalBinary()
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+
+	got := &KeyRegister{Secrets: [][]byte{[]byte("stale")}, CertPolicy: new(CertPolicy)}
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+	want := *keys
+	want.CertPolicy = got.CertPolicy
+	if !reflect.DeepEqual(got, &want) {
+		t.Errorf("got %+v, want %+v", got, &want)
+	}
+	if got.ContentTypes == nil {
+		t.Error("empty ContentTypes became nil")
+	}
+
+	var empty KeyRegister
+	data, err = empty.MarshalBinary()
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+	if !reflect.DeepEqual(got, &KeyRegister{CertPolicy: got.CertPolicy}) {
+		t.Errorf("got %+v, want an empty register", got)
+	}
+}
+
+func TestKeyRegisterUnmarshalBinaryErrors(t *testing.T) {
+	ed, err := x509.MarshalPKIXPublicKey(testKeyEd25519Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edJSON, _ := json.Marshal([][]byte{ed})
+
+	golden := []string{
+		`[]`,
+		`{}`,
+		`{"v":2}`,
+		`{"v":1,"ECDSAs":["AAAA"]}`,
+		`{"v":1,"ECDSAs":` + string(edJSON) + `}`,
+		`{"v":1,"SecretIDs":["orphan"]}`,
+		`{"v":1,"PinnedSPKIs":["AAAA"]}`,
+	}
+	for _, data := range golden {
+		keys := &KeyRegister{Secrets: [][]byte{[]byte("keep")}}
+		if err := keys.UnmarshalBinary([]byte(data)); err == nil {
+			t.Errorf("%s: no error", data)
+		} else if len(keys.Secrets) != 1 {
+			t.Errorf("%s: register modified on error", data)
+		}
+	}
+}
+
+func TestKeyRegisterLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwt-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Kubernetes projected volume layout
+	data := filepath.Join(dir, "..2026_10_14_00_00_00.000000000")
+	if err := os.Mkdir(data, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	var ecPEM, multiPEM bytes.Buffer
+	if err := encodePEM(&ecPEM, &testKeyEC256.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := encodePEM(&multiPEM, &testKeyEC384.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := encodePEM(&multiPEM, &testKeyRSA2048.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	edJWK := `{"kty":"OKP","crv":"Ed25519","kid":"ed-kid","x":"` + base64.RawURLEncoding.EncodeToString(testKeyEd25519Public) + `"}`
+	files := map[string]string{
+		"ec.pem":    ecPEM.String(),
+		"ed.jwk":    edJWK,
+		"multi.pem": multiPEM.String(),
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(data, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Base(data), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		if err := os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".hidden"), []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys KeyRegister
+	n, err := keys.LoadDir(dir)
+	if err != nil {
+		t.Fatal("load error:", err)
+	}
+	if n != 4 {
+		t.Errorf("got %d keys added, want 4", n)
+	}
+	if want := []string{"ec"}; !reflect.DeepEqual(keys.ECDSAIDs, want) {
+		t.Errorf("got ECDSA IDs %q, want %q", keys.ECDSAIDs, want)
+	}
+	if want := []string{"ed-kid"}; !reflect.DeepEqual(keys.EdDSAIDs, want) {
+		t.Errorf("got EdDSA IDs %q, want %q", keys.EdDSAIDs, want)
+	}
+	if len(keys.ECDSAs) != 2 || len(keys.RSAs) != 1 || len(keys.RSAIDs) != 0 {
+		t.Errorf("got %d ECDSAs and %d RSAs with IDs %q, want 2 and 1 without IDs", len(keys.ECDSAs), len(keys.RSAs), keys.RSAIDs)
+	}
+
+	var c Claims
+	c.KeyID = "ec"
+	token, err := c.ECDSASign(ES256, testKeyEC256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Check(token); err != nil {
+		t.Error("check error:", err)
+	}
+}
+
+func TestKeyRegisterLoadDirError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwt-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "notes.txt")
+	if err := ioutil.WriteFile(file, []byte("rotate monthly"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = new(KeyRegister).LoadDir(dir)
+	if err == nil || !strings.Contains(err.Error(), file) {
+		t.Errorf("got error %v, want one with the file path", err)
+	}
+}
@@ -0,0 +1,125 @@
+package jwt
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRevoked signals a token which ID is denied by a Revocation.
+var ErrRevoked = errors.New("jwt: token revoked")
+
+// Revocation tracks tokens which are no longer valid before they expire.
+// Implementations must be safe for use by multiple goroutines simultaneously.
+type Revocation interface {
+	// Revoke denies the JWT ID (the "jti" claim) until the expiry
+	// time, after which the token is rejected on the "exp" claim.
+	// A zero expiry denies the ID indefinitely.
+	Revoke(id string, expires time.Time) error
+
+	// Revoked returns whether the JWT ID is denied.
+	Revoked(id string) bool
+}
+
+// RevokeOnce is an optional extension of Revocation, for single-use tokens.
+// Implementations with storage shared among multiple instances should provide
+// it, as only an atomic check-and-set can reject concurrent reuse reliably.
+type RevokeOnce interface {
+	// RevokeOnce denies the JWT ID like Revoke does, and it returns
+	// whether the ID was not denied before, as one atomic operation.
+	RevokeOnce(id string, expires time.Time) (bool, error)
+}
+
+// UseOnce revokes the JWT ID, with ErrRevoked when it was revoked already.
+// Revocations without RevokeOnce get a check-and-set under a global mutex,
+// which covers concurrent use within the process only.
+func useOnce(r Revocation, id string, expires time.Time) error {
+	var first bool
+	if once, ok := r.(RevokeOnce); ok {
+		var err error
+		first, err = once.RevokeOnce(id, expires)
+		if err != nil {
+			return err
+		}
+	} else {
+		useOnceMutex.Lock()
+		defer useOnceMutex.Unlock()
+		first = !r.Revoked(id)
+		if first {
+			if err := r.Revoke(id, expires); err != nil {
+				return err
+			}
+		}
+	}
+	if !first {
+		return ErrRevoked
+	}
+	return nil
+}
+
+var useOnceMutex sync.Mutex
+
+// RevocationList is an in-memory Revocation. The zero value is ready to use.
+type RevocationList struct {
+	mutex sync.RWMutex
+	ids   map[string]time.Time // expiry per ID; zero for indefinite
+	prune time.Time            // earliest expiry in ids
+}
+
+// Revoke honors the Revocation interface.
+func (l *RevocationList) Revoke(id string, expires time.Time) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.revoke(id, expires)
+	return nil
+}
+
+// RevokeOnce honors the RevokeOnce interface.
+func (l *RevocationList) RevokeOnce(id string, expires time.Time) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.revoked(id) {
+		return false, nil
+	}
+	l.revoke(id, expires)
+	return true, nil
+}
+
+// Revoke requires a write lock.
+func (l *RevocationList) revoke(id string, expires time.Time) {
+	now := time.Now()
+	if !l.prune.IsZero() && now.After(l.prune) {
+		l.prune = time.Time{}
+		for id, exp := range l.ids {
+			switch {
+			case exp.IsZero():
+				break
+			case now.After(exp):
+				delete(l.ids, id)
+			case l.prune.IsZero() || exp.Before(l.prune):
+				l.prune = exp
+			}
+		}
+	}
+
+	if l.ids == nil {
+		l.ids = make(map[string]time.Time)
+	}
+	l.ids[id] = expires
+	if !expires.IsZero() && (l.prune.IsZero() || expires.Before(l.prune)) {
+		l.prune = expires
+	}
+}
+
+// Revoked honors the Revocation interface.
+func (l *RevocationList) Revoked(id string) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.revoked(id)
+}
+
+// Revoked requires a read lock.
+func (l *RevocationList) revoked(id string) bool {
+	exp, ok := l.ids[id]
+	return ok && (exp.IsZero() || !time.Now().After(exp))
+}
@@ -0,0 +1,69 @@
+package jwt
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRevocationList(t *testing.T) {
+	var l RevocationList
+	if l.Revoked("a") {
+		t.Error("zero value revoked an ID")
+	}
+
+	now := time.Now()
+	l.Revoke("a", now.Add(time.Hour))
+	l.Revoke("b", now.Add(-time.Second))
+	l.Revoke("c", time.Time{})
+	for id, want := range map[string]bool{"a": true, "b": false, "c": true, "d": false} {
+		if got := l.Revoked(id); got != want {
+			t.Errorf("%q: got revoked %t, want %t", id, got, want)
+		}
+	}
+
+	// prunes expired entries
+	l.Revoke("d", now.Add(time.Hour))
+	if _, ok := l.ids["b"]; ok {
+		t.Error("expired ID b not pruned")
+	}
+	if len(l.ids) != 3 {
+		t.Errorf("got %d IDs, want 3", len(l.ids))
+	}
+}
+
+// RevocationOnly hides any RevokeOnce implementation.
+type revocationOnly struct{ Revocation }
+
+func TestUseOnce(t *testing.T) {
+	for _, r := range []Revocation{new(RevocationList), revocationOnly{new(RevocationList)}} {
+		exp := time.Now().Add(time.Hour)
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		var passes, revokes int
+		for i := 0; i < 32; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := useOnce(r, "a", exp)
+				mutex.Lock()
+				defer mutex.Unlock()
+				switch err {
+				case nil:
+					passes++
+				case ErrRevoked:
+					revokes++
+				default:
+					t.Error("use error:", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if passes != 1 || revokes != 31 {
+			t.Errorf("%T: got %d passes and %d revokes, want 1 and 31", r, passes, revokes)
+		}
+		if !r.Revoked("a") {
+			t.Errorf("%T: ID not revoked", r)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// SchemaError signals a claim which does not comply with a Schema.
+type SchemaError struct {
+	Claim  string // name
+	Reason string // human-readable description
+}
+
+// Error honors the error interface.
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("jwt: claim %q %s", e.Claim, e.Reason)
+}
+
+// Schema constrains the content of claims, as a complement to the signature.
+// Checks include the Registered fields, with the same names and values as in
+// their JSON encoding.
+type Schema struct {
+	// Required lists the claim names which must be present.
+	Required []string
+
+	// Types maps claim names to their JSON type, i.e., one of "string",
+	// "number", "integer", "boolean", "array", "object" or "null".
+	// Claims of any other type are rejected when present.
+	Types map[string]string
+
+	// Predicates map claim names to a validation which applies when the
+	// claim is present. Values are conform Claims.Set, with numeric dates
+	// as float64 and audiences as []interface{}. The error is reported as
+	// the Reason of a SchemaError.
+	Predicates map[string]func(value interface{}) error
+}
+
+// Check returns a SchemaError for the first violation, in order of Required,
+// Types and Predicates, each with their claim names in alphabetical order.
+func (s *Schema) Check(c *Claims) error {
+	values := schemaValues(c)
+
+	for _, name := range s.Required {
+		if _, ok := values[name]; !ok {
+			return &SchemaError{Claim: name, Reason: "missing"}
+		}
+	}
+
+	names := make([]string, 0, len(s.Types)+len(s.Predicates))
+	for name := range s.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+		want := s.Types[name]
+		if got := jsonType(v); got != want && !(want == "number" && got == "integer") {
+			return &SchemaError{Claim: name, Reason: fmt.Sprintf("is of type %s, want %s", got, want)}
+		}
+	}
+
+	names = names[:0]
+	for name := range s.Predicates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+		if err := s.Predicates[name](v); err != nil {
+			return &SchemaError{Claim: name, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// SchemaValues returns the claims by name, with Registered taking precedence
+// over Set.
+func schemaValues(c *Claims) map[string]interface{} {
+	m := make(map[string]interface{}, len(c.Set)+7)
+	for name, v := range c.Set {
+		m[name] = v
+	}
+	if c.Issuer != "" {
+		m[issuer] = c.Issuer
+	}
+	if c.Subject != "" {
+		m[subject] = c.Subject
+	}
+	if len(c.Audiences) != 0 {
+		a := make([]interface{}, len(c.Audiences))
+		for i, s := range c.Audiences {
+			a[i] = s
+		}
+		m[audience] = a
+	}
+	if c.Expires != nil {
+		m[expires] = float64(*c.Expires)
+	}
+	if c.NotBefore != nil {
+		m[notBefore] = float64(*c.NotBefore)
+	}
+	if c.Issued != nil {
+		m[issued] = float64(*c.Issued)
+	}
+	if c.ID != "" {
+		m[id] = c.ID
+	}
+	return m
+}
+
+// JSONType returns the JSON Schema type of a value, with "integer" for numbers
+// without fraction.
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case float32:
+		return jsonType(float64(v))
+	}
+
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseJSONSchema returns a Schema from a JSON Schema document for the claims
+// object. The keywords supported are "type" (object only), "required" and
+// "properties" at the top level, and "type", "enum", "const", "pattern",
+// "minLength", "maxLength", "minimum" and "maximum" for each property. The
+// annotations "$schema", "$id", "title" and "description" are ignored. Any
+// other keyword gets an error, as it would not be enforced.
+func ParseJSONSchema(doc []byte) (*Schema, error) {
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, fmt.Errorf("jwt: malformed JSON Schema: %w", err)
+	}
+
+	s := &Schema{
+		Types:      make(map[string]string),
+		Predicates: make(map[string]func(value interface{}) error),
+	}
+	for keyword, raw := range root {
+		var err error
+		switch keyword {
+		case "$schema", "$id", "title", "description":
+			continue
+		case "type":
+			var t string
+			err = json.Unmarshal(raw, &t)
+			if err == nil && t != "object" {
+				err = errors.New(`top-level type must be "object"`)
+			}
+		case "required":
+			err = json.Unmarshal(raw, &s.Required)
+		case "properties":
+			var props map[string]map[string]json.RawMessage
+			err = json.Unmarshal(raw, &props)
+			for name, prop := range props {
+				if err != nil {
+					break
+				}
+				err = s.addProperty(name, prop)
+			}
+		default:
+			err = fmt.Errorf("keyword %q not supported", keyword)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwt: JSON Schema %s", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *Schema) addProperty(name string, prop map[string]json.RawMessage) error {
+	var checks []func(v interface{}) error
+	for keyword, raw := range prop {
+		switch keyword {
+		case "title", "description":
+			continue
+		case "type":
+			var t string
+			if err := json.Unmarshal(raw, &t); err != nil {
+				return fmt.Errorf("property %q type: %w", name, err)
+			}
+			switch t {
+			case "string", "number", "integer", "boolean", "array", "object", "null":
+				s.Types[name] = t
+			default:
+				return fmt.Errorf("property %q type %q unknown", name, t)
+			}
+
+		case "enum", "const":
+			var options []interface{}
+			if keyword == "const" {
+				options = []interface{}{jsonValue(raw)}
+			} else {
+				var a []json.RawMessage
+				if err := json.Unmarshal(raw, &a); err != nil {
+					return fmt.Errorf("property %q enum: %w", name, err)
+				}
+				for _, o := range a {
+					options = append(options, jsonValue(o))
+				}
+			}
+			checks = append(checks, func(v interface{}) error {
+				v = jsonValue(v)
+				for _, o := range options {
+					if reflect.DeepEqual(v, o) {
+						return nil
+					}
+				}
+				return fmt.Errorf("not in %s", raw)
+			})
+
+		case "pattern":
+			var expr string
+			if err := json.Unmarshal(raw, &expr); err != nil {
+				return fmt.Errorf("property %q pattern: %w", name, err)
+			}
+			pattern, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("property %q pattern: %w", name, err)
+			}
+			checks = append(checks, func(v interface{}) error {
+				if s, ok := v.(string); ok && !pattern.MatchString(s) {
+					return fmt.Errorf("does not match %q", expr)
+				}
+				return nil
+			})
+
+		case "minLength", "maxLength":
+			var n int
+			if err := json.Unmarshal(raw, &n); err != nil {
+				return fmt.Errorf("property %q %s: %w", name, keyword, err)
+			}
+			isMin := keyword == "minLength"
+			checks = append(checks, func(v interface{}) error {
+				s, ok := v.(string)
+				if !ok {
+					return nil
+				}
+				l := utf8.RuneCountInString(s)
+				if isMin && l < n {
+					return fmt.Errorf("shorter than %d characters", n)
+				}
+				if !isMin && l > n {
+					return fmt.Errorf("longer than %d characters", n)
+				}
+				return nil
+			})
+
+		case "minimum", "maximum":
+			var limit float64
+			if err := json.Unmarshal(raw, &limit); err != nil {
+				return fmt.Errorf("property %q %s: %w", name, keyword, err)
+			}
+			isMin := keyword == "minimum"
+			checks = append(checks, func(v interface{}) error {
+				f, ok := jsonNumber(jsonValue(v))
+				if !ok {
+					return nil
+				}
+				if isMin && f < limit {
+					return fmt.Errorf("less than %v", limit)
+				}
+				if !isMin && f > limit {
+					return fmt.Errorf("greater than %v", limit)
+				}
+				return nil
+			})
+
+		default:
+			return fmt.Errorf("keyword %q in property %q not supported", keyword, name)
+		}
+	}
+
+	if len(checks) != 0 {
+		s.Predicates[name] = func(v interface{}) error {
+			for _, check := range checks {
+				if err := check(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSchema(t *testing.T) {
+	s := &Schema{
+		Required: []string{"iss", "tenant"},
+		Types: map[string]string{
+			"exp":    "integer",
+			"aud":    "array",
+			"tenant": "string",
+			"admin":  "boolean",
+		},
+		Predicates: map[string]func(interface{}) error{
+			"tenant": func(v interface{}) error {
+				if v == "" {
+					return errors.New("is empty")
+				}
+				return nil
+			},
+		},
+	}
+
+	golden := []struct {
+		set    map[string]interface{}
+		claim  string
+		reason string
+	}{
+		{map[string]interface{}{"tenant": "a"}, "", ""},
+		{map[string]interface{}{}, "tenant", "missing"},
+		{map[string]interface{}{"tenant": 1.0}, "tenant", "is of type integer, want string"},
+		{map[string]interface{}{"tenant": "a", "admin": "yes"}, "admin", "is of type string, want boolean"},
+		{map[string]interface{}{"tenant": ""}, "tenant", "is empty"},
+	}
+	for _, gold := range golden {
+		c := &Claims{Set: gold.set}
+		c.Issuer = "a"
+		c.Audiences = []string{"b"}
+		c.Expires = NewNumericTime(time.Unix(1e9, 0))
+
+		err := s.Check(c)
+		if gold.claim == "" {
+			if err != nil {
+				t.Errorf("%v: got error %q", gold.set, err)
+			}
+			continue
+		}
+		var e *SchemaError
+		if !errors.As(err, &e) {
+			t.Errorf("%v: got error %v, want a SchemaError", gold.set, err)
+			continue
+		}
+		if e.Claim != gold.claim || e.Reason != gold.reason {
+			t.Errorf("%v: got claim %q with reason %q, want %q with %q", gold.set, e.Claim, e.Reason, gold.claim, gold.reason)
+		}
+	}
+
+	if err := s.Check(&Claims{Set: map[string]interface{}{"tenant": "a"}}); err == nil || err.Error() != `jwt: claim "iss" missing` {
+		t.Errorf("got error %v, want missing issuer", err)
+	}
+}
+
+func TestParseJSONSchema(t *testing.T) {
+	s, err := ParseJSONSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "access token",
+		"type": "object",
+		"required": ["sub", "scope"],
+		"properties": {
+			"sub": {"type": "string", "pattern": "^user-[0-9]+$"},
+			"scope": {"type": "string", "minLength": 1, "maxLength": 8},
+			"tier": {"enum": ["free", "pro"]},
+			"ver": {"const": 2},
+			"level": {"type": "integer", "minimum": 1, "maximum": 9}
+		}
+	}`))
+	if err != nil {
+		t.Fatal("parse error:", err)
+	}
+
+	golden := []struct {
+		set  map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"scope": "read"}, ""},
+		{map[string]interface{}{"scope": "read", "tier": "pro", "ver": 2.0, "level": 9.0}, ""},
+		{map[string]interface{}{}, `jwt: claim "scope" missing`},
+		{map[string]interface{}{"scope": ""}, `jwt: claim "scope" shorter than 1 characters`},
+		{map[string]interface{}{"scope": "read write"}, `jwt: claim "scope" longer than 8 characters`},
+		{map[string]interface{}{"scope": "read", "tier": "gold"}, `jwt: claim "tier" not in ["free", "pro"]`},
+		{map[string]interface{}{"scope": "read", "ver": 3.0}, `jwt: claim "ver" not in 2`},
+		{map[string]interface{}{"scope": "read", "level": 0.0}, `jwt: claim "level" less than 1`},
+		{map[string]interface{}{"scope": "read", "level": 1.5}, `jwt: claim "level" is of type number, want integer`},
+		{map[string]interface{}{"scope": "read", "sub": "admin"}, `jwt: claim "sub" does not match "^user-[0-9]+$"`},
+	}
+	for _, gold := range golden {
+		c := &Claims{Set: gold.set}
+		c.Subject = "user-42"
+		if sub, ok := gold.set["sub"].(string); ok {
+			c.Subject = sub
+		}
+
+		err := s.Check(c)
+		switch {
+		case gold.want == "" && err != nil:
+			t.Errorf("%v: got error %q", gold.set, err)
+		case gold.want != "" && (err == nil || err.Error() != gold.want):
+			t.Errorf("%v: got error %v, want %q", gold.set, err, gold.want)
+		}
+	}
+}
+
+func TestParseJSONSchemaErrors(t *testing.T) {
+	golden := []string{
+		`[]`,
+		`{"type": "array"}`,
+		`{"additionalProperties": false}`,
+		`{"properties": {"a": {"type": "text"}}}`,
+		`{"properties": {"a": {"format": "email"}}}`,
+		`{"properties": {"a": {"pattern": "("}}}`,
+		`{"properties": {"a": {"minLength": "1"}}}`,
+	}
+	for _, doc := range golden {
+		if _, err := ParseJSONSchema([]byte(doc)); err == nil {
+			t.Errorf("%s: no error", doc)
+		}
+	}
+}
+
+func TestHandlerSchema(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if err := new(Claims).EdDSASignHeader(req, testKeyEd25519Private); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &Handler{
+		Target: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			t.Error("target handler invoked")
+		}),
+		Keys:   &KeyRegister{EdDSAs: []ed25519.PublicKey{testKeyEd25519Public}},
+		Schema: &Schema{Required: []string{"sub"}},
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d, want 401", resp.Code)
+	}
+	if want := `jwt: claim "sub" missing` + "\n"; resp.Body.String() != want {
+		t.Errorf("got body %q, want %q", resp.Body, want)
+	}
+}
@@ -0,0 +1,533 @@
+// Package sdjwt implements “Selective Disclosure for JWTs (SD-JWT)” RFC 9901,
+// on top of package jwt. Issuers conceal claims with salted digests in the "_sd"
+// claim, holders present a selection of the respective disclosures, optionally
+// with a Key Binding JWT, and verifiers reconstruct the disclosed claims.
+//
+// The presentation format is the issuer-signed JWT, followed by each of the
+// disclosures, each terminated by a tilde ('~') character, followed by the
+// optional Key Binding JWT.
+//
+//	<Issuer-signed JWT>~<Disclosure 1>~<Disclosure N>~<optional KB-JWT>
+package sdjwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	_ "crypto/sha256" // link into binary
+	_ "crypto/sha512" // link into binary
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// Media types for the "typ" header parameter.
+const (
+	TypeSDJWT      = "dc+sd-jwt" // issuer-signed JWT
+	TypeKeyBinding = "kb+jwt"    // Key Binding JWT
+)
+
+// HashAlgs maps the "_sd_alg" names in use. Any modifications should be made
+// before first use.
+var HashAlgs = map[string]crypto.Hash{
+	"sha-256": crypto.SHA256,
+	"sha-384": crypto.SHA384,
+	"sha-512": crypto.SHA512,
+}
+
+// DefaultHashAlg applies in absence of the "_sd_alg" claim.
+const DefaultHashAlg = "sha-256"
+
+var encoding = base64.RawURLEncoding
+
+// Disclosure is a concealed claim, or a concealed array element when Name is
+// empty.
+type Disclosure struct {
+	Salt  string
+	Name  string
+	Value interface{}
+
+	// Encoded is the base64url encoding of the JSON array as is.
+	Encoded string
+}
+
+// NewDisclosure returns a disclosure with a new salt of 128 bits. An empty
+// name gets an array element.
+func NewDisclosure(name string, value interface{}) (*Disclosure, error) {
+	var salt [16]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, err
+	}
+	d := &Disclosure{Salt: encoding.EncodeToString(salt[:]), Name: name, Value: value}
+
+	array := []interface{}{d.Salt, name, value}
+	if name == "" {
+		array = []interface{}{d.Salt, value}
+	}
+	data, err := json.Marshal(array)
+	if err != nil {
+		return nil, fmt.Errorf("sdjwt: disclosure of %q: %w", name, err)
+	}
+	d.Encoded = encoding.EncodeToString(data)
+	return d, nil
+}
+
+// ParseDisclosure decodes a disclosure as is.
+func ParseDisclosure(encoded string) (*Disclosure, error) {
+	data, err := encoding.Strict().DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("sdjwt: malformed disclosure: %w", err)
+	}
+	var array []interface{}
+	if err := json.Unmarshal(data, &array); err != nil {
+		return nil, fmt.Errorf("sdjwt: malformed disclosure: %w", err)
+	}
+	d := &Disclosure{Encoded: encoded}
+	var ok bool
+	switch len(array) {
+	case 2:
+		d.Salt, ok = array[0].(string)
+		d.Value = array[1]
+	case 3:
+		d.Salt, ok = array[0].(string)
+		if ok {
+			d.Name, ok = array[1].(string)
+		}
+		if ok && (d.Name == "_sd" || d.Name == "...") {
+			return nil, fmt.Errorf("sdjwt: disclosure of reserved name %q", d.Name)
+		}
+		d.Value = array[2]
+	}
+	if !ok {
+		return nil, errors.New("sdjwt: disclosure not a JSON array of salt, [name,] and value")
+	}
+	return d, nil
+}
+
+// Digest returns the base64url-encoded hash of the disclosure.
+func (d *Disclosure) Digest(hash crypto.Hash) string {
+	h := hash.New()
+	h.Write([]byte(d.Encoded))
+	return encoding.EncodeToString(h.Sum(nil))
+}
+
+func hashLookup(name string) (crypto.Hash, error) {
+	hash, ok := HashAlgs[name]
+	if !ok {
+		return 0, fmt.Errorf("sdjwt: hash algorithm %q not in use", name)
+	}
+	if !hash.Available() {
+		return 0, fmt.Errorf("sdjwt: hash algorithm %q not linked into binary", name)
+	}
+	return hash, nil
+}
+
+// Conceal replaces the named claims of an object with their digest in "_sd".
+// The object is either jwt.Claims.Set or any nested JSON object. Names without
+// an entry are ignored. The digests apply DefaultHashAlg, unless the object has
+// the "_sd_alg" claim.
+func Conceal(object map[string]interface{}, names ...string) ([]*Disclosure, error) {
+	algName, _ := object["_sd_alg"].(string)
+	if algName == "" {
+		algName = DefaultHashAlg
+	}
+	hash, err := hashLookup(algName)
+	if err != nil {
+		return nil, err
+	}
+
+	var digests []string
+	if a, ok := object["_sd"].([]interface{}); ok {
+		for _, o := range a {
+			if s, ok := o.(string); ok {
+				digests = append(digests, s)
+			}
+		}
+	} else if a, ok := object["_sd"].([]string); ok {
+		digests = append(digests, a...)
+	}
+
+	var disclosures []*Disclosure
+	for _, name := range names {
+		value, ok := object[name]
+		if !ok {
+			continue
+		}
+		if name == "_sd" || name == "_sd_alg" || name == "..." {
+			return nil, fmt.Errorf("sdjwt: reserved name %q can't be concealed", name)
+		}
+		d, err := NewDisclosure(name, value)
+		if err != nil {
+			return nil, err
+		}
+		delete(object, name)
+		digests = append(digests, d.Digest(hash))
+		disclosures = append(disclosures, d)
+	}
+	if len(digests) != 0 {
+		// “The Issuer MUST hide the original order of the claims in the
+		// array.” — RFC 9901, subsection 4.2.4.1
+		sort.Strings(digests)
+		object["_sd"] = digests
+	}
+	return disclosures, nil
+}
+
+// ConcealElements replaces the array elements at the indices with a digest.
+// The algorithm must match the "_sd_alg" of the claims, if any.
+func ConcealElements(array []interface{}, hashAlg string, indices ...int) ([]*Disclosure, error) {
+	if hashAlg == "" {
+		hashAlg = DefaultHashAlg
+	}
+	hash, err := hashLookup(hashAlg)
+	if err != nil {
+		return nil, err
+	}
+	var disclosures []*Disclosure
+	for _, i := range indices {
+		if i < 0 || i >= len(array) {
+			return nil, fmt.Errorf("sdjwt: array index %d out of bounds", i)
+		}
+		d, err := NewDisclosure("", array[i])
+		if err != nil {
+			return nil, err
+		}
+		array[i] = map[string]interface{}{"...": d.Digest(hash)}
+		disclosures = append(disclosures, d)
+	}
+	return disclosures, nil
+}
+
+// Issue returns an SD-JWT with all disclosures. The claims should have their
+// concealment in place already. See Conceal and ConcealElements for details.
+func Issue(c *jwt.Claims, alg string, key crypto.PrivateKey, disclosures []*Disclosure, extraHeaders ...json.RawMessage) ([]byte, error) {
+	token, err := c.Sign(alg, key, extraHeaders...)
+	if err != nil {
+		return nil, err
+	}
+	return Present(token, disclosures), nil
+}
+
+// Present returns an SD-JWT of the issuer-signed JWT with the disclosures, and
+// without any Key Binding JWT. Nested disclosures require their parent to be
+// disclosed too.
+func Present(issuerJWT []byte, disclosures []*Disclosure) []byte {
+	var buf bytes.Buffer
+	buf.Write(issuerJWT)
+	buf.WriteByte('~')
+	for _, d := range disclosures {
+		buf.WriteString(d.Encoded)
+		buf.WriteByte('~')
+	}
+	return buf.Bytes()
+}
+
+// Split returns the components of an SD-JWT, with a nil kbJWT in absence.
+func Split(sdJWT []byte) (issuerJWT []byte, disclosures []*Disclosure, kbJWT []byte, err error) {
+	parts := bytes.Split(sdJWT, []byte{'~'})
+	if len(parts) < 2 {
+		return nil, nil, nil, errors.New("sdjwt: no tilde separator")
+	}
+	issuerJWT = parts[0]
+	if last := parts[len(parts)-1]; len(last) != 0 {
+		kbJWT = last
+	}
+	for _, p := range parts[1 : len(parts)-1] {
+		d, err := ParseDisclosure(string(p))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		disclosures = append(disclosures, d)
+	}
+	return issuerJWT, disclosures, kbJWT, nil
+}
+
+// Bind appends a Key Binding JWT to an SD-JWT (without one) for the audience,
+// with the nonce. The key must match the "cnf" claim of the issuer-signed JWT.
+func Bind(sdJWT []byte, audience, nonce string, alg string, key crypto.PrivateKey) ([]byte, error) {
+	if len(sdJWT) == 0 || sdJWT[len(sdJWT)-1] != '~' {
+		return nil, errors.New("sdjwt: SD-JWT must end with a tilde for key binding")
+	}
+	issuerJWT, _, _, err := Split(sdJWT)
+	if err != nil {
+		return nil, err
+	}
+	unverified, err := jwt.ParseWithoutCheck(issuerJWT)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := sdHash(unverified)
+	if err != nil {
+		return nil, err
+	}
+
+	var c jwt.Claims
+	c.IssuedNow()
+	c.Audiences = []string{audience}
+	c.Set = map[string]interface{}{
+		"nonce":   nonce,
+		"sd_hash": digest(hash, sdJWT),
+	}
+	kbJWT, err := c.Sign(alg, key, json.RawMessage(`{"typ":"`+TypeKeyBinding+`"}`))
+	if err != nil {
+		return nil, err
+	}
+	return append(sdJWT[:len(sdJWT):len(sdJWT)], kbJWT...), nil
+}
+
+func sdHash(c *jwt.Claims) (crypto.Hash, error) {
+	algName := DefaultHashAlg
+	if v, ok := c.Set["_sd_alg"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return 0, errors.New("sdjwt: _sd_alg claim not a string")
+		}
+		algName = s
+	}
+	return hashLookup(algName)
+}
+
+func digest(hash crypto.Hash, data []byte) string {
+	h := hash.New()
+	h.Write(data)
+	return encoding.EncodeToString(h.Sum(nil))
+}
+
+// Verifier checks SD-JWTs. Any modifications should be made before first use.
+type Verifier struct {
+	// Keys verify the issuer-signed JWT.
+	Keys *jwt.KeyRegister
+
+	// RequireKeyBinding rejects presentations without a Key Binding JWT.
+	RequireKeyBinding bool
+
+	// Audience and Nonce must match the Key Binding JWT when not empty.
+	Audience, Nonce string
+
+	// KeyBindingMaxAge limits the age of the Key Binding JWT ("iat").
+	// Zero defaults to 5 minutes.
+	KeyBindingMaxAge time.Duration
+
+	// Clock provides the time for Key Binding validation. Nil defaults
+	// to time.Now.
+	Clock func() time.Time
+}
+
+// Errors from the Key Binding JWT verification.
+var (
+	ErrNoKeyBinding   = errors.New("sdjwt: Key Binding JWT required")
+	ErrKeyBindingHash = errors.New("sdjwt: Key Binding JWT sd_hash mismatch")
+)
+
+// Check parses an SD-JWT if, and only if, the issuer signature checks out, all
+// disclosures match a digest, and the Key Binding JWT, if any, checks out with
+// the key from the "cnf" claim. The return has the disclosed claims in Set,
+// including any names of the Registered fields, and the "_sd" and "_sd_alg"
+// claims are removed. Raw remains the payload of the issuer-signed JWT as is.
+// Use Claims.Valid to complete the verification.
+func (v *Verifier) Check(sdJWT []byte) (*jwt.Claims, error) {
+	issuerJWT, disclosures, kbJWT, err := Split(sdJWT)
+	if err != nil {
+		return nil, err
+	}
+	c, err := v.Keys.Check(issuerJWT)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := sdHash(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if kbJWT != nil {
+		if err := v.checkKeyBinding(c, kbJWT, digest(hash, sdJWT[:len(sdJWT)-len(kbJWT)])); err != nil {
+			return nil, err
+		}
+	} else if v.RequireKeyBinding {
+		return nil, ErrNoKeyBinding
+	}
+
+	byDigest := make(map[string]*Disclosure, len(disclosures))
+	for _, d := range disclosures {
+		s := d.Digest(hash)
+		if _, ok := byDigest[s]; ok {
+			return nil, errors.New("sdjwt: duplicate disclosure")
+		}
+		byDigest[s] = d
+	}
+
+	if c.Set == nil {
+		c.Set = make(map[string]interface{})
+	}
+	delete(c.Set, "_sd_alg")
+	p := processor{byDigest: byDigest, seen: make(map[string]bool)}
+	if err := p.object(c.Set); err != nil {
+		return nil, err
+	}
+	if len(p.seen) != len(byDigest) {
+		return nil, errors.New("sdjwt: disclosure without a digest in the payload")
+	}
+	return c, nil
+}
+
+func (v *Verifier) checkKeyBinding(c *jwt.Claims, kbJWT []byte, sdHashWant string) error {
+	cnf, ok := c.Set["cnf"].(map[string]interface{})
+	if !ok {
+		return errors.New("sdjwt: Key Binding JWT without cnf claim in issuer-signed JWT")
+	}
+	jwk, ok := cnf["jwk"]
+	if !ok {
+		return errors.New("sdjwt: cnf claim without jwk")
+	}
+	jwkJSON, err := json.Marshal(jwk)
+	if err != nil {
+		return err
+	}
+	var holder jwt.KeyRegister
+	if _, err := holder.LoadJWK(jwkJSON); err != nil {
+		return fmt.Errorf("sdjwt: cnf claim: %w", err)
+	}
+
+	kb, err := holder.Check(kbJWT)
+	if err != nil {
+		return err
+	}
+	header, err := kb.Header()
+	if err != nil {
+		return err
+	}
+	if header.Type != TypeKeyBinding {
+		return fmt.Errorf("sdjwt: Key Binding JWT with typ %q", header.Type)
+	}
+
+	if s, _ := kb.Set["sd_hash"].(string); s != sdHashWant {
+		return ErrKeyBindingHash
+	}
+	if v.Audience != "" && (len(kb.Audiences) == 0 || !kb.AcceptAudience(v.Audience)) {
+		return fmt.Errorf("sdjwt: Key Binding JWT not for audience %q", v.Audience)
+	}
+	if nonce, _ := kb.Set["nonce"].(string); v.Nonce != "" && nonce != v.Nonce {
+		return errors.New("sdjwt: Key Binding JWT nonce mismatch")
+	}
+
+	if kb.Issued == nil {
+		return errors.New("sdjwt: Key Binding JWT without iat")
+	}
+	now := time.Now()
+	if v.Clock != nil {
+		now = v.Clock()
+	}
+	maxAge := v.KeyBindingMaxAge
+	if maxAge == 0 {
+		maxAge = 5 * time.Minute
+	}
+	if issued := kb.Issued.Time(); issued.After(now.Add(time.Minute)) || now.Sub(issued) > maxAge {
+		return errors.New("sdjwt: Key Binding JWT not issued recently")
+	}
+	if !kb.Valid(now) {
+		return errors.New("sdjwt: Key Binding JWT not valid at current time")
+	}
+	return nil
+}
+
+// Processor substitutes digests with their disclosure, conform RFC 9901,
+// subsection 7.1.
+type processor struct {
+	byDigest map[string]*Disclosure
+	seen     map[string]bool
+}
+
+func (p *processor) claim(digest string) (*Disclosure, error) {
+	d, ok := p.byDigest[digest]
+	if !ok {
+		return nil, nil // decoy or undisclosed
+	}
+	if p.seen[digest] {
+		return nil, errors.New("sdjwt: digest occurs more than once")
+	}
+	p.seen[digest] = true
+	return d, nil
+}
+
+func (p *processor) object(m map[string]interface{}) error {
+	if v, ok := m["_sd"]; ok {
+		delete(m, "_sd")
+		a, ok := v.([]interface{})
+		if !ok {
+			return errors.New("sdjwt: _sd claim not an array")
+		}
+		for _, o := range a {
+			s, ok := o.(string)
+			if !ok {
+				return errors.New("sdjwt: _sd claim with non-string entry")
+			}
+			d, err := p.claim(s)
+			if err != nil {
+				return err
+			}
+			if d == nil {
+				continue
+			}
+			if d.Name == "" {
+				return errors.New("sdjwt: array element disclosure in _sd claim")
+			}
+			if _, ok := m[d.Name]; ok {
+				return fmt.Errorf("sdjwt: disclosure of %q overrides a claim", d.Name)
+			}
+			m[d.Name] = d.Value
+		}
+	}
+
+	for name, v := range m {
+		v, err := p.value(v)
+		if err != nil {
+			return err
+		}
+		m[name] = v
+	}
+	return nil
+}
+
+// Value returns the value with its disclosures.
+func (p *processor) value(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return v, p.object(v)
+	case []interface{}:
+		return p.array(v)
+	}
+	return v, nil
+}
+
+// Array returns the elements with their disclosures, in place.
+func (p *processor) array(a []interface{}) ([]interface{}, error) {
+	out := a[:0]
+	for _, o := range a {
+		if m, ok := o.(map[string]interface{}); ok && len(m) == 1 {
+			if s, ok := m["..."].(string); ok {
+				d, err := p.claim(s)
+				if err != nil {
+					return nil, err
+				}
+				if d == nil {
+					continue // element not disclosed
+				}
+				if d.Name != "" {
+					return nil, errors.New("sdjwt: object property disclosure in array")
+				}
+				o = d.Value
+			}
+		}
+		o, err := p.value(o)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
@@ -0,0 +1,205 @@
+package sdjwt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+var issuerSecret = []byte("guest")
+
+// IssueTest returns an SD-JWT with all disclosures, bound to the holder key.
+func issueTest(t *testing.T, holder ed25519.PublicKey) []byte {
+	t.Helper()
+	var c jwt.Claims
+	c.Issuer = "https://issuer.example.com"
+	c.ExpiresIn(time.Hour)
+	c.Set = map[string]interface{}{
+		"given_name":  "John",
+		"family_name": "Doe",
+		"address": map[string]interface{}{
+			"street_address": "123 Main St",
+			"country":        "US",
+		},
+		"nationalities": []interface{}{"US", "DE"},
+		"cnf": map[string]interface{}{"jwk": map[string]interface{}{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   encoding.EncodeToString(holder),
+		}},
+	}
+
+	disclosures, err := Conceal(c.Set["address"].(map[string]interface{}), "street_address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	elements, err := ConcealElements(c.Set["nationalities"].([]interface{}), "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disclosures = append(disclosures, elements...)
+	top, err := Conceal(c.Set, "given_name", "family_name", "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disclosures = append(disclosures, top...)
+
+	sdJWT, err := Issue(&c, jwt.HS256, issuerSecret, disclosures, json.RawMessage(`{"typ":"`+TypeSDJWT+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sdJWT
+}
+
+func TestCheck(t *testing.T) {
+	holderPub, holderKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdJWT := issueTest(t, holderPub)
+	v := &Verifier{Keys: &jwt.KeyRegister{Secrets: [][]byte{issuerSecret}}}
+
+	c, err := v.Check(sdJWT)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	want := map[string]interface{}{
+		"given_name":  "John",
+		"family_name": "Doe",
+		"address": map[string]interface{}{
+			"street_address": "123 Main St",
+			"country":        "US",
+		},
+		"nationalities": []interface{}{"US", "DE"},
+	}
+	delete(c.Set, "cnf")
+	if !reflect.DeepEqual(c.Set, want) {
+		t.Errorf("got claims %#v, want %#v", c.Set, want)
+	}
+	if c.Issuer != "https://issuer.example.com" {
+		t.Errorf("got issuer %q", c.Issuer)
+	}
+
+	// holder selects the family name only
+	issuerJWT, disclosures, _, err := Split(sdJWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var selection []*Disclosure
+	for _, d := range disclosures {
+		if d.Name == "family_name" {
+			selection = append(selection, d)
+		}
+	}
+	presentation, err := Bind(Present(issuerJWT, selection), "https://verifier.example.com", "n-0S6_WzA2Mj", jwt.EdDSA, holderKey)
+	if err != nil {
+		t.Fatal("bind error:", err)
+	}
+	v.RequireKeyBinding = true
+	v.Audience = "https://verifier.example.com"
+	v.Nonce = "n-0S6_WzA2Mj"
+	c, err = v.Check(presentation)
+	if err != nil {
+		t.Fatal("check with key binding error:", err)
+	}
+	delete(c.Set, "cnf")
+	want = map[string]interface{}{
+		"family_name":   "Doe",
+		"nationalities": []interface{}{"US"},
+	}
+	if !reflect.DeepEqual(c.Set, want) {
+		t.Errorf("got claims %#v, want %#v", c.Set, want)
+	}
+
+	v.Nonce = "replay"
+	if _, err := v.Check(presentation); err == nil {
+		t.Error("nonce mismatch accepted")
+	}
+	v.Nonce = ""
+	v.Clock = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := v.Check(presentation); err == nil {
+		t.Error("stale key binding accepted")
+	}
+	v.Clock = nil
+	if _, err := v.Check(sdJWT); err != ErrNoKeyBinding {
+		t.Errorf("got error %v without key binding, want %v", err, ErrNoKeyBinding)
+	}
+}
+
+func TestCheckReject(t *testing.T) {
+	holderPub, holderKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdJWT := issueTest(t, holderPub)
+	v := &Verifier{Keys: &jwt.KeyRegister{Secrets: [][]byte{issuerSecret}}}
+	issuerJWT, disclosures, _, err := Split(sdJWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// disclosure from another issuance
+	alien, err := NewDisclosure("given_name", "Mallory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Check(Present(issuerJWT, append(disclosures, alien))); err == nil {
+		t.Error("unreferenced disclosure accepted")
+	}
+	if _, err := v.Check(Present(issuerJWT, append(disclosures, disclosures[0]))); err == nil {
+		t.Error("duplicate disclosure accepted")
+	}
+
+	// key binding over other disclosures
+	bound, err := Bind(Present(issuerJWT, disclosures[:1]), "aud", "nonce", jwt.EdDSA, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kbJWT := bound[bytes.LastIndexByte(bound, '~')+1:]
+	swapped := append(Present(issuerJWT, disclosures[1:2]), kbJWT...)
+	if _, err := v.Check(swapped); err != ErrKeyBindingHash {
+		t.Errorf("got error %v for swapped disclosures, want %v", err, ErrKeyBindingHash)
+	}
+
+	// key binding by other key
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, err = Bind(sdJWT, "aud", "nonce", jwt.EdDSA, otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Check(bound); err != jwt.ErrSigMiss {
+		t.Errorf("got error %v for other holder key, want %v", err, jwt.ErrSigMiss)
+	}
+}
+
+func TestParseDisclosure(t *testing.T) {
+	// example from RFC 9901, subsection 4.2.1
+	d, err := ParseDisclosure("WyJfMjZiYzRMVC1hYzZxMktJNmNCVzVlcyIsICJmYW1pbHlfbmFtZSIsICJNw7ZiaXVzIl0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Salt != "_26bc4LT-ac6q2KI6cBW5es" || d.Name != "family_name" || d.Value != "Möbius" {
+		t.Errorf("got %+v", d)
+	}
+	if got, want := d.Digest(HashAlgs["sha-256"]), "X9yH0Ajrdm1Oij4tWso9UzzKJvPoDxwmuEcO3XAdRC0"; got != want {
+		t.Errorf("got digest %q, want %q", got, want)
+	}
+
+	for _, s := range []string{"", "e30", "WyJzYWx0Il0", "WyJzYWx0IiwiX3NkIiwxXQ"} {
+		if _, err := ParseDisclosure(s); err == nil {
+			t.Errorf("disclosure %q accepted", s)
+		} else if !strings.HasPrefix(err.Error(), "sdjwt: ") {
+			t.Errorf("disclosure %q got error %q without package prefix", s, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrNoSession signals an HTTP request without session cookie.
+var ErrNoSession = errors.New("jwt: no session cookie")
+
+var errSessionID = errors.New("jwt: session without ID")
+
+// Sessions manages browser sessions with a signed JWT in an HttpOnly cookie.
+// Each session gets a random ID ("jti"), which Logout pushes to Revocation.
+// Tokens are re-issued silently when their remaining lifetime drops below
+// RenewBefore, which gives a sliding expiration, optionally capped by MaxAge
+// since the login ("auth_time"). Any modifications to the exported fields
+// should be made before first use.
+type Sessions struct {
+	// CookieName defaults to "session" when empty.
+	CookieName string
+	// Path and Domain are the cookie attributes. An empty Path
+	// defaults to "/".
+	Path, Domain string
+	// Insecure omits the Secure attribute, e.g., for plain HTTP on
+	// localhost during development.
+	Insecure bool
+	// SameSite is the cookie attribute. Zero defaults to Lax.
+	SameSite http.SameSite
+
+	// Alg and Key apply as with Claims.Sign.
+	Alg string
+	Key crypto.PrivateKey
+	// Keys verify the session tokens, i.e., the public key of Key, or
+	// the secret in case of HMAC.
+	Keys *KeyRegister
+
+	// Lifetime is the validity of each token. Zero defaults to an hour.
+	Lifetime time.Duration
+	// RenewBefore is the remaining lifetime at which tokens get
+	// replaced. Zero defaults to half the Lifetime.
+	RenewBefore time.Duration
+	// MaxAge limits the total session duration, renewals included.
+	// Zero disables the limit.
+	MaxAge time.Duration
+
+	// Revocation receives the session ID on Logout, and it is
+	// consulted on each request. Nil disables revocation, in which
+	// case Logout only clears the cookie.
+	Revocation Revocation
+
+	// Clock provides the time for validation and renewal. Nil
+	// defaults to time.Now.
+	Clock func() time.Time
+}
+
+func (s *Sessions) cookieName() string {
+	if s.CookieName != "" {
+		return s.CookieName
+	}
+	return "session"
+}
+
+func (s *Sessions) lifetime() time.Duration {
+	if s.Lifetime > 0 {
+		return s.Lifetime
+	}
+	return time.Hour
+}
+
+func (s *Sessions) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+	return time.Now()
+}
+
+// Login starts a session with the claims as a template, and it sets the cookie
+// on the response. The Registered time fields and the ID are overwritten. The
+// return has the claims of the session token.
+func (s *Sessions) Login(w http.ResponseWriter, template *Claims) (*Claims, error) {
+	c := new(Claims)
+	if template != nil {
+		c = template.Clone()
+	}
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	c.ID = encoding.EncodeToString(id[:])
+	if c.Set == nil {
+		c.Set = make(map[string]interface{})
+	}
+	c.Set["auth_time"] = float64(s.now().Unix())
+	return c, s.issue(w, c)
+}
+
+// Issue signs the claims with a new expiry, and it sets the cookie.
+func (s *Sessions) issue(w http.ResponseWriter, c *Claims) error {
+	now := s.now().Truncate(time.Second)
+	expires := now.Add(s.lifetime())
+	if limit, ok := s.limit(c); ok && expires.After(limit) {
+		expires = limit
+	}
+	c.Issued = NewNumericTime(now)
+	c.NotBefore = NewNumericTime(now)
+	c.Expires = NewNumericTime(expires)
+
+	token, err := c.Sign(s.Alg, s.Key)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, s.cookie(string(token), expires))
+	return nil
+}
+
+// Limit returns the end of the session conform MaxAge, if any.
+func (s *Sessions) limit(c *Claims) (time.Time, bool) {
+	if s.MaxAge <= 0 {
+		return time.Time{}, false
+	}
+	authTime, ok := c.Number("auth_time")
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(authTime), 0).Add(s.MaxAge), true
+}
+
+func (s *Sessions) cookie(value string, expires time.Time) *http.Cookie {
+	c := &http.Cookie{
+		Name:     s.cookieName(),
+		Value:    value,
+		Path:     s.Path,
+		Domain:   s.Domain,
+		Expires:  expires,
+		Secure:   !s.Insecure,
+		HttpOnly: true,
+		SameSite: s.SameSite,
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if c.SameSite == 0 {
+		c.SameSite = http.SameSiteLaxMode
+	}
+	if value == "" {
+		c.MaxAge = -1 // delete
+	}
+	return c
+}
+
+// Session returns the claims of a valid session from the request cookie. The
+// token is re-issued on the response when RenewBefore applies, and MaxAge did
+// not pass yet. Requests without cookie get ErrNoSession, and revoked sessions
+// get ErrRevoked.
+func (s *Sessions) Session(w http.ResponseWriter, r *http.Request) (*Claims, error) {
+	cookie, err := r.Cookie(s.cookieName())
+	if err != nil {
+		return nil, ErrNoSession
+	}
+	c, err := s.Keys.Check([]byte(cookie.Value))
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if !c.Valid(now) {
+		return nil, errTimeConstraints
+	}
+	if c.ID == "" {
+		return nil, errSessionID
+	}
+	if s.Revocation != nil && s.Revocation.Revoked(c.ID) {
+		return nil, ErrRevoked
+	}
+
+	renewBefore := s.RenewBefore
+	if renewBefore == 0 {
+		renewBefore = s.lifetime() / 2
+	}
+	if !c.ShouldRenew(renewBefore, now) {
+		return c, nil
+	}
+	if limit, ok := s.limit(c); ok && !limit.After(c.Expires.Time()) {
+		return c, nil // can't extend
+	}
+	renewal := c.Clone()
+	if err := s.issue(w, renewal); err != nil {
+		return nil, err
+	}
+	return renewal, nil
+}
+
+// Logout ends the session from the request, if any, and it clears the cookie
+// on the response. Invalid sessions are ignored.
+func (s *Sessions) Logout(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, s.cookie("", time.Unix(0, 0)))
+
+	cookie, err := r.Cookie(s.cookieName())
+	if err != nil || s.Revocation == nil {
+		return nil
+	}
+	c, err := s.Keys.Check([]byte(cookie.Value))
+	if err != nil || c.ID == "" || !c.Valid(s.now()) {
+		return nil
+	}
+	// any concurrent renewal expires within a lifetime
+	return s.Revocation.Revoke(c.ID, c.Expires.Time().Add(s.lifetime()))
+}
+
+// Handler returns middleware which passes requests with a valid session to
+// target, with the claims in the request context under key. Requests without a
+// valid session get a 401 (Unauthorized) response from unauthorized, or from
+// http.Error when nil.
+func (s *Sessions) Handler(target http.Handler, key interface{}, unauthorized http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := s.Session(w, r)
+		if err != nil {
+			if unauthorized != nil {
+				unauthorized.ServeHTTP(w, r)
+			} else {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+			}
+			return
+		}
+		target.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key, c)))
+	})
+}
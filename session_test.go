@@ -0,0 +1,150 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestSessions(now *time.Time) *Sessions {
+	return &Sessions{
+		Alg:        HS256,
+		Key:        []byte("guest"),
+		Keys:       &KeyRegister{Secrets: [][]byte{[]byte("guest")}},
+		Lifetime:   time.Hour,
+		MaxAge:     3 * time.Hour,
+		Revocation: new(RevocationList),
+		Clock:      func() time.Time { return *now },
+	}
+}
+
+// SessionCookie returns the cookie set on the response, if any.
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session" {
+			if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode {
+				t.Errorf("got cookie %s, want HttpOnly, Secure and SameSite=Lax", c)
+			}
+			return c
+		}
+	}
+	return nil
+}
+
+func TestSessions(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	s := newTestSessions(&now)
+
+	var template Claims
+	template.Subject = "Alice"
+	w := httptest.NewRecorder()
+	if _, err := s.Login(w, &template); err != nil {
+		t.Fatal("login error:", err)
+	}
+	cookie := sessionCookie(t, w)
+	if cookie == nil {
+		t.Fatal("no cookie on login")
+	}
+
+	var got *Claims
+	handler := s.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Context().Value("session").(*Claims)
+	}), "session", nil)
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve(); w.Code != http.StatusOK || sessionCookie(t, w) != nil {
+		t.Errorf("got status %d with cookie %v, want 200 without re-issue", w.Code, sessionCookie(t, w))
+	}
+	if got == nil || got.Subject != "Alice" {
+		t.Fatalf("got session claims %v, want subject Alice", got)
+	}
+	id := got.ID
+
+	// sliding expiration
+	now = now.Add(45 * time.Minute)
+	w = serve()
+	renewed := sessionCookie(t, w)
+	if w.Code != http.StatusOK || renewed == nil {
+		t.Fatalf("got status %d with cookie %v, want 200 with re-issue", w.Code, renewed)
+	}
+	if got.ID != id || got.Remaining(now) != time.Hour {
+		t.Errorf("got ID %q with %s remaining, want ID %q with an hour remaining", got.ID, got.Remaining(now), id)
+	}
+	cookie = renewed
+
+	// capped by MaxAge
+	for i := 0; i < 2; i++ {
+		now = now.Add(45 * time.Minute)
+		w = serve()
+		if w.Code != http.StatusOK || sessionCookie(t, w) == nil {
+			t.Fatalf("got status %d with cookie %v, want 200 with re-issue", w.Code, sessionCookie(t, w))
+		}
+		cookie = sessionCookie(t, w)
+	}
+	if want := 45 * time.Minute; got.Remaining(now) != want {
+		t.Errorf("got %s remaining, want %s", got.Remaining(now), want)
+	}
+	now = now.Add(25 * time.Minute)
+	if w := serve(); w.Code != http.StatusOK || sessionCookie(t, w) != nil {
+		t.Errorf("got status %d with cookie %v, want 200 without re-issue beyond MaxAge", w.Code, sessionCookie(t, w))
+	}
+
+	// logout
+	req := httptest.NewRequest("POST", "/logout", nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	if err := s.Logout(w, req); err != nil {
+		t.Fatal("logout error:", err)
+	}
+	if c := sessionCookie(t, w); c == nil || c.Value != "" || c.MaxAge >= 0 {
+		t.Errorf("got logout cookie %v, want deletion", c)
+	}
+	if w := serve(); w.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d after logout, want 401", w.Code)
+	}
+	if _, err := s.Session(httptest.NewRecorder(), req); err != ErrRevoked {
+		t.Errorf("got error %v after logout, want %v", err, ErrRevoked)
+	}
+}
+
+func TestSessionsReject(t *testing.T) {
+	now := time.Now()
+	s := newTestSessions(&now)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := s.Session(httptest.NewRecorder(), req); err != ErrNoSession {
+		t.Errorf("got error %v without cookie, want %v", err, ErrNoSession)
+	}
+
+	w := httptest.NewRecorder()
+	if _, err := s.Login(w, nil); err != nil {
+		t.Fatal("login error:", err)
+	}
+	req.AddCookie(sessionCookie(t, w))
+	now = now.Add(2 * time.Hour)
+	if _, err := s.Session(httptest.NewRecorder(), req); err != errTimeConstraints {
+		t.Errorf("got error %v when expired, want %v", err, errTimeConstraints)
+	}
+
+	// token without ID
+	var c Claims
+	c.ExpiresIn(time.Hour)
+	token, err := c.HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = time.Now()
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: string(token)})
+	if _, err := s.Session(httptest.NewRecorder(), req); err != errSessionID {
+		t.Errorf("got error %v without ID, want %v", err, errSessionID)
+	}
+}
@@ -2,17 +2,35 @@ package jwt
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
+	"encoding/asn1"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
+	"math/big"
+	"time"
 )
 
+// DeterministicECDSA makes ECDSA signing derive the nonce from the private key
+// and the message digest, conform RFC 6979, instead of reading it from
+// crypto/rand. Identical claims then produce identical tokens with the same
+// key, which gives reproducible artifacts, and it removes the dependency on
+// entropy quality at the time of signing. Verification is unaffected. Keys in
+// the form of a crypto.Signer are out of scope. Any modifications should be
+// made before first use.
+//
+// WARNING: Builds with Go 1.24 or later use the constant-time implementation
+// of the standard library for the NIST curves. Older versions of Go, and other
+// curves, get arithmetic on the nonce in variable time, which may leak the
+// private key to anyone who can measure the duration of signing. Leave the
+// option off in such setups.
+var DeterministicECDSA bool
+
 // FormatWithoutSign updates the Raw fields and returns a new JWT, with only the
 // first two parts.
 //
@@ -25,6 +43,39 @@ func (c *Claims) FormatWithoutSign(alg string, extraHeaders ...json.RawMessage)
 	return c.newToken(alg, 0, extraHeaders)
 }
 
+// FormatUnsecured updates the Raw fields and returns a new Unsecured JWT, with
+// "none" for the algorithm and an empty signature.
+//
+//	token :≡ header-base64 '.' payload-base64 '.'
+//
+// “An Unsecured JWT is a JWS using the "alg" Header Parameter value "none" and
+// with the empty string for its JWS Signature value” — RFC 7519, subsection 6.1
+//
+// Such tokens carry no integrity protection whatsoever. Use them only when the
+// transport authenticates the content already. None of the Check functions nor
+// a KeyRegister accept the "none" algorithm. Read with ParseWithoutCheck.
+//
+// The JOSE header (content) can be extended with extraHeaders, in the form of
+// JSON objects. Redundant and/or duplicate keys are applied as provided.
+func (c *Claims) FormatUnsecured(extraHeaders ...json.RawMessage) (token []byte, err error) {
+	token, err = c.newToken("none", 0, extraHeaders)
+	if err != nil {
+		return nil, err
+	}
+	return append(token, '.'), nil
+}
+
+// Sign updates the Raw fields and returns a new JWT. The key type must match
+// alg, as described at SignBytes. A crypto.Signer, such as a key in a hardware
+// security module or a remote key management service, works for ECDSAAlgs,
+// RSAAlgs and EdDSA.
+//
+// The JOSE header (content) can be extended with extraHeaders, in the form of
+// JSON objects. Redundant and/or duplicate keys are applied as provided.
+func (c *Claims) Sign(alg string, key crypto.PrivateKey, extraHeaders ...json.RawMessage) (token []byte, err error) {
+	return sign(alg, key, c.formatFunc(extraHeaders))
+}
+
 // ECDSASign updates the Raw fields and returns a new JWT.
 // The return is an AlgError when alg is not in ECDSAAlgs.
 // The caller must use the correct key for the respective algorithm (P-256 for
@@ -33,6 +84,262 @@ func (c *Claims) FormatWithoutSign(alg string, extraHeaders ...json.RawMessage)
 // The JOSE header (content) can be extended with extraHeaders, in the form of
 // JSON objects. Redundant and/or duplicate keys are applied as provided.
 func (c *Claims) ECDSASign(alg string, key *ecdsa.PrivateKey, extraHeaders ...json.RawMessage) (token []byte, err error) {
+	return ecdsaSign(alg, key, c.formatFunc(extraHeaders))
+}
+
+// EdDSASign updates the Raw fields and returns a new JWT.
+//
+// The JOSE header (content) can be extended with extraHeaders, in the form of
+// JSON objects. Redundant and/or duplicate keys are applied as provided.
+func (c *Claims) EdDSASign(key ed25519.PrivateKey, extraHeaders ...json.RawMessage) (token []byte, err error) {
+	return eddsaSign(key, c.formatFunc(extraHeaders))
+}
+
+// HMACSign updates the Raw fields and returns a new JWT.
+// The return is an AlgError when alg is not in HMACAlgs.
+//
+// The JOSE header (content) can be extended with extraHeaders, in the form of
+// JSON objects. Redundant and/or duplicate keys are applied as provided.
+func (c *Claims) HMACSign(alg string, secret []byte, extraHeaders ...json.RawMessage) (token []byte, err error) {
+	return hmacSign(alg, secret, c.formatFunc(extraHeaders))
+}
+
+// RSASign updates the Raw fields and returns a new JWT.
+// The return is an AlgError when alg is not in RSAAlgs.
+//
+// The JOSE header (content) can be extended with extraHeaders, in the form of
+// JSON objects. Redundant and/or duplicate keys are applied as provided.
+func (c *Claims) RSASign(alg string, key *rsa.PrivateKey, extraHeaders ...json.RawMessage) (token []byte, err error) {
+	return rsaSign(alg, key, c.formatFunc(extraHeaders))
+}
+
+// SignBytes returns a new JWS in the compact serialization, with payload as is
+// for content. Any type of content is permitted, such as CBOR, Protocol Buffers
+// or plain text. Use KeyRegister.VerifyBytes for the counterpart.
+//
+// The key type must match alg: *ecdsa.PrivateKey for ECDSAAlgs, a non-empty
+// []byte for HMACAlgs, *rsa.PrivateKey for RSAAlgs, ed25519.PrivateKey for
+// EdDSA, or whatever the algorithm from RegisterAlg takes. Any other
+// crypto.Signer works for ECDSAAlgs, RSAAlgs and EdDSA too. The return is an
+// AlgError when alg is none of those.
+//
+// The JOSE header (content) can be extended with extraHeaders, in the form of
+// JSON objects. Redundant and/or duplicate keys are applied as provided. A key
+// identifier goes in there too, e.g., json.RawMessage(`{"kid":"№1"}`).
+func SignBytes(payload []byte, alg string, key crypto.PrivateKey, extraHeaders ...json.RawMessage) (token []byte, err error) {
+	format := func(alg string, encSigLen int) ([]byte, error) {
+		c := Claims{Raw: payload}
+		return c.format(alg, encSigLen, extraHeaders)
+	}
+	return sign(alg, key, format)
+}
+
+// Sign dispatches on alg and the key type.
+func sign(alg string, key crypto.PrivateKey, format formatFunc) (token []byte, err error) {
+	if alg == EdDSA {
+		switch k := key.(type) {
+		case ed25519.PrivateKey:
+			return eddsaSign(k, format)
+		case crypto.Signer:
+			return signerSign(alg, k, format)
+		}
+		return nil, keyTypeError(alg, key)
+	}
+	if _, ok := ECDSAAlgs[alg]; ok {
+		switch k := key.(type) {
+		case *ecdsa.PrivateKey:
+			return ecdsaSign(alg, k, format)
+		case crypto.Signer:
+			return signerSign(alg, k, format)
+		}
+		return nil, keyTypeError(alg, key)
+	}
+	if _, ok := HMACAlgs[alg]; ok {
+		k, ok := key.([]byte)
+		if !ok {
+			return nil, keyTypeError(alg, key)
+		}
+		return hmacSign(alg, k, format)
+	}
+	if _, ok := RSAAlgs[alg]; ok {
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return rsaSign(alg, k, format)
+		case crypto.Signer:
+			return signerSign(alg, k, format)
+		}
+		return nil, keyTypeError(alg, key)
+	}
+	return registeredSign(alg, key, format)
+}
+
+// JSONSigner is a signature specification for SignJSON.
+type JSONSigner struct {
+	Alg   string            // algorithm identifier
+	Key   crypto.PrivateKey // see SignBytes for the types per algorithm
+	KeyID string            // optional "kid" (in the protected header)
+}
+
+// SignJSON updates the Raw field and returns a new JWT in the General JWS JSON
+// Serialization, as per RFC 7515, subsection 7.2.1, with a signature for each
+// signer in order. Multiple signatures permit tokens which verify with either
+// the old or the new key during key rotation, for example. RawHeader is left
+// unmodified, as each signature has its own JOSE header. Use
+// KeyRegister.CheckJSON for the counterpart.
+func (c *Claims) SignJSON(signers ...JSONSigner) (serialization []byte, err error) {
+	if len(signers) == 0 {
+		return nil, errors.New("jwt: JSON serialization without signers")
+	}
+	if err := c.sync(); err != nil {
+		return nil, err
+	}
+
+	type signature struct {
+		Protected string `json:"protected"`
+		Signature string `json:"signature"`
+	}
+	var general struct {
+		Payload    string      `json:"payload"`
+		Signatures []signature `json:"signatures"`
+	}
+	general.Payload = encoding.EncodeToString(c.Raw)
+	general.Signatures = make([]signature, len(signers))
+
+	for i, signer := range signers {
+		var extraHeaders []json.RawMessage
+		if signer.KeyID != "" {
+			kid, err := json.Marshal(map[string]string{headerKeyID: signer.KeyID})
+			if err != nil {
+				return nil, err
+			}
+			extraHeaders = append(extraHeaders, kid)
+		}
+		token, err := SignBytes(c.Raw, signer.Alg, signer.Key, extraHeaders...)
+		if err != nil {
+			return nil, err
+		}
+
+		// split compact serialization
+		firstDot := bytes.IndexByte(token, '.')
+		lastDot := bytes.LastIndexByte(token, '.')
+		general.Signatures[i].Protected = string(token[:firstDot])
+		general.Signatures[i].Signature = string(token[lastDot+1:])
+	}
+
+	return json.Marshal(&general)
+}
+
+// SigningProfile fixes how tokens for one purpose get signed.
+type SigningProfile struct {
+	Alg   string            // algorithm, as with Claims.Sign
+	Key   crypto.PrivateKey // credentials, as with Claims.Sign
+	KeyID string            // optional "kid" for the JOSE header
+
+	// Lifetime sets the expiry relative to the issue time. Profiles
+	// without a positive Lifetime can't sign any token.
+	Lifetime time.Duration
+
+	Issuer    string   // optional "iss" claim
+	Audiences []string // optional "aud" claim
+}
+
+// ProfileError signals that the purpose has no entry in a SignerSet.
+type ProfileError string
+
+// Error honors the error interface.
+func (e ProfileError) Error() string {
+	return fmt.Sprintf("jwt: signing profile %q not in use", string(e))
+}
+
+// SignerSet maps signing profiles by purpose, e.g., the audience, such that
+// application code asks for a token for some service, without any choice of
+// key, algorithm or lifetime.
+type SignerSet map[string]*SigningProfile
+
+// Sign updates the Raw fields and returns a new JWT, with the signing profile
+// of purpose. The KeyID, the time constraints (iat, nbf and exp), and the
+// issuer and audiences, when present, are set conform the profile, regardless
+// of any values in c. The return is a ProfileError when the purpose is not in
+// the set.
+func (set SignerSet) Sign(purpose string, c *Claims, extraHeaders ...json.RawMessage) (token []byte, err error) {
+	p := set[purpose]
+	if p == nil {
+		return nil, ProfileError(purpose)
+	}
+	if p.Lifetime <= 0 {
+		return nil, fmt.Errorf("jwt: signing profile %q without lifetime", purpose)
+	}
+
+	c.KeyID = p.KeyID
+	c.ExpiresIn(p.Lifetime)
+	if p.Issuer != "" {
+		c.Issuer = p.Issuer
+	}
+	if len(p.Audiences) != 0 {
+		c.Audiences = append([]string(nil), p.Audiences...)
+	}
+	return c.Sign(p.Alg, p.Key, extraHeaders...)
+}
+
+// Renew returns the token as is, unless its claims ShouldRenew with threshold,
+// in which case it returns the outcome of renew. The token is parsed without
+// any signature check, so it must come from a trusted source, such as a prior
+// renew. Empty and malformed tokens get renewed.
+func Renew(token []byte, threshold time.Duration, renew func() ([]byte, error)) ([]byte, error) {
+	if len(token) != 0 {
+		c, err := ParseWithoutCheck(token)
+		if err == nil && !c.ShouldRenew(threshold, time.Now()) {
+			return token, nil
+		}
+	}
+	return renew()
+}
+
+func keyTypeError(alg string, key crypto.PrivateKey) error {
+	return fmt.Errorf("jwt: %s with unsupported key type %T", alg, key)
+}
+
+// FormatFunc returns a new token without signature, with room for encSigLen
+// of signature (in base64) plus the dot separator in its capacity.
+type formatFunc func(alg string, encSigLen int) ([]byte, error)
+
+func (c *Claims) formatFunc(extraHeaders []json.RawMessage) formatFunc {
+	return func(alg string, encSigLen int) ([]byte, error) {
+		return c.newToken(alg, encSigLen, extraHeaders)
+	}
+}
+
+func registeredSign(alg string, key crypto.PrivateKey, format formatFunc) (token []byte, err error) {
+	a, err := algLookup(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err = format(alg, 0)
+	if err != nil {
+		return nil, err
+	}
+	digestSum := token
+	if hash := a.Hash(); hash != 0 {
+		digest := hash.New()
+		digest.Write(token)
+		digestSum = digest.Sum(nil)
+	}
+
+	sig, err := a.Sign(key, digestSum)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenWithoutSignature := token
+	token = make([]byte, len(token)+1+encoding.EncodedLen(len(sig)))
+	i := copy(token, tokenWithoutSignature)
+	token[i] = '.'
+	encodeBase64URL(token[i+1:], sig)
+	return token, nil
+}
+
+func ecdsaSign(alg string, key *ecdsa.PrivateKey, format formatFunc) (token []byte, err error) {
 	hash, err := hashLookup(alg, ECDSAAlgs)
 	if err != nil {
 		return nil, err
@@ -41,49 +348,122 @@ func (c *Claims) ECDSASign(alg string, key *ecdsa.PrivateKey, extraHeaders ...js
 
 	// signature contains pair (r, s) as per RFC 7518, subsection 3.4
 	paramLen := (key.Curve.Params().BitSize + 7) / 8
-	token, err = c.newToken(alg, encoding.EncodedLen(paramLen*2), extraHeaders)
+	token, err = format(alg, encoding.EncodedLen(paramLen*2))
 	if err != nil {
 		return nil, err
 	}
 	digest.Write(token)
 
-	r, s, err := ecdsa.Sign(rand.Reader, key, digest.Sum(token[len(token):]))
+	var r, s *big.Int
+	if DeterministicECDSA {
+		r, s, err = ecdsaSignDeterministic(key, hash, digest.Sum(token[len(token):]))
+	} else {
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest.Sum(token[len(token):]))
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	rBytes, sBytes := r.Bytes(), s.Bytes()
+	if len(rBytes) > paramLen || len(sBytes) > paramLen {
+		return nil, errors.New("jwt: ECDSA signature exceeds curve size")
+	}
+
 	token = append(token, '.')
 	sig := token[len(token):cap(token)]
-	// serialize r and s, using sig as a buffer
-	i := len(sig)
-	for _, word := range s.Bits() {
-		for bitCount := strconv.IntSize; bitCount > 0; bitCount -= 8 {
-			i--
-			sig[i] = byte(word)
-			word >>= 8
+	// serialize r and s zero-padded to fixed width, using sig as a buffer
+	pair := sig[len(sig)-2*paramLen:]
+	for i := range pair {
+		pair[i] = 0
+	}
+	copy(pair[paramLen-len(rBytes):paramLen], rBytes)
+	copy(pair[2*paramLen-len(sBytes):], sBytes)
+
+	// encoder won't overhaul source space
+	encodeBase64URL(sig, pair)
+	return token[:cap(token)], nil
+}
+
+// EcdsaSignRFC6979 returns the signature of a message digest with the nonce
+// generation from RFC 6979, section 3.2, using the HMAC of hash. The math/big
+// arithmetic with the nonce is NOT constant-time. See ecdsaSignDeterministic.
+func ecdsaSignRFC6979(key *ecdsa.PrivateKey, hash crypto.Hash, digest []byte) (r, s *big.Int, err error) {
+	params := key.Curve.Params()
+	n := params.N
+	if key.D == nil || key.D.Sign() <= 0 || key.D.Cmp(n) >= 0 {
+		return nil, nil, errors.New("jwt: ECDSA private key out of range")
+	}
+	qlen := n.BitLen()
+	rlen := (qlen + 7) / 8
+
+	// bits2int from RFC 6979, subsection 2.3.2
+	bits2int := func(b []byte) *big.Int {
+		i := new(big.Int).SetBytes(b)
+		if excess := len(b)*8 - qlen; excess > 0 {
+			i.Rsh(i, uint(excess))
 		}
+		return i
 	}
-	// i might have exceeded paramLen due to the word size
-	i = len(sig) - paramLen
-	for _, word := range r.Bits() {
-		for bitCount := strconv.IntSize; bitCount > 0; bitCount -= 8 {
-			i--
-			sig[i] = byte(word)
-			word >>= 8
+	// int2octets from RFC 6979, subsection 2.3.3
+	int2octets := func(i *big.Int) []byte {
+		b := i.Bytes()
+		if len(b) >= rlen {
+			return b
 		}
+		return append(make([]byte, rlen-len(b)), b...)
 	}
 
-	// encoder won't overhaul source space
-	encoding.Encode(sig, sig[len(sig)-2*paramLen:])
-	return token[:cap(token)], nil
+	e := bits2int(digest)
+	// bits2octets from RFC 6979, subsection 2.3.4
+	h1 := new(big.Int).Set(e)
+	if h1.Cmp(n) >= 0 {
+		h1.Sub(h1, n)
+	}
+	x := int2octets(key.D)
+	h := int2octets(h1)
+
+	mac := func(k []byte, parts ...[]byte) []byte {
+		m := hmac.New(hash.New, k)
+		for _, p := range parts {
+			m.Write(p)
+		}
+		return m.Sum(nil)
+	}
+	V := bytes.Repeat([]byte{0x01}, hash.Size())
+	K := make([]byte, hash.Size())
+	K = mac(K, V, []byte{0x00}, x, h)
+	V = mac(K, V)
+	K = mac(K, V, []byte{0x01}, x, h)
+	V = mac(K, V)
+
+	for {
+		var T []byte
+		for len(T)*8 < qlen {
+			V = mac(K, V)
+			T = append(T, V...)
+		}
+		k := bits2int(T)
+		if k.Sign() > 0 && k.Cmp(n) < 0 {
+			kx, _ := key.Curve.ScalarBaseMult(k.Bytes())
+			r = new(big.Int).Mod(kx, n)
+			if r.Sign() != 0 {
+				// s = k⁻¹(e + rd) mod n
+				s = new(big.Int).Mul(r, key.D)
+				s.Add(s, e)
+				s.Mul(s, new(big.Int).ModInverse(k, n))
+				s.Mod(s, n)
+				if s.Sign() != 0 {
+					return r, s, nil
+				}
+			}
+		}
+		K = mac(K, V, []byte{0x00})
+		V = mac(K, V)
+	}
 }
 
-// EdDSASign updates the Raw fields and returns a new JWT.
-//
-// The JOSE header (content) can be extended with extraHeaders, in the form of
-// JSON objects. Redundant and/or duplicate keys are applied as provided.
-func (c *Claims) EdDSASign(key ed25519.PrivateKey, extraHeaders ...json.RawMessage) (token []byte, err error) {
-	token, err = c.newToken(EdDSA, encoding.EncodedLen(ed25519.SignatureSize), extraHeaders)
+func eddsaSign(key ed25519.PrivateKey, format formatFunc) (token []byte, err error) {
+	token, err = format(EdDSA, encoding.EncodedLen(ed25519.SignatureSize))
 	if err != nil {
 		return nil, err
 	}
@@ -91,16 +471,11 @@ func (c *Claims) EdDSASign(key ed25519.PrivateKey, extraHeaders ...json.RawMessa
 	sig := ed25519.Sign(key, token)
 
 	token = append(token, '.')
-	encoding.Encode(token[len(token):cap(token)], sig)
+	encodeBase64URL(token[len(token):cap(token)], sig)
 	return token[:cap(token)], nil
 }
 
-// HMACSign updates the Raw fields and returns a new JWT.
-// The return is an AlgError when alg is not in HMACAlgs.
-//
-// The JOSE header (content) can be extended with extraHeaders, in the form of
-// JSON objects. Redundant and/or duplicate keys are applied as provided.
-func (c *Claims) HMACSign(alg string, secret []byte, extraHeaders ...json.RawMessage) (token []byte, err error) {
+func hmacSign(alg string, secret []byte, format formatFunc) (token []byte, err error) {
 	if len(secret) == 0 {
 		return nil, errNoSecret
 	}
@@ -111,7 +486,7 @@ func (c *Claims) HMACSign(alg string, secret []byte, extraHeaders ...json.RawMes
 	}
 	digest := hmac.New(hash.New, secret)
 
-	token, err = c.newToken(alg, encoding.EncodedLen(digest.Size()), extraHeaders)
+	token, err = format(alg, encoding.EncodedLen(digest.Size()))
 	if err != nil {
 		return nil, err
 	}
@@ -120,23 +495,18 @@ func (c *Claims) HMACSign(alg string, secret []byte, extraHeaders ...json.RawMes
 	token = append(token, '.')
 	// use tail as a buffer; encoder won't overhaul source space
 	bufOffset := cap(token) - digest.Size()
-	encoding.Encode(token[len(token):cap(token)], digest.Sum(token[bufOffset:bufOffset]))
+	encodeBase64URL(token[len(token):cap(token)], digest.Sum(token[bufOffset:bufOffset]))
 	return token[:cap(token)], nil
 }
 
-// RSASign updates the Raw fields and returns a new JWT.
-// The return is an AlgError when alg is not in RSAAlgs.
-//
-// The JOSE header (content) can be extended with extraHeaders, in the form of
-// JSON objects. Redundant and/or duplicate keys are applied as provided.
-func (c *Claims) RSASign(alg string, key *rsa.PrivateKey, extraHeaders ...json.RawMessage) (token []byte, err error) {
+func rsaSign(alg string, key *rsa.PrivateKey, format formatFunc) (token []byte, err error) {
 	hash, err := hashLookup(alg, RSAAlgs)
 	if err != nil {
 		return nil, err
 	}
 	digest := hash.New()
 
-	token, err = c.newToken(alg, encoding.EncodedLen(key.Size()), extraHeaders)
+	token, err = format(alg, encoding.EncodedLen(key.Size()))
 	if err != nil {
 		return nil, err
 	}
@@ -155,10 +525,79 @@ func (c *Claims) RSASign(alg string, key *rsa.PrivateKey, extraHeaders ...json.R
 	}
 
 	token = append(token, '.')
-	encoding.Encode(token[len(token):cap(token)], sig)
+	encodeBase64URL(token[len(token):cap(token)], sig)
 	return token[:cap(token)], nil
 }
 
+// SignerSign signs with an opaque key. Signers conform the crypto package, as
+// in ASN.1 ECDSA signatures, and SignerOpts with the hash function, if any.
+func signerSign(alg string, key crypto.Signer, format formatFunc) (token []byte, err error) {
+	var opts crypto.SignerOpts = crypto.Hash(0)
+	var paramLen int // ECDSA only
+	switch pub := key.Public().(type) {
+	case ed25519.PublicKey:
+		if alg != EdDSA {
+			return nil, keyTypeError(alg, key)
+		}
+	case *ecdsa.PublicKey:
+		hash, err := hashLookup(alg, ECDSAAlgs)
+		if err != nil {
+			return nil, keyTypeError(alg, key)
+		}
+		opts = hash
+		paramLen = (pub.Curve.Params().BitSize + 7) / 8
+	case *rsa.PublicKey:
+		hash, err := hashLookup(alg, RSAAlgs)
+		if err != nil {
+			return nil, keyTypeError(alg, key)
+		}
+		opts = hash
+		if alg != "" && alg[0] == 'P' {
+			opts = &rsa.PSSOptions{SaltLength: pSSOptions.SaltLength, Hash: hash}
+		}
+	default:
+		return nil, fmt.Errorf("jwt: %s with unsupported public key type %T", alg, pub)
+	}
+
+	token, err = format(alg, 0)
+	if err != nil {
+		return nil, err
+	}
+	digestSum := token
+	if hash := opts.HashFunc(); hash != 0 {
+		digest := hash.New()
+		digest.Write(token)
+		digestSum = digest.Sum(nil)
+	}
+
+	sig, err := key.Sign(rand.Reader, digestSum, opts)
+	if err != nil {
+		return nil, err
+	}
+	if paramLen != 0 {
+		var pair struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(sig, &pair); err != nil || len(rest) != 0 {
+			return nil, errors.New("jwt: malformed ASN.1 of ECDSA signature from crypto.Signer")
+		}
+
+		// signature contains pair (r, s) as per RFC 7518, subsection 3.4
+		rBytes, sBytes := pair.R.Bytes(), pair.S.Bytes()
+		if len(rBytes) > paramLen || len(sBytes) > paramLen {
+			return nil, errors.New("jwt: ECDSA signature exceeds curve size")
+		}
+		sig = make([]byte, 2*paramLen)
+		copy(sig[paramLen-len(rBytes):paramLen], rBytes)
+		copy(sig[2*paramLen-len(sBytes):], sBytes)
+	}
+
+	tokenWithoutSignature := token
+	token = make([]byte, len(token)+1+encoding.EncodedLen(len(sig)))
+	i := copy(token, tokenWithoutSignature)
+	token[i] = '.'
+	encodeBase64URL(token[i+1:], sig)
+	return token, nil
+}
+
 var (
 	headerES256 = []byte(`{"alg":"ES256"}`)
 	headerES384 = []byte(`{"alg":"ES384"}`)
@@ -176,6 +615,25 @@ var (
 )
 
 func (c *Claims) newToken(alg string, encSigLen int, extraHeaders []json.RawMessage) ([]byte, error) {
+	if err := c.sync(); err != nil {
+		return nil, err
+	}
+	return c.format(alg, encSigLen, extraHeaders)
+}
+
+// Sync defines Raw, including a merge of Registered into Set when not nil.
+func (c *Claims) sync() error {
+	if bytes, err := json.Marshal(c.payload()); err != nil {
+		return err
+	} else {
+		c.Raw = json.RawMessage(bytes)
+	}
+	return nil
+}
+
+// Payload returns the content for Raw, which is Set when not nil, with a merge
+// of Registered.
+func (c *Claims) payload() interface{} {
 	var payload interface{}
 	if c.Set == nil {
 		payload = &c.Registered
@@ -209,14 +667,12 @@ func (c *Claims) newToken(alg string, encSigLen int, extraHeaders []json.RawMess
 			c.Set[id] = c.ID
 		}
 	}
+	return payload
+}
 
-	// define Claims.Raw
-	if bytes, err := json.Marshal(payload); err != nil {
-		return nil, err
-	} else {
-		c.Raw = json.RawMessage(bytes)
-	}
-
+// Format encodes the header and Raw as a token without signature, and it sets
+// RawHeader.
+func (c *Claims) format(alg string, encSigLen int, extraHeaders []json.RawMessage) ([]byte, error) {
 	// try fixed JOSE header
 	if len(extraHeaders) == 0 && c.KeyID == "" {
 		var fixed string
@@ -266,7 +722,7 @@ func (c *Claims) newToken(alg string, encSigLen int, extraHeaders []json.RawMess
 			l := len(fixed) + encoding.EncodedLen(len(c.Raw))
 			token := make([]byte, l, l+1+encSigLen)
 			copy(token, fixed)
-			encoding.Encode(token[len(fixed):], c.Raw)
+			encodeBase64URL(token[len(fixed):], c.Raw)
 			return token, nil
 		}
 	}
@@ -279,6 +735,9 @@ func (c *Claims) newToken(alg string, encSigLen int, extraHeaders []json.RawMess
 		fmt.Fprintf(&header, `{"alg":%q,"kid":%q}`, alg, c.KeyID)
 	}
 	for _, raw := range extraHeaders {
+		if raw == nil {
+			continue // no addition
+		}
 		if len(raw) == 0 || raw[0] != '{' {
 			return nil, errors.New("jwt: JOSE header addition is not a JSON object")
 		}
@@ -287,6 +746,12 @@ func (c *Claims) newToken(alg string, encSigLen int, extraHeaders []json.RawMess
 		if err := json.Compact(&header, []byte(raw)); err != nil {
 			return nil, fmt.Errorf("jwt: malformed JOSE header addition: %w", err)
 		}
+		if header.Len() == offset+2 {
+			// empty object
+			header.Truncate(offset)
+			header.WriteByte('}')
+			continue
+		}
 		header.Bytes()[offset] = ','
 	}
 	c.RawHeader = json.RawMessage(header.Bytes())
@@ -295,8 +760,8 @@ func (c *Claims) newToken(alg string, encSigLen int, extraHeaders []json.RawMess
 	headerLen := encoding.EncodedLen(header.Len())
 	l := headerLen + 1 + encoding.EncodedLen(len(c.Raw))
 	token := make([]byte, l, l+1+encSigLen)
-	encoding.Encode(token, header.Bytes())
+	encodeBase64URL(token, header.Bytes())
 	token[headerLen] = '.'
-	encoding.Encode(token[headerLen+1:], c.Raw)
+	encodeBase64URL(token[headerLen+1:], c.Raw)
 	return token, nil
 }
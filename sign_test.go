@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"math/big"
@@ -116,6 +119,86 @@ func TestECDSASign(t *testing.T) {
 	}
 }
 
+// ECDSA test vectors from RFC 6979, appendix A.2.5.
+func TestECDSASignDeterministic(t *testing.T) {
+	x, _ := new(big.Int).SetString("C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721", 16)
+	key := &ecdsa.PrivateKey{D: x}
+	key.Curve = elliptic.P256()
+	key.X, key.Y = key.Curve.ScalarBaseMult(x.Bytes())
+
+	golden := []struct{ msg, r, s string }{
+		{"sample",
+			"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8"},
+		{"test",
+			"F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083"},
+	}
+	for _, gold := range golden {
+		digest := sha256.Sum256([]byte(gold.msg))
+		// both the standard library and the fallback
+		for _, sign := range []func(*ecdsa.PrivateKey, crypto.Hash, []byte) (*big.Int, *big.Int, error){ecdsaSignDeterministic, ecdsaSignRFC6979} {
+			r, s, err := sign(key, crypto.SHA256, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.ToUpper(r.Text(16)); got != gold.r {
+				t.Errorf("%q got r %s, want %s", gold.msg, got, gold.r)
+			}
+			if got := strings.ToUpper(s.Text(16)); got != strings.TrimLeft(gold.s, "0") {
+				t.Errorf("%q got s %s, want %s", gold.msg, got, gold.s)
+			}
+		}
+	}
+}
+
+func TestECDSASignRFC6979Fallback(t *testing.T) {
+	for _, key := range []*ecdsa.PrivateKey{testKeyEC256, testKeyEC384, testKeyEC521} {
+		for _, hash := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+			digest := hash.New()
+			digest.Write([]byte("sample"))
+			sum := digest.Sum(nil)
+			r1, s1, err := ecdsaSignDeterministic(key, hash, sum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r2, s2, err := ecdsaSignRFC6979(key, hash, sum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r1.Cmp(r2) != 0 || s1.Cmp(s2) != 0 {
+				t.Errorf("%s with %v: fallback got (%x, %x), want (%x, %x)", key.Curve.Params().Name, hash, r2, s2, r1, s1)
+			}
+		}
+	}
+}
+
+func TestDeterministicECDSA(t *testing.T) {
+	defer func() { DeterministicECDSA = false }()
+	DeterministicECDSA = true
+
+	for _, key := range []*ecdsa.PrivateKey{testKeyEC256, testKeyEC384, testKeyEC521} {
+		var c Claims
+		c.Subject = "reproducible"
+		alg := map[int]string{256: ES256, 384: ES384, 521: ES512}[key.Curve.Params().BitSize]
+
+		token1, err := c.ECDSASign(alg, key)
+		if err != nil {
+			t.Fatal("sign error:", err)
+		}
+		token2, err := c.ECDSASign(alg, key)
+		if err != nil {
+			t.Fatal("sign error:", err)
+		}
+		if !bytes.Equal(token1, token2) {
+			t.Errorf("%s got tokens %q and %q, want identical", alg, token1, token2)
+		}
+		if _, err := ECDSACheck(token1, &key.PublicKey); err != nil {
+			t.Errorf("%s check error: %s", alg, err)
+		}
+	}
+}
+
 func TestEdDSASign(t *testing.T) {
 	want := []string{"The Idiots"}
 
@@ -223,8 +306,63 @@ func TestECDSAKeyBroken(t *testing.T) {
 	}
 	key.Params().N = new(big.Int)
 	_, err = new(Claims).ECDSASign(ES512, key)
-	if err == nil || err.Error() != "zero parameter" {
-		t.Errorf("got error %q, want zero parameter", err)
+	// error message varies per Go version
+	if err == nil {
+		t.Error("no error for broken key")
+	}
+}
+
+// Fixed-width encoding for each curve, including the odd size of P-521.
+func TestECDSASignatureSize(t *testing.T) {
+	for alg, curve := range map[string]elliptic.Curve{
+		ES256: elliptic.P256(),
+		ES384: elliptic.P384(),
+		ES512: elliptic.P521(),
+	} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := KeyRegister{ECDSAs: []*ecdsa.PublicKey{&key.PublicKey}}
+		paramLen := (curve.Params().BitSize + 7) / 8
+
+		// leading zeros in r or s happen once in 256 on average
+		for i := 0; i < 300; i++ {
+			token, err := new(Claims).ECDSASign(alg, key)
+			if err != nil {
+				t.Fatalf("%s sign error: %s", alg, err)
+			}
+			sig, err := encoding.DecodeString(string(token[bytes.LastIndexByte(token, '.')+1:]))
+			if err != nil {
+				t.Fatalf("%s malformed signature: %s", alg, err)
+			}
+			if len(sig) != 2*paramLen {
+				t.Fatalf("%s got %d byte signature, want %d", alg, len(sig), 2*paramLen)
+			}
+			if _, err := ECDSACheck(token, &key.PublicKey); err != nil {
+				t.Fatalf("%s check error: %s", alg, err)
+			}
+			if _, err := keys.Check(token); err != nil {
+				t.Fatalf("%s key register check error: %s", alg, err)
+			}
+		}
+	}
+}
+
+func TestECDSACheckSignatureSize(t *testing.T) {
+	token, err := new(Claims).ECDSASign(ES512, testKeyEC521)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	// drop the last byte of the signature
+	dot := bytes.LastIndexByte(token, '.')
+	sig, err := encoding.DecodeString(string(token[dot+1:]))
+	if err != nil {
+		t.Fatal("malformed signature:", err)
+	}
+	short := []byte(string(token[:dot+1]) + encoding.EncodeToString(sig[:len(sig)-1]))
+	if _, err := ECDSACheck(short, &testKeyEC521.PublicKey); err != ErrSigMiss {
+		t.Errorf("got error %v, want %v", err, ErrSigMiss)
 	}
 }
 
@@ -293,3 +431,369 @@ func TestFormatHeader(t *testing.T) {
 		}
 	}
 }
+
+func TestSignHeaderAddition(t *testing.T) {
+	h := Header{
+		Alg:         "none",
+		KeyID:       "ignored",
+		Type:        "at+jwt",
+		ContentType: "JWT",
+		CertSHA256:  "Iv8ksXzYwBBX-t19BimJ1zIiXlPn3KxwLjl2skEzzC4",
+		Set:         map[string]interface{}{"alg": "none", "kid": "ignored", "lan": "XL9"},
+	}
+	addition, err := h.Addition()
+	if err != nil {
+		t.Fatal("addition error:", err)
+	}
+
+	c := Claims{KeyID: "k1"}
+	token, err := c.HMACSign(HS256, []byte("guest"), addition)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	const want = `{"alg":"HS256","kid":"k1","cty":"JWT","lan":"XL9","typ":"at+jwt","x5t#S256":"Iv8ksXzYwBBX-t19BimJ1zIiXlPn3KxwLjl2skEzzC4"}`
+	if string(c.RawHeader) != want {
+		t.Errorf("got header %s, want %s", c.RawHeader, want)
+	}
+
+	claims, err := HMACCheck(token, []byte("guest"))
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	got, err := claims.Header()
+	if err != nil {
+		t.Fatal("header error:", err)
+	}
+	if got.Alg != HS256 || got.KeyID != "k1" || got.Type != h.Type || got.ContentType != h.ContentType || got.CertSHA256 != h.CertSHA256 {
+		t.Errorf("got header %#v", got)
+	}
+}
+
+func TestSignHeaderAdditionEmpty(t *testing.T) {
+	addition, err := new(Header).Addition()
+	if err != nil {
+		t.Fatal("addition error:", err)
+	}
+	if addition != nil {
+		t.Errorf("got addition %q, want nil", addition)
+	}
+	if got, _ := (&Header{Alg: "none", KeyID: "ignored"}).Addition(); got != nil {
+		t.Errorf("got addition %q for only Alg and KeyID, want nil", got)
+	}
+
+	for _, extra := range []json.RawMessage{addition, json.RawMessage("{}"), json.RawMessage("{ }")} {
+		c := Claims{KeyID: "k1"}
+		token, err := c.HMACSign(HS256, []byte("guest"), extra)
+		if err != nil {
+			t.Fatalf("addition %q sign error: %s", extra, err)
+		}
+		const want = `{"alg":"HS256","kid":"k1"}`
+		if string(c.RawHeader) != want {
+			t.Errorf("addition %q got header %s, want %s", extra, c.RawHeader, want)
+		}
+		if _, err := HMACCheck(token, []byte("guest")); err != nil {
+			t.Errorf("addition %q check error: %s", extra, err)
+		}
+	}
+}
+
+func TestFormatUnsecured(t *testing.T) {
+	c := Claims{KeyID: "k1"}
+	c.Subject = "Lana"
+	token, err := c.FormatUnsecured()
+	if err != nil {
+		t.Fatal("format error:", err)
+	}
+	const want = "eyJhbGciOiJub25lIiwia2lkIjoiazEifQ.eyJzdWIiOiJMYW5hIn0."
+	if string(token) != want {
+		t.Errorf("got token %q, want %q", token, want)
+	}
+
+	got, err := ParseWithoutCheck(token)
+	if err != nil {
+		t.Fatal("parse error:", err)
+	}
+	if got.Subject != "Lana" {
+		t.Errorf("got subject %q, want Lana", got.Subject)
+	}
+
+	if _, err := HMACCheck(token, []byte("guest")); err != AlgError("none") {
+		t.Errorf("HMAC check got error %v, want %v", err, AlgError("none"))
+	}
+	var keys KeyRegister
+	keys.Secrets = [][]byte{[]byte("guest")}
+	if _, err := keys.Check(token); err != AlgError("none") {
+		t.Errorf("key register check got error %v, want %v", err, AlgError("none"))
+	}
+}
+
+// TestAlg is HMAC with SHA-256 for RegisterAlg.
+type testAlg struct{}
+
+func (testAlg) Name() string      { return "XHS256" }
+func (testAlg) Hash() crypto.Hash { return crypto.SHA256 }
+
+func (testAlg) Sign(key crypto.PrivateKey, digest []byte) ([]byte, error) {
+	secret, ok := key.([]byte)
+	if !ok {
+		return nil, errors.New("not a secret")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(digest)
+	return mac.Sum(nil), nil
+}
+
+func (a testAlg) Verify(key crypto.PublicKey, digest, sig []byte) error {
+	want, err := a.Sign(key, digest)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(sig, want) {
+		return ErrSigMiss
+	}
+	return nil
+}
+
+// DecodeJWK accepts key type "test-oct" with the secret in field "k".
+func (testAlg) DecodeJWK(data json.RawMessage) (crypto.PublicKey, error) {
+	var j struct{ Kty, K string }
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	if j.Kty != "test-oct" {
+		return nil, nil
+	}
+	return encoding.DecodeString(j.K)
+}
+
+func init() {
+	RegisterAlg(testAlg{})
+}
+
+func TestSignRegisteredAlg(t *testing.T) {
+	c := Claims{KeyID: "k2"}
+	c.Subject = "Krieger"
+	token, err := c.Sign("XHS256", []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+
+	keys := KeyRegister{
+		Others:   []crypto.PublicKey{[]byte("wrong"), []byte("guest")},
+		OtherIDs: []string{"k1", "k2"},
+	}
+	got, err := keys.Check(token)
+	if err != nil {
+		t.Fatalf("%q check error: %s", token, err)
+	}
+	if got.Subject != "Krieger" {
+		t.Errorf("got subject %q, want Krieger", got.Subject)
+	}
+
+	keys.Others = keys.Others[:1]
+	if _, err := keys.Check(token); err != ErrSigMiss {
+		t.Errorf("got error %v, want %v", err, ErrSigMiss)
+	}
+
+	if _, err := c.Sign("XHS384", []byte("guest")); err != AlgError("XHS384") {
+		t.Errorf("got error %v, want %v", err, AlgError("XHS384"))
+	}
+}
+
+func TestRegisterAlgDupe(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for duplicate registration")
+		}
+	}()
+	RegisterAlg(testAlg{})
+}
+
+// NamedAlg is testAlg with another name.
+type namedAlg struct {
+	testAlg
+	name string
+}
+
+func (a namedAlg) Name() string { return a.name }
+
+func TestRegisterAlgReserved(t *testing.T) {
+	for _, name := range []string{"", "none"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("no panic for registration of name %q", name)
+				}
+			}()
+			RegisterAlg(namedAlg{name: name})
+		}()
+	}
+	if _, ok := registeredAlgs["none"]; ok {
+		t.Error("none got registered")
+	}
+}
+
+func TestSignBytes(t *testing.T) {
+	keys := &KeyRegister{
+		ECDSAs:  []*ecdsa.PublicKey{&testKeyEC256.PublicKey},
+		EdDSAs:  []ed25519.PublicKey{testKeyEd25519Public},
+		RSAs:    []*rsa.PublicKey{&testKeyRSA2048.PublicKey},
+		Secrets: [][]byte{[]byte("guest")},
+		Others:  []crypto.PublicKey{[]byte("guest")},
+	}
+	golden := []struct {
+		alg string
+		key crypto.PrivateKey
+	}{
+		{ES256, testKeyEC256},
+		{EdDSA, testKeyEd25519Private},
+		{HS384, []byte("guest")},
+		{PS256, testKeyRSA2048},
+		{RS512, testKeyRSA2048},
+		{"XHS256", []byte("guest")},
+	}
+	const payload = "\x00 plain text"
+	for _, gold := range golden {
+		token, err := SignBytes([]byte(payload), gold.alg, gold.key, json.RawMessage(`{"cty":"text/plain"}`))
+		if err != nil {
+			t.Errorf("%s sign error: %s", gold.alg, err)
+			continue
+		}
+		got, err := keys.VerifyBytes(token)
+		if err != nil {
+			t.Errorf("%s verify error: %s", gold.alg, err)
+			continue
+		}
+		if string(got) != payload {
+			t.Errorf("%s got payload %q, want %q", gold.alg, got, payload)
+		}
+	}
+}
+
+func TestSignBytesErrors(t *testing.T) {
+	_, err := SignBytes(nil, ES256, testKeyRSA2048)
+	if want := "jwt: ES256 with unsupported key type *rsa.PrivateKey"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+	if _, err := SignBytes(nil, "doesntexist", testKeyEC256); err != AlgError("doesntexist") {
+		t.Errorf("got error %v, want %v", err, AlgError("doesntexist"))
+	}
+	if _, err := SignBytes(nil, HS256, []byte{}); err != errNoSecret {
+		t.Errorf("got error %v, want %v", err, errNoSecret)
+	}
+}
+
+// OpaqueSigner hides the concrete key type.
+type opaqueSigner struct{ crypto.Signer }
+
+func TestSignCryptoSigner(t *testing.T) {
+	keys := &KeyRegister{
+		ECDSAs: []*ecdsa.PublicKey{&testKeyEC384.PublicKey},
+		EdDSAs: []ed25519.PublicKey{testKeyEd25519Public},
+		RSAs:   []*rsa.PublicKey{&testKeyRSA2048.PublicKey},
+	}
+	golden := []struct {
+		alg string
+		key crypto.Signer
+	}{
+		{ES384, testKeyEC384},
+		{EdDSA, testKeyEd25519Private},
+		{PS384, testKeyRSA2048},
+		{RS256, testKeyRSA2048},
+	}
+	for _, gold := range golden {
+		var c Claims
+		c.Subject = "test"
+		token, err := c.Sign(gold.alg, opaqueSigner{gold.key})
+		if err != nil {
+			t.Errorf("%s sign error: %s", gold.alg, err)
+			continue
+		}
+		got, err := keys.Check(token)
+		if err != nil {
+			t.Errorf("%s check error: %s", gold.alg, err)
+			continue
+		}
+		if got.Subject != "test" {
+			t.Errorf("%s got subject %q, want test", gold.alg, got.Subject)
+		}
+	}
+
+	var c Claims
+	_, err := c.Sign(ES256, opaqueSigner{testKeyRSA2048})
+	if want := "jwt: ES256 with unsupported key type jwt.opaqueSigner"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+	_, err = c.Sign(HS256, opaqueSigner{testKeyEC256})
+	if want := "jwt: HS256 with unsupported key type jwt.opaqueSigner"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestSignerSet(t *testing.T) {
+	set := SignerSet{
+		"billing": {Alg: ES256, Key: testKeyEC256, KeyID: "ec1", Lifetime: 5 * time.Minute, Issuer: "auth", Audiences: []string{"billing"}},
+		"broken":  {Alg: HS256, Key: []byte("guest")},
+	}
+	keys := &KeyRegister{ECDSAs: []*ecdsa.PublicKey{&testKeyEC256.PublicKey}, ECDSAIDs: []string{"ec1"}}
+
+	var c Claims
+	c.Subject = "user"
+	c.Issuer = "impostor"
+	c.Expires = NewNumericTime(time.Now().Add(24 * time.Hour))
+	token, err := set.Sign("billing", &c)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	got, err := keys.Check(token)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if got.KeyID != "ec1" || got.Issuer != "auth" || !got.AcceptAudience("billing") || got.Subject != "user" {
+		t.Errorf("got kid %q, iss %q, aud %q, sub %q", got.KeyID, got.Issuer, got.Audiences, got.Subject)
+	}
+	if d := got.Expires.Time().Sub(got.Issued.Time()); d != 5*time.Minute {
+		t.Errorf("got lifetime %s, want 5m", d)
+	}
+
+	if _, err := set.Sign("doesntexist", &c); err != ProfileError("doesntexist") {
+		t.Errorf("got error %v, want %v", err, ProfileError("doesntexist"))
+	}
+	if _, err := set.Sign("broken", &c); err == nil {
+		t.Error("no error for profile without lifetime")
+	}
+}
+
+func TestRenew(t *testing.T) {
+	var renewals int
+	renew := func() ([]byte, error) {
+		renewals++
+		var c Claims
+		c.ExpiresIn(time.Hour)
+		return c.HMACSign(HS256, []byte("guest"))
+	}
+
+	token, err := Renew(nil, time.Minute, renew)
+	if err != nil {
+		t.Fatal("initial renew error:", err)
+	}
+	again, err := Renew(token, time.Minute, renew)
+	if err != nil {
+		t.Fatal("renew error:", err)
+	}
+	if renewals != 1 || string(again) != string(token) {
+		t.Errorf("got %d renewals, want 1 with token reuse", renewals)
+	}
+	if _, err := Renew(token, 2*time.Hour, renew); err != nil {
+		t.Fatal("renew error:", err)
+	}
+	if renewals != 2 {
+		t.Errorf("got %d renewals, want 2 below threshold", renewals)
+	}
+	if _, err := Renew([]byte("malformed"), time.Minute, renew); err != nil {
+		t.Fatal("renew error:", err)
+	}
+	if renewals != 3 {
+		t.Errorf("got %d renewals, want 3 for malformed token", renewals)
+	}
+}
@@ -0,0 +1,222 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"math/big"
+	"sort"
+)
+
+var errStreamAlg = errors.New("jwt: algorithm can't sign a stream, as it needs the signing input as a whole")
+
+// SignTo writes a new token to w, like Sign does, without the serialization of
+// the claims in memory. The payload gets encoded one claim at a time, straight
+// into the digest and into w, and arrays in Set go element by element, e.g.,
+// with authorization_details from RFC 9396. The output is identical to Sign
+// otherwise. Raw is not defined on return, as it would defeat the purpose.
+//
+// Key types are conform Sign, with the exception of EdDSA and crypto.Signer,
+// both of which need the signing input as a whole. Registered algorithms apply
+// only when they have a Hash.
+func (c *Claims) SignTo(w io.Writer, alg string, key crypto.PrivateKey, extraHeaders ...json.RawMessage) error {
+	digest, finish, err := streamSigner(alg, key)
+	if err != nil {
+		return err
+	}
+
+	// header without payload gives "header-base64."
+	h := Claims{KeyID: c.KeyID}
+	start, err := h.format(alg, 0, extraHeaders)
+	if err != nil {
+		return err
+	}
+	c.RawHeader = h.RawHeader
+	c.Raw = nil
+
+	tee := io.MultiWriter(w, digest)
+	if _, err := tee.Write(start); err != nil {
+		return err
+	}
+	enc := base64.NewEncoder(encoding, tee)
+	if err := writeJSON(enc, c.payload()); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	sig, err := finish(digest.Sum(nil))
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 1+encoding.EncodedLen(len(sig)))
+	buf[0] = '.'
+	encodeBase64URL(buf[1:], sig)
+	_, err = w.Write(buf)
+	return err
+}
+
+// StreamSigner returns the digest for the signing input, with a function which
+// signs the digest sum.
+func streamSigner(alg string, key crypto.PrivateKey) (digest hash.Hash, finish func(sum []byte) ([]byte, error), err error) {
+	if alg == EdDSA {
+		return nil, nil, errStreamAlg
+	}
+	if _, ok := ECDSAAlgs[alg]; ok {
+		k, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, keyTypeError(alg, key)
+		}
+		hash, err := hashLookup(alg, ECDSAAlgs)
+		if err != nil {
+			return nil, nil, err
+		}
+		return hash.New(), func(sum []byte) ([]byte, error) {
+			var r, s *big.Int
+			var err error
+			if DeterministicECDSA {
+				r, s, err = ecdsaSignDeterministic(k, hash, sum)
+			} else {
+				r, s, err = ecdsa.Sign(rand.Reader, k, sum)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			// signature contains pair (r, s) as per RFC 7518, subsection 3.4
+			paramLen := (k.Curve.Params().BitSize + 7) / 8
+			rBytes, sBytes := r.Bytes(), s.Bytes()
+			if len(rBytes) > paramLen || len(sBytes) > paramLen {
+				return nil, errors.New("jwt: ECDSA signature exceeds curve size")
+			}
+			sig := make([]byte, 2*paramLen)
+			copy(sig[paramLen-len(rBytes):paramLen], rBytes)
+			copy(sig[2*paramLen-len(sBytes):], sBytes)
+			return sig, nil
+		}, nil
+	}
+	if _, ok := HMACAlgs[alg]; ok {
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, nil, keyTypeError(alg, key)
+		}
+		if len(secret) == 0 {
+			return nil, nil, errNoSecret
+		}
+		hash, err := hashLookup(alg, HMACAlgs)
+		if err != nil {
+			return nil, nil, err
+		}
+		return hmac.New(hash.New, secret), func(sum []byte) ([]byte, error) {
+			return sum, nil
+		}, nil
+	}
+	if _, ok := RSAAlgs[alg]; ok {
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, keyTypeError(alg, key)
+		}
+		hash, err := hashLookup(alg, RSAAlgs)
+		if err != nil {
+			return nil, nil, err
+		}
+		return hash.New(), func(sum []byte) ([]byte, error) {
+			if alg[0] == 'P' {
+				return rsa.SignPSS(rand.Reader, k, hash, sum, &pSSOptions)
+			}
+			return rsa.SignPKCS1v15(rand.Reader, k, hash, sum)
+		}, nil
+	}
+
+	a, err := algLookup(alg)
+	if err != nil {
+		return nil, nil, err
+	}
+	hash := a.Hash()
+	if hash == 0 {
+		return nil, nil, errStreamAlg
+	}
+	if !hash.Available() {
+		return nil, nil, errHashLink
+	}
+	return hash.New(), func(sum []byte) ([]byte, error) {
+		return a.Sign(key, sum)
+	}, nil
+}
+
+// WriteJSON encodes v conform json.Marshal, with objects and arrays from Set
+// written one member at a time.
+func writeJSON(w io.Writer, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			_, err := io.WriteString(w, "null")
+			return err
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		delim := []byte{'{'}
+		for _, name := range names {
+			key, err := json.Marshal(name)
+			if err != nil {
+				return err
+			}
+			key = append(key, ':')
+			if _, err := w.Write(append(delim, key...)); err != nil {
+				return err
+			}
+			if err := writeJSON(w, v[name]); err != nil {
+				return err
+			}
+			delim = []byte{','}
+		}
+		if len(names) == 0 {
+			_, err := io.WriteString(w, "{}")
+			return err
+		}
+		_, err := io.WriteString(w, "}")
+		return err
+
+	case []interface{}:
+		if v == nil {
+			_, err := io.WriteString(w, "null")
+			return err
+		}
+		delim := "["
+		for _, e := range v {
+			if _, err := io.WriteString(w, delim); err != nil {
+				return err
+			}
+			if err := writeJSON(w, e); err != nil {
+				return err
+			}
+			delim = ","
+		}
+		if len(v) == 0 {
+			_, err := io.WriteString(w, "[]")
+			return err
+		}
+		_, err := io.WriteString(w, "]")
+		return err
+
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+}
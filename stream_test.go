@@ -0,0 +1,101 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSignTo(t *testing.T) {
+	defer func() { DeterministicECDSA = false }()
+	DeterministicECDSA = true
+
+	details := make([]interface{}, 1000)
+	for i := range details {
+		details[i] = map[string]interface{}{
+			"type":      "payment_initiation",
+			"actions":   []interface{}{"initiate", "status"},
+			"locations": []interface{}{fmt.Sprintf("https://bank%d.example.com/<&>", i)},
+			"amount":    float64(i) / 4,
+			"extra":     nil,
+		}
+	}
+
+	with := new(Claims)
+	with.Subject = "streamer"
+	with.Audiences = []string{"a", "b"}
+	with.Expires = NewNumericTime(time.Unix(1e9, 0))
+	with.KeyID = "k1"
+	with.Set = map[string]interface{}{
+		"authorization_details": details,
+		"empty":                 map[string]interface{}{},
+		"none":                  []interface{}{},
+		"nil":                   map[string]interface{}(nil),
+	}
+	without := new(Claims)
+	without.ID = "registered only"
+
+	golden := []struct {
+		alg string
+		key crypto.PrivateKey
+	}{
+		{HS256, []byte("guest")},
+		{HS512, []byte("guest")},
+		{ES256, testKeyEC256},
+		{ES512, testKeyEC521},
+		{RS256, testKeyRSA2048},
+	}
+	for _, gold := range golden {
+		for _, c := range []*Claims{with, without} {
+			want, err := c.Sign(gold.alg, gold.key, json.RawMessage(`{"typ":"JWT"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := c.SignTo(&buf, gold.alg, gold.key, json.RawMessage(`{"typ":"JWT"}`)); err != nil {
+				t.Errorf("%s: sign error: %s", gold.alg, err)
+				continue
+			}
+			if got := buf.String(); got != string(want) {
+				t.Errorf("%s: got token %.80q…, want %.80q…", gold.alg, got, want)
+			}
+		}
+	}
+
+	// PSS is randomised
+	var buf bytes.Buffer
+	if err := with.SignTo(&buf, PS384, testKeyRSA2048); err != nil {
+		t.Fatal("sign error:", err)
+	}
+	keys := &KeyRegister{RSAs: []*rsa.PublicKey{&testKeyRSA2048.PublicKey}, ECDSAs: []*ecdsa.PublicKey{&testKeyEC256.PublicKey}}
+	if c, err := keys.Check(buf.Bytes()); err != nil {
+		t.Error("check error:", err)
+	} else if got := len(c.Set["authorization_details"].([]interface{})); got != len(details) {
+		t.Errorf("got %d authorization details, want %d", got, len(details))
+	}
+}
+
+func TestSignToErrors(t *testing.T) {
+	var buf bytes.Buffer
+	c := new(Claims)
+	if err := c.SignTo(&buf, EdDSA, testKeyEd25519Private); err != errStreamAlg {
+		t.Errorf("EdDSA got error %v, want %v", err, errStreamAlg)
+	}
+	if err := c.SignTo(&buf, HS256, []byte{}); err != errNoSecret {
+		t.Errorf("empty secret got error %v, want %v", err, errNoSecret)
+	}
+	if err := c.SignTo(&buf, ES256, testKeyRSA2048); err == nil {
+		t.Error("no error for key type mismatch")
+	}
+	if err := c.SignTo(&buf, "none", nil); err == nil {
+		t.Error("no error for unknown algorithm")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got %q written on error", buf.String())
+	}
+}
@@ -0,0 +1,150 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	errTicketAudience = errors.New("jwt: ticket audience mismatch")
+	errTicketID       = errors.New("jwt: ticket without ID")
+)
+
+// FromWebSocketProtocol returns an Extractor for a token in the
+// Sec-WebSocket-Protocol header, as the subprotocol entry with prefix, e.g.,
+// "access_token." for "access_token.eyJhbGciOi…". Browsers can't set any other
+// header on a WebSocket upgrade. Note that the handshake response must select
+// a subprotocol other than the token (entry), if any.
+func FromWebSocketProtocol(prefix string) Extractor {
+	return func(r *http.Request) ([]byte, error) {
+		for _, h := range r.Header["Sec-Websocket-Protocol"] {
+			for _, entry := range strings.Split(h, ",") {
+				entry = strings.TrimSpace(entry)
+				if strings.HasPrefix(entry, prefix) && len(entry) > len(prefix) {
+					return []byte(entry[len(prefix):]), nil
+				}
+			}
+		}
+		return nil, ErrNoToken
+	}
+}
+
+// Tickets mints short-lived tokens for a single audience, for protocols where
+// the Authorization header is unavailable, such as WebSocket and Server-Sent
+// Events (EventSource). A client gets a ticket with its regular credentials,
+// and then it passes the ticket on the upgrade, e.g., with FromQuery or with
+// FromWebSocketProtocol, or in the first message frame once connected. Any
+// modifications to the exported fields should be made before first use.
+type Tickets struct {
+	// Audience is the only "aud" of each ticket, e.g., the WebSocket URL.
+	Audience string
+
+	// Alg and Key apply as with Claims.Sign.
+	Alg string
+	Key crypto.PrivateKey
+	// Keys verify the tickets, i.e., the public key of Key, or the
+	// secret in case of HMAC.
+	Keys *KeyRegister
+
+	// Lifetime is the validity of each ticket. Zero defaults to 30
+	// seconds.
+	Lifetime time.Duration
+
+	// Revocation makes tickets single-use, as Check revokes each ID on
+	// success. See RevokeOnce for concurrent use. Nil permits reuse within
+	// the Lifetime.
+	Revocation Revocation
+
+	// Clock provides the time for issuance and validation. Nil defaults
+	// to time.Now.
+	Clock func() time.Time
+}
+
+func (t *Tickets) lifetime() time.Duration {
+	if t.Lifetime > 0 {
+		return t.Lifetime
+	}
+	return 30 * time.Second
+}
+
+func (t *Tickets) now() time.Time {
+	if t.Clock != nil {
+		return t.Clock()
+	}
+	return time.Now()
+}
+
+// Issue returns a signed ticket with the claims as a template, e.g., with the
+// subject from the regular credentials. The Registered time fields, the ID and
+// the audience are overwritten.
+func (t *Tickets) Issue(template *Claims) ([]byte, error) {
+	c := new(Claims)
+	if template != nil {
+		c = template.Clone()
+	}
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	c.ID = encoding.EncodeToString(id[:])
+	c.Audiences = []string{t.Audience}
+	if c.Set != nil {
+		delete(c.Set, audience)
+	}
+
+	now := t.now().Truncate(time.Second)
+	c.Issued = NewNumericTime(now)
+	c.NotBefore = NewNumericTime(now)
+	c.Expires = NewNumericTime(now.Add(t.lifetime()))
+	return c.Sign(t.Alg, t.Key)
+}
+
+// Check returns the claims of a valid ticket. Tokens without expiry are
+// rejected, and the audience must match exactly, i.e., tokens with additional
+// audiences are rejected too. Used tickets get
+// ErrRevoked when Revocation is set.
+func (t *Tickets) Check(token []byte) (*Claims, error) {
+	c, err := t.Keys.Check(token)
+	if err != nil {
+		return nil, err
+	}
+	if c.Expires == nil || !c.Valid(t.now()) {
+		return nil, errTimeConstraints
+	}
+	if len(c.Audiences) != 1 || c.Audiences[0] != t.Audience {
+		return nil, errTicketAudience
+	}
+
+	if t.Revocation != nil {
+		if c.ID == "" {
+			return nil, errTicketID
+		}
+		if err := useOnce(t.Revocation, c.ID, c.Expires.Time()); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Handler returns middleware which passes requests with a valid ticket to
+// target, with the claims in the request context under key. Requests without a
+// valid ticket get a 401 (Unauthorized) response before any upgrade happens.
+func (t *Tickets) Handler(target http.Handler, extract Extractor, key interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var c *Claims
+		token, err := extract(r)
+		if err == nil {
+			c, err = t.Check(token)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		target.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key, c)))
+	})
+}
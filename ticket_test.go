@@ -0,0 +1,145 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFromWebSocketProtocol(t *testing.T) {
+	extract := FromWebSocketProtocol("access_token.")
+
+	r := httptest.NewRequest("GET", "/ws", nil)
+	if _, err := extract(r); err != ErrNoToken {
+		t.Errorf("got error %v without header, want %v", err, ErrNoToken)
+	}
+
+	r.Header.Add("Sec-WebSocket-Protocol", "chat.v1")
+	r.Header.Add("Sec-WebSocket-Protocol", "chat.v2, access_token.eyJ.e30.sig")
+	token, err := extract(r)
+	if err != nil {
+		t.Fatal("extract error:", err)
+	}
+	if string(token) != "eyJ.e30.sig" {
+		t.Errorf("got token %q, want eyJ.e30.sig", token)
+	}
+
+	r.Header.Set("Sec-WebSocket-Protocol", "access_token.")
+	if _, err := extract(r); err != ErrNoToken {
+		t.Errorf("got error %v for empty token, want %v", err, ErrNoToken)
+	}
+}
+
+func TestTickets(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	tickets := &Tickets{
+		Audience:   "wss://example.com/events",
+		Alg:        HS256,
+		Key:        []byte("guest"),
+		Keys:       &KeyRegister{Secrets: [][]byte{[]byte("guest")}},
+		Revocation: new(RevocationList),
+		Clock:      func() time.Time { return now },
+	}
+
+	var template Claims
+	template.Subject = "alice"
+	template.Audiences = []string{"https://api.example.com"}
+	token, err := tickets.Issue(&template)
+	if err != nil {
+		t.Fatal("issue error:", err)
+	}
+	if len(template.Audiences) != 1 || template.Audiences[0] != "https://api.example.com" {
+		t.Errorf("template audiences modified to %q", template.Audiences)
+	}
+
+	var got *Claims
+	h := tickets.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Context().Value("ticket").(*Claims)
+	}), FromQuery("ticket"), "ticket")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/events?ticket="+string(token), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if got.Subject != "alice" || !got.Expires.Time().Equal(now.Add(30*time.Second)) {
+		t.Errorf("got subject %q with expiry %s, want alice with %s", got.Subject, got.Expires, now.Add(30*time.Second))
+	}
+
+	// single use
+	if _, err := tickets.Check(token); err != ErrRevoked {
+		t.Errorf("got error %v on reuse, want %v", err, ErrRevoked)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/events?ticket="+string(token), nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d on reuse, want 401", w.Code)
+	}
+
+	token, err = tickets.Issue(nil)
+	if err != nil {
+		t.Fatal("issue error:", err)
+	}
+	now = now.Add(31 * time.Second)
+	if _, err := tickets.Check(token); err != errTimeConstraints {
+		t.Errorf("got error %v after lifetime, want %v", err, errTimeConstraints)
+	}
+
+	// regular tokens don't apply
+	var c Claims
+	c.Audiences = []string{tickets.Audience, "other"}
+	c.Expires = NewNumericTime(now.Add(time.Minute))
+	token, err = c.HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := tickets.Check(token); err != errTicketAudience {
+		t.Errorf("got error %v for multiple audiences, want %v", err, errTicketAudience)
+	}
+	c.Audiences = []string{tickets.Audience}
+	c.Expires = nil
+	token, err = c.HMACSign(HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := tickets.Check(token); err != errTimeConstraints {
+		t.Errorf("got error %v without expiry, want %v", err, errTimeConstraints)
+	}
+}
+
+func TestTicketsConcurrentUse(t *testing.T) {
+	tickets := &Tickets{
+		Audience:   "wss://example.com/events",
+		Alg:        HS256,
+		Key:        []byte("guest"),
+		Keys:       &KeyRegister{Secrets: [][]byte{[]byte("guest")}},
+		Revocation: new(RevocationList),
+	}
+	token, err := tickets.Issue(nil)
+	if err != nil {
+		t.Fatal("issue error:", err)
+	}
+
+	errs := make(chan error)
+	for i := 0; i < 16; i++ {
+		go func() {
+			_, err := tickets.Check(token)
+			errs <- err
+		}()
+	}
+	var passes int
+	for i := 0; i < 16; i++ {
+		switch err := <-errs; err {
+		case nil:
+			passes++
+		case ErrRevoked:
+			break
+		default:
+			t.Error("check error:", err)
+		}
+	}
+	if passes != 1 {
+		t.Errorf("got %d passes on concurrent use, want 1", passes)
+	}
+}
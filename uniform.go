@@ -0,0 +1,56 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+)
+
+// The dummy keys of UniformTiming verify no signature in practice. They only
+// exist to make the work of a miss without candidates resemble a miss on one.
+
+var dummyEdDSAKey = func() ed25519.PublicKey {
+	seed := sha256.Sum256([]byte("jwt: dummy EdDSA key"))
+	return ed25519.NewKeyFromSeed(seed[:]).Public().(ed25519.PublicKey)
+}()
+
+// DummyECDSAKey returns the base point of the curve in use, conform the size of
+// the signature, as a public key.
+func dummyECDSAKey(sig []byte) *ecdsa.PublicKey {
+	curve := elliptic.P256()
+	switch len(sig) {
+	case 2 * 48:
+		curve = elliptic.P384()
+	case 2 * 66:
+		curve = elliptic.P521()
+	}
+	params := curve.Params()
+	return &ecdsa.PublicKey{Curve: curve, X: params.Gx, Y: params.Gy}
+}
+
+// DummyRSAKey returns a public key with a pseudo-random modulus of the same
+// size as the signature, within the range of 1024 up to 4096 bits.
+func dummyRSAKey(sig []byte) *rsa.PublicKey {
+	size := len(sig)
+	if size < 128 {
+		size = 128
+	} else if size > 512 {
+		size = 512
+	}
+
+	modulus := make([]byte, 0, size+sha256.Size)
+	var counter [4]byte
+	for i := uint32(0); len(modulus) < size; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		sum := sha256.Sum256(append([]byte("jwt: dummy RSA key "), counter[:]...))
+		modulus = append(modulus, sum[:]...)
+	}
+	modulus = modulus[:size]
+	modulus[0] |= 0x80      // full size
+	modulus[size-1] |= 0x01 // odd
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: 65537}
+}
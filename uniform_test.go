@@ -0,0 +1,49 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestUniformTiming(t *testing.T) {
+	tests := []struct {
+		alg string
+		key crypto.PrivateKey
+	}{
+		{EdDSA, testKeyEd25519Private},
+		{HS256, []byte("guest")},
+		{RS256, testKeyRSA1024},
+		{PS512, testKeyRSA4096},
+		{ES256, testKeyEC256},
+		{ES384, testKeyEC384},
+		{ES512, testKeyEC521},
+	}
+	keys := &KeyRegister{UniformTiming: true}
+	for _, test := range tests {
+		token, err := new(Claims).Sign(test.alg, test.key)
+		if err != nil {
+			t.Fatal("sign error:", err)
+		}
+		if _, err := keys.Check(token); err != ErrSigMiss {
+			t.Errorf("%s got error %v, want %v", test.alg, err, ErrSigMiss)
+		}
+	}
+}
+
+func TestDummyRSAKey(t *testing.T) {
+	for _, size := range []int{128, 256, 384, 512} {
+		sig := make([]byte, size)
+		sig[size-1] = 1
+		key := dummyRSAKey(sig)
+		if got, want := key.N.BitLen(), 8*size; got != want {
+			t.Errorf("got %d-bit modulus for %d-byte signature, want %d", got, size, want)
+		}
+		// must fail on the signature, not on the key
+		err := rsa.VerifyPKCS1v15(key, crypto.SHA256, make([]byte, sha256.Size), sig)
+		if err != rsa.ErrVerification {
+			t.Errorf("%d-byte signature got error %v, want %v", size, err, rsa.ErrVerification)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Package vault provides signing and verification with the Transit secrets
+// engine from HashiCorp Vault, such that private keys never enter the process
+// memory. A Key implements crypto.Signer for use with jwt.Claims.Sign and with
+// jwt.SignBytes.
+//
+// Transit key types map to JOSE algorithms as follows: ecdsa-p256 for ES256,
+// ecdsa-p384 for ES384, ecdsa-p521 for ES512, ed25519 for EdDSA, and the RSA
+// types for RS256 (by default) or any of the other RSAAlgs. See the Vault
+// documentation at https://developer.hashicorp.com/vault/api-docs/secret/transit
+// for the policies needed on the sign, verify and keys paths.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// Transit is a Vault client for the Transit secrets engine.
+type Transit struct {
+	// Addr is the Vault server URL, e.g., "https://vault.example.com:8200".
+	Addr string
+
+	// Token is the Vault token for authentication.
+	Token string
+
+	// Namespace is an optional Vault Enterprise namespace.
+	Namespace string
+
+	// Mount is the path of the secrets engine. The zero value defaults
+	// to "transit".
+	Mount string
+
+	// Client performs the requests. Nil defaults to http.DefaultClient.
+	// Set a timeout on the client, as crypto.Signer has no context.
+	Client *http.Client
+}
+
+// Key is a named Transit key in a specific version. Signatures apply with the
+// version as loaded. Multiple goroutines may invoke methods on a Key
+// simultaneously.
+type Key struct {
+	// Alg is the JOSE algorithm. Key loading sets the default for the
+	// key type. For RSA keys, any of jwt.RSAAlgs may be selected.
+	Alg string
+
+	Name    string // Transit key name
+	Version int    // Transit key version
+
+	transit *Transit
+	public  crypto.PublicKey
+}
+
+// Key loads the latest version of a Transit key.
+func (t *Transit) Key(ctx context.Context, name string) (*Key, error) {
+	var data struct {
+		Type          string `json:"type"`
+		LatestVersion int    `json:"latest_version"`
+		Keys          map[string]struct {
+			PublicKey string `json:"public_key"`
+		} `json:"keys"`
+	}
+	if err := t.do(ctx, http.MethodGet, "keys/"+url.PathEscape(name), nil, &data); err != nil {
+		return nil, err
+	}
+
+	k := &Key{Name: name, Version: data.LatestVersion, transit: t}
+	switch data.Type {
+	case "ecdsa-p256":
+		k.Alg = jwt.ES256
+	case "ecdsa-p384":
+		k.Alg = jwt.ES384
+	case "ecdsa-p521":
+		k.Alg = jwt.ES512
+	case "ed25519":
+		k.Alg = jwt.EdDSA
+	case "rsa-2048", "rsa-3072", "rsa-4096":
+		k.Alg = jwt.RS256
+	default:
+		return nil, fmt.Errorf("vault: Transit key %q of type %q has no JOSE algorithm", name, data.Type)
+	}
+
+	text := data.Keys[strconv.Itoa(data.LatestVersion)].PublicKey
+	if k.Alg == jwt.EdDSA {
+		raw, err := base64.StdEncoding.DecodeString(text)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("vault: Transit key %q has malformed Ed25519 public key", name)
+		}
+		k.public = ed25519.PublicKey(raw)
+		return k, nil
+	}
+	block, _ := pem.Decode([]byte(text))
+	if block == nil {
+		return nil, fmt.Errorf("vault: Transit key %q has no PEM public key", name)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("vault: Transit key %q public key: %w", name, err)
+	}
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		k.public = pub
+	default:
+		return nil, fmt.Errorf("vault: Transit key %q has unsupported public key type %T", name, pub)
+	}
+	return k, nil
+}
+
+// Public honors the crypto.Signer interface.
+func (k *Key) Public() crypto.PublicKey { return k.public }
+
+// Sign honors the crypto.Signer interface. The random source is not used. ECDSA
+// signatures are in ASN.1, conform the crypto package.
+func (k *Key) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+// SignContext is like Sign, with a context for the HTTP request.
+func (k *Key) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	req, path, err := k.request(digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Signature string `json:"signature"`
+	}
+	if err := k.transit.do(ctx, http.MethodPost, "sign/"+path, req, &data); err != nil {
+		return nil, err
+	}
+
+	prefix := "vault:v" + strconv.Itoa(k.Version) + ":"
+	if !strings.HasPrefix(data.Signature, prefix) {
+		return nil, fmt.Errorf("vault: signature %.16q… not in key version %d", data.Signature, k.Version)
+	}
+	sig, err := base64.StdEncoding.DecodeString(data.Signature[len(prefix):])
+	if err != nil {
+		return nil, fmt.Errorf("vault: malformed signature: %w", err)
+	}
+	return sig, nil
+}
+
+// Check parses a JWT if, and only if, the signature checks out with the Vault
+// verify endpoint. Tokens with another algorithm than Alg get a jwt.AlgError.
+// Use jwt.Claims.Valid to complete the verification.
+func (k *Key) Check(ctx context.Context, token []byte) (*jwt.Claims, error) {
+	claims, err := jwt.ParseWithoutCheck(token)
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(claims.RawHeader, &header); err != nil {
+		return nil, fmt.Errorf("jwt: malformed JOSE header: %w", err)
+	}
+	if header.Alg != k.Alg {
+		return nil, jwt.AlgError(header.Alg)
+	}
+
+	lastDot := bytes.LastIndexByte(token, '.')
+	input := token[:lastDot]
+	req, path, err := k.request(input, crypto.Hash(0))
+	if err != nil {
+		return nil, err
+	}
+	req["prehashed"] = false
+	sig := string(token[lastDot+1:])
+	if _, ok := k.public.(*ecdsa.PublicKey); ok {
+		// r || s as is, conform RFC 7518, subsection 3.4
+		req["marshaling_algorithm"] = "jws"
+	} else {
+		raw, err := base64.RawURLEncoding.DecodeString(sig)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: malformed signature: %w", err)
+		}
+		sig = base64.StdEncoding.EncodeToString(raw)
+	}
+	req["signature"] = "vault:v" + strconv.Itoa(k.Version) + ":" + sig
+
+	var data struct {
+		Valid bool `json:"valid"`
+	}
+	if err := k.transit.do(ctx, http.MethodPost, "verify/"+path, req, &data); err != nil {
+		return nil, err
+	}
+	if !data.Valid {
+		return nil, jwt.ErrSigMiss
+	}
+	return claims, nil
+}
+
+// Request returns the body and the path for either sign or verify. A zero hash
+// in opts is not prehashed, unless the algorithm applies one.
+func (k *Key) request(input []byte, opts crypto.SignerOpts) (req map[string]interface{}, path string, err error) {
+	req = map[string]interface{}{
+		"input":       base64.StdEncoding.EncodeToString(input),
+		"key_version": k.Version,
+	}
+	path = url.PathEscape(k.Name)
+	if k.Alg == jwt.EdDSA {
+		return req, path, nil
+	}
+
+	hash := opts.HashFunc()
+	if hash == 0 {
+		// verify of the JWS Signing Input
+		hash = jwt.ECDSAAlgs[k.Alg]
+		if _, ok := k.public.(*rsa.PublicKey); ok {
+			hash = jwt.RSAAlgs[k.Alg]
+		}
+	} else {
+		req["prehashed"] = true
+	}
+	switch hash {
+	case crypto.SHA256:
+		path += "/sha2-256"
+	case crypto.SHA384:
+		path += "/sha2-384"
+	case crypto.SHA512:
+		path += "/sha2-512"
+	default:
+		return nil, "", fmt.Errorf("vault: hash function %s not supported", hash)
+	}
+
+	if _, ok := k.public.(*rsa.PublicKey); ok {
+		if _, ok := opts.(*rsa.PSSOptions); ok || (opts.HashFunc() == 0 && k.Alg[0] == 'P') {
+			req["signature_algorithm"] = "pss"
+			req["salt_length"] = "hash"
+		} else {
+			req["signature_algorithm"] = "pkcs1v15"
+		}
+	}
+	return req, path, nil
+}
+
+// Do sends the request, and it decodes the data of a successful response.
+func (t *Transit) do(ctx context.Context, method, path string, body interface{}, data interface{}) error {
+	mount := t.Mount
+	if mount == "" {
+		mount = "transit"
+	}
+	location := strings.TrimSuffix(t.Addr, "/") + "/v1/" + mount + "/" + path
+
+	var content io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, location, content)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", t.Token)
+	if t.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", t.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		return fmt.Errorf("vault: %s %s got HTTP status %q with malformed body: %w", method, path, resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || len(envelope.Errors) != 0 {
+		return fmt.Errorf("vault: %s %s got HTTP status %q: %s", method, path, resp.Status, strings.Join(envelope.Errors, "; "))
+	}
+	if len(envelope.Data) == 0 {
+		return errors.New("vault: response without data")
+	}
+	return json.Unmarshal(envelope.Data, data)
+}
@@ -0,0 +1,238 @@
+package vault
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// FakeTransit mimics the Transit secrets engine for version 1 of each key.
+type fakeTransit struct {
+	t    *testing.T
+	keys map[string]crypto.Signer
+}
+
+func (f *fakeTransit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != "s.test" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/transit/"), "/")
+	key, ok := f.keys[path[1]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+		return
+	}
+	hash := map[string]crypto.Hash{"sha2-256": crypto.SHA256, "sha2-384": crypto.SHA384, "sha2-512": crypto.SHA512}[strings.Join(path[2:], "")]
+
+	var req struct {
+		Input         string `json:"input"`
+		Prehashed     bool   `json:"prehashed"`
+		Signature     string `json:"signature"`
+		SignatureAlg  string `json:"signature_algorithm"`
+		MarshalingAlg string `json:"marshaling_algorithm"`
+		SaltLength    string `json:"salt_length"`
+		KeyVersion    int    `json:"key_version"`
+	}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.t.Error("fake Vault request body:", err)
+		}
+		if req.KeyVersion != 1 {
+			f.t.Errorf("fake Vault got key version %d, want 1", req.KeyVersion)
+		}
+	}
+	input, _ := base64.StdEncoding.DecodeString(req.Input)
+	digest := input
+	if hash != 0 && !req.Prehashed {
+		h := hash.New()
+		h.Write(input)
+		digest = h.Sum(nil)
+	}
+	var opts crypto.SignerOpts = hash
+	if req.SignatureAlg == "pss" {
+		if req.SaltLength != "hash" {
+			f.t.Errorf("fake Vault got salt length %q, want hash", req.SaltLength)
+		}
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	}
+
+	var data interface{}
+	switch path[0] {
+	case "keys":
+		der, _ := x509.MarshalPKIXPublicKey(key.Public())
+		text := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		var keyType string
+		switch pub := key.Public().(type) {
+		case *ecdsa.PublicKey:
+			keyType = "ecdsa-p256"
+		case *rsa.PublicKey:
+			keyType = "rsa-2048"
+		case ed25519.PublicKey:
+			keyType = "ed25519"
+			text = base64.StdEncoding.EncodeToString(pub)
+		}
+		data = map[string]interface{}{
+			"type":           keyType,
+			"latest_version": 1,
+			"keys":           map[string]interface{}{"1": map[string]string{"public_key": text}},
+		}
+
+	case "sign":
+		sig, err := key.Sign(rand.Reader, digest, opts)
+		if err != nil {
+			f.t.Error("fake Vault sign:", err)
+		}
+		data = map[string]string{"signature": "vault:v1:" + base64.StdEncoding.EncodeToString(sig)}
+
+	case "verify":
+		encoded := strings.TrimPrefix(req.Signature, "vault:v1:")
+		var sig []byte
+		if req.MarshalingAlg == "jws" {
+			sig, _ = base64.RawURLEncoding.DecodeString(encoded)
+		} else {
+			sig, _ = base64.StdEncoding.DecodeString(encoded)
+		}
+		var valid bool
+		switch pub := key.Public().(type) {
+		case *ecdsa.PublicKey:
+			if req.MarshalingAlg != "jws" {
+				f.t.Errorf("fake Vault got marshaling algorithm %q, want jws", req.MarshalingAlg)
+			}
+			n := len(sig) / 2
+			valid = len(sig) == 64 && ecdsa.Verify(pub, digest, new(big.Int).SetBytes(sig[:n]), new(big.Int).SetBytes(sig[n:]))
+		case *rsa.PublicKey:
+			if pss, ok := opts.(*rsa.PSSOptions); ok {
+				valid = rsa.VerifyPSS(pub, hash, digest, sig, pss) == nil
+			} else {
+				valid = rsa.VerifyPKCS1v15(pub, hash, digest, sig) == nil
+			}
+		case ed25519.PublicKey:
+			valid = ed25519.Verify(pub, input, sig)
+		}
+		data = map[string]bool{"valid": valid}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func newFakeTransit(t *testing.T) (transit *Transit, keys map[string]crypto.Signer, close func()) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = map[string]crypto.Signer{"ec": ecKey, "rsa": rsaKey, "ed": edKey}
+
+	srv := httptest.NewServer(&fakeTransit{t: t, keys: keys})
+	return &Transit{Addr: srv.URL, Token: "s.test"}, keys, srv.Close
+}
+
+func TestSignAndCheck(t *testing.T) {
+	transit, signers, close := newFakeTransit(t)
+	defer close()
+
+	golden := []struct{ name, alg string }{
+		{"ec", jwt.ES256},
+		{"ed", jwt.EdDSA},
+		{"rsa", jwt.RS256},
+		{"rsa", jwt.PS384},
+	}
+	for _, gold := range golden {
+		key, err := transit.Key(context.Background(), gold.name)
+		if err != nil {
+			t.Fatalf("%s: key error: %s", gold.name, err)
+		}
+		key.Alg = gold.alg
+
+		var c jwt.Claims
+		c.Subject = "test"
+		token, err := c.Sign(gold.alg, key)
+		if err != nil {
+			t.Errorf("%s: sign error: %s", gold.alg, err)
+			continue
+		}
+
+		// local verification with the public key
+		var keys jwt.KeyRegister
+		switch pub := signers[gold.name].Public().(type) {
+		case *ecdsa.PublicKey:
+			keys.ECDSAs = append(keys.ECDSAs, pub)
+		case *rsa.PublicKey:
+			keys.RSAs = append(keys.RSAs, pub)
+		case ed25519.PublicKey:
+			keys.EdDSAs = append(keys.EdDSAs, pub)
+		}
+		if _, err := keys.Check(token); err != nil {
+			t.Errorf("%s: local check error: %s", gold.alg, err)
+		}
+
+		got, err := key.Check(context.Background(), token)
+		if err != nil {
+			t.Errorf("%s: Vault check error: %s", gold.alg, err)
+		} else if got.Subject != "test" {
+			t.Errorf("%s: got subject %q, want test", gold.alg, got.Subject)
+		}
+
+		// tamper with the payload
+		tampered, err := (&jwt.Claims{Registered: jwt.Registered{Subject: "root"}}).FormatWithoutSign(gold.alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tampered = append(tampered, token[strings.LastIndexByte(string(token), '.'):]...)
+		if _, err := key.Check(context.Background(), tampered); err != jwt.ErrSigMiss {
+			t.Errorf("%s: got tampered check error %v, want %v", gold.alg, err, jwt.ErrSigMiss)
+		}
+	}
+}
+
+func TestCheckAlg(t *testing.T) {
+	transit, _, close := newFakeTransit(t)
+	defer close()
+	key, err := transit.Key(context.Background(), "ec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c jwt.Claims
+	token, err := c.HMACSign(jwt.HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := key.Check(context.Background(), token); err != jwt.AlgError(jwt.HS256) {
+		t.Errorf("got error %v, want %v", err, jwt.AlgError(jwt.HS256))
+	}
+}
+
+func TestPermissionDenied(t *testing.T) {
+	transit, _, close := newFakeTransit(t)
+	defer close()
+	transit.Token = "s.wrong"
+	_, err := transit.Key(context.Background(), "ec")
+	const want = `vault: GET keys/ec got HTTP status "403 Forbidden": permission denied`
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
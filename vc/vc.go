@@ -0,0 +1,413 @@
+// Package vc provides the JWT encoding of W3C “Verifiable Credentials Data
+// Model v1.1”, section 6.3.1, with the "vc" and the "vp" claim. The properties
+// with a registered claim equivalent map to the respective jwt.Registered field.
+//
+//	vc.issuer                ⇄ iss
+//	vc.issuanceDate          ⇄ nbf
+//	vc.expirationDate        ⇄ exp
+//	vc.id                    ⇄ jti
+//	vc.credentialSubject.id  ⇄ sub
+//	vp.holder                ⇄ iss
+//	vp.id                    ⇄ jti
+//
+// Verification builds on jwt.RegisterSet, which binds the keys to the issuer.
+package vc
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// BaseContext is the mandatory first entry of "@context".
+const BaseContext = "https://www.w3.org/2018/credentials/v1"
+
+// Mandatory entries of "type".
+const (
+	TypeCredential   = "VerifiableCredential"
+	TypePresentation = "VerifiablePresentation"
+)
+
+// Credential is a verifiable credential.
+type Credential struct {
+	// Context defaults to BaseContext when empty.
+	Context []interface{}
+	// Type defaults to TypeCredential when empty.
+	Type []string
+
+	ID             string    // jti
+	Issuer         string    // iss
+	IssuanceDate   time.Time // nbf
+	ExpirationDate time.Time // exp; zero for none
+
+	// Subject has the claims about the subject, with "id" as sub.
+	Subject map[string]interface{}
+
+	// Set has any other properties of the "vc" claim.
+	Set map[string]interface{}
+}
+
+// Claims returns the JWT encoding, with the issue time as now.
+func (cred *Credential) Claims() (*jwt.Claims, error) {
+	if cred.IssuanceDate.IsZero() {
+		return nil, errors.New("vc: credential without issuance date")
+	}
+	vc := make(map[string]interface{}, len(cred.Set)+3)
+	for name, value := range cred.Set {
+		vc[name] = value
+	}
+	vc["@context"] = cred.Context
+	if len(cred.Context) == 0 {
+		vc["@context"] = []string{BaseContext}
+	}
+	vc["type"] = cred.Type
+	if len(cred.Type) == 0 {
+		vc["type"] = []string{TypeCredential}
+	}
+
+	c := &jwt.Claims{Set: map[string]interface{}{"vc": vc}}
+	c.Issuer = cred.Issuer
+	c.ID = cred.ID
+	c.IssuedNow()
+	c.NotBefore = jwt.NewNumericTime(cred.IssuanceDate)
+	c.Expires = jwt.NewNumericTime(cred.ExpirationDate)
+
+	subject := make(map[string]interface{}, len(cred.Subject))
+	for name, value := range cred.Subject {
+		if name == "id" {
+			s, ok := value.(string)
+			if !ok {
+				return nil, errors.New("vc: credential subject id not a string")
+			}
+			c.Subject = s
+			continue
+		}
+		subject[name] = value
+	}
+	vc["credentialSubject"] = subject
+	return c, nil
+}
+
+// Sign returns the credential as a JWT.
+func (cred *Credential) Sign(alg string, key crypto.PrivateKey, extraHeaders ...json.RawMessage) ([]byte, error) {
+	c, err := cred.Claims()
+	if err != nil {
+		return nil, err
+	}
+	return c.Sign(alg, key, extraHeaders...)
+}
+
+// ParseCredential returns the "vc" claim with the JWT encoding reversed. Any
+// property in the "vc" claim that has a registered claim equivalent must
+// match the registered claim if both are present.
+func ParseCredential(c *jwt.Claims) (*Credential, error) {
+	vc, ok := c.Set["vc"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("vc: no vc claim as JSON object")
+	}
+	cred := &Credential{Set: make(map[string]interface{}, len(vc))}
+	for name, value := range vc {
+		cred.Set[name] = value
+	}
+	var err error
+	cred.Context, cred.Type, err = contextAndType(cred.Set, TypeCredential)
+	if err != nil {
+		return nil, err
+	}
+
+	cred.Issuer = c.Issuer
+	if v, ok := cred.Set["issuer"]; ok {
+		delete(cred.Set, "issuer")
+		// “[…] either a URI or an object containing an id property”
+		if m, ok := v.(map[string]interface{}); ok {
+			v = m["id"]
+		}
+		s, _ := v.(string)
+		if err := match("issuer", "iss", s, cred.Issuer); err != nil {
+			return nil, err
+		}
+		cred.Issuer = s
+	}
+	if cred.Issuer == "" {
+		return nil, errors.New("vc: credential without issuer")
+	}
+
+	cred.ID = c.ID
+	if v, ok := cred.Set["id"]; ok {
+		delete(cred.Set, "id")
+		s, _ := v.(string)
+		if err := match("id", "jti", s, cred.ID); err != nil {
+			return nil, err
+		}
+		cred.ID = s
+	}
+
+	if c.NotBefore != nil {
+		cred.IssuanceDate = c.NotBefore.Time()
+	}
+	if err := dateProperty(cred.Set, "issuanceDate", &cred.IssuanceDate); err != nil {
+		return nil, err
+	}
+	if cred.IssuanceDate.IsZero() {
+		return nil, errors.New("vc: credential without issuance date")
+	}
+	if c.Expires != nil {
+		cred.ExpirationDate = c.Expires.Time()
+	}
+	if err := dateProperty(cred.Set, "expirationDate", &cred.ExpirationDate); err != nil {
+		return nil, err
+	}
+
+	subject, ok := cred.Set["credentialSubject"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("vc: credentialSubject not a JSON object")
+	}
+	delete(cred.Set, "credentialSubject")
+	cred.Subject = make(map[string]interface{}, len(subject)+1)
+	for name, value := range subject {
+		cred.Subject[name] = value
+	}
+	if v, ok := cred.Subject["id"]; ok {
+		s, _ := v.(string)
+		if err := match("credentialSubject.id", "sub", s, c.Subject); err != nil {
+			return nil, err
+		}
+	}
+	if c.Subject != "" {
+		cred.Subject["id"] = c.Subject
+	}
+	return cred, nil
+}
+
+// Check parses a credential JWT if, and only if, the signature checks out with
+// a key from the register of its issuer, and the credential is consistent with
+// the registered claims. A key ID in the form of a DID URL must be part of the
+// issuer DID. Use Claims.Valid to complete the verification.
+func Check(token []byte, issuers jwt.RegisterSet) (*jwt.Claims, *Credential, error) {
+	c, err := issuers.Check(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkKeyID(c); err != nil {
+		return nil, nil, err
+	}
+	cred, err := ParseCredential(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, cred, nil
+}
+
+// CheckKeyID enforces the issuer binding of DID URLs conform “did:jwt”
+// practice, i.e., "did:example:123#key-1" is only valid for "did:example:123".
+func checkKeyID(c *jwt.Claims) error {
+	if !strings.HasPrefix(c.KeyID, "did:") {
+		return nil
+	}
+	i := strings.IndexByte(c.KeyID, '#')
+	if i < 0 || c.KeyID[:i] != c.Issuer {
+		return fmt.Errorf("vc: key ID %q not from issuer %q", c.KeyID, c.Issuer)
+	}
+	return nil
+}
+
+// Presentation is a verifiable presentation.
+type Presentation struct {
+	// Context defaults to BaseContext when empty.
+	Context []interface{}
+	// Type defaults to TypePresentation when empty.
+	Type []string
+
+	ID     string // jti
+	Holder string // iss
+
+	// Credentials has the verifiable credentials as a JWT each.
+	Credentials []string
+
+	// Set has any other properties of the "vp" claim.
+	Set map[string]interface{}
+}
+
+// Claims returns the JWT encoding for the audience, with the nonce, if any.
+// The presentation expires in d.
+func (p *Presentation) Claims(audience, nonce string, d time.Duration) *jwt.Claims {
+	vp := make(map[string]interface{}, len(p.Set)+3)
+	for name, value := range p.Set {
+		vp[name] = value
+	}
+	vp["@context"] = p.Context
+	if len(p.Context) == 0 {
+		vp["@context"] = []string{BaseContext}
+	}
+	vp["type"] = p.Type
+	if len(p.Type) == 0 {
+		vp["type"] = []string{TypePresentation}
+	}
+	vp["verifiableCredential"] = p.Credentials
+
+	c := &jwt.Claims{Set: map[string]interface{}{"vp": vp}}
+	if nonce != "" {
+		c.Set["nonce"] = nonce
+	}
+	c.Issuer = p.Holder
+	c.ID = p.ID
+	c.Audiences = []string{audience}
+	c.ExpiresIn(d)
+	return c
+}
+
+// ParsePresentation returns the "vp" claim with the JWT encoding reversed.
+func ParsePresentation(c *jwt.Claims) (*Presentation, error) {
+	vp, ok := c.Set["vp"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("vc: no vp claim as JSON object")
+	}
+	p := &Presentation{Set: make(map[string]interface{}, len(vp))}
+	for name, value := range vp {
+		p.Set[name] = value
+	}
+	var err error
+	p.Context, p.Type, err = contextAndType(p.Set, TypePresentation)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Holder = c.Issuer
+	if v, ok := p.Set["holder"]; ok {
+		delete(p.Set, "holder")
+		s, _ := v.(string)
+		if err := match("holder", "iss", s, p.Holder); err != nil {
+			return nil, err
+		}
+		p.Holder = s
+	}
+	p.ID = c.ID
+	if v, ok := p.Set["id"]; ok {
+		delete(p.Set, "id")
+		s, _ := v.(string)
+		if err := match("id", "jti", s, p.ID); err != nil {
+			return nil, err
+		}
+		p.ID = s
+	}
+
+	switch v := p.Set["verifiableCredential"].(type) {
+	case nil:
+		break
+	case string:
+		p.Credentials = []string{v}
+	case []interface{}:
+		for _, o := range v {
+			s, ok := o.(string)
+			if !ok {
+				return nil, errors.New("vc: verifiableCredential entry not a JWT")
+			}
+			p.Credentials = append(p.Credentials, s)
+		}
+	default:
+		return nil, errors.New("vc: verifiableCredential not an array of JWTs")
+	}
+	delete(p.Set, "verifiableCredential")
+	return p, nil
+}
+
+// CheckPresentation parses a presentation JWT if, and only if, the signature
+// checks out with the holder keys, the audience and the nonce match, and each
+// of the credentials passes Check with the issuers. Both the presentation
+// and the credentials must be valid at the given moment in time.
+func CheckPresentation(token []byte, holder *jwt.KeyRegister, issuers jwt.RegisterSet, audience, nonce string, now time.Time) (*Presentation, []*Credential, error) {
+	c, err := holder.Check(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !c.Valid(now) {
+		return nil, nil, errors.New("vc: presentation not valid at current time")
+	}
+	if len(c.Audiences) == 0 || !c.AcceptAudience(audience) {
+		return nil, nil, fmt.Errorf("vc: presentation not for audience %q", audience)
+	}
+	if s, _ := c.Set["nonce"].(string); s != nonce {
+		return nil, nil, errors.New("vc: presentation nonce mismatch")
+	}
+	p, err := ParsePresentation(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	creds := make([]*Credential, len(p.Credentials))
+	for i, s := range p.Credentials {
+		c, cred, err := Check([]byte(s), issuers)
+		if err != nil {
+			return nil, nil, fmt.Errorf("vc: credential %d: %w", i, err)
+		}
+		if !c.Valid(now) {
+			return nil, nil, fmt.Errorf("vc: credential %d not valid at current time", i)
+		}
+		creds[i] = cred
+	}
+	return p, creds, nil
+}
+
+// ContextAndType validates and extracts the mandatory properties.
+func contextAndType(m map[string]interface{}, mandatoryType string) (context []interface{}, types []string, err error) {
+	context, _ = m["@context"].([]interface{})
+	if len(context) == 0 || context[0] != BaseContext {
+		return nil, nil, fmt.Errorf("vc: @context must start with %q", BaseContext)
+	}
+	delete(m, "@context")
+
+	switch v := m["type"].(type) {
+	case string:
+		types = []string{v}
+	case []interface{}:
+		for _, o := range v {
+			s, ok := o.(string)
+			if !ok {
+				return nil, nil, errors.New("vc: type entry not a string")
+			}
+			types = append(types, s)
+		}
+	}
+	delete(m, "type")
+	for _, s := range types {
+		if s == mandatoryType {
+			return context, types, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("vc: type must include %q", mandatoryType)
+}
+
+func match(property, claim, value, claimValue string) error {
+	if value == "" {
+		return fmt.Errorf("vc: %s not a string", property)
+	}
+	if claimValue != "" && value != claimValue {
+		return fmt.Errorf("vc: %s %q does not match %s claim %q", property, value, claim, claimValue)
+	}
+	return nil
+}
+
+// DateProperty moves an XML Schema dateTime from the properties, with a
+// consistency check on any existing value.
+func dateProperty(m map[string]interface{}, name string, t *time.Time) error {
+	v, ok := m[name]
+	if !ok {
+		return nil
+	}
+	delete(m, name)
+	s, _ := v.(string)
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return fmt.Errorf("vc: %s not a date-time: %w", name, err)
+	}
+	if !t.IsZero() && !parsed.Truncate(time.Second).Equal(t.Truncate(time.Second)) {
+		return fmt.Errorf("vc: %s %s does not match registered claim", name, s)
+	}
+	*t = parsed
+	return nil
+}
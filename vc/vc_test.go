@@ -0,0 +1,143 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+const testIssuer = "did:example:issuer"
+
+func TestCredentialRoundTrip(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuers := jwt.RegisterSet{testIssuer: {EdDSAs: []ed25519.PublicKey{pub}}}
+
+	issued := time.Now().Add(-time.Minute).Truncate(time.Second).UTC()
+	cred := &Credential{
+		Type:         []string{TypeCredential, "UniversityDegreeCredential"},
+		ID:           "http://example.edu/credentials/3732",
+		Issuer:       testIssuer,
+		IssuanceDate: issued,
+		Subject: map[string]interface{}{
+			"id":     "did:example:subject",
+			"degree": map[string]interface{}{"type": "BachelorDegree"},
+		},
+	}
+	token, err := cred.Sign(jwt.EdDSA, key, json.RawMessage(`{"kid":"did:example:issuer#key-1"}`))
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+
+	c, got, err := Check(token, issuers)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if c.Subject != "did:example:subject" || c.Issuer != testIssuer || c.ID != cred.ID {
+		t.Errorf("got registered claims %+v", c.Registered)
+	}
+	if !got.IssuanceDate.Equal(issued) || !got.ExpirationDate.IsZero() {
+		t.Errorf("got issuance date %s and expiration date %s, want %s and none", got.IssuanceDate, got.ExpirationDate, issued)
+	}
+	if want := []interface{}{BaseContext}; !reflect.DeepEqual(got.Context, want) {
+		t.Errorf("got context %q, want %q", got.Context, want)
+	}
+	if !reflect.DeepEqual(got.Type, cred.Type) {
+		t.Errorf("got type %q, want %q", got.Type, cred.Type)
+	}
+	if !reflect.DeepEqual(got.Subject, cred.Subject) {
+		t.Errorf("got subject %#v, want %#v", got.Subject, cred.Subject)
+	}
+	if len(got.Set) != 0 {
+		t.Errorf("got remaining properties %#v", got.Set)
+	}
+
+	// key ID from other DID
+	token, err = cred.Sign(jwt.EdDSA, key, json.RawMessage(`{"kid":"did:example:intruder#key-1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Check(token, issuers); err == nil {
+		t.Error("key ID of other DID accepted")
+	}
+}
+
+func TestParseCredentialMismatch(t *testing.T) {
+	for _, vc := range []string{
+		`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":"VerifiableCredential","issuer":"did:example:intruder","credentialSubject":{}}`,
+		`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":"VerifiableCredential","issuer":{"id":"did:example:intruder"},"credentialSubject":{}}`,
+		`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":"VerifiableCredential","credentialSubject":{"id":"did:example:intruder"}}`,
+		`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":"VerifiableCredential","issuanceDate":"2010-01-01T19:23:24Z","credentialSubject":{}}`,
+		`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":"Other","credentialSubject":{}}`,
+		`{"@context":["https://example.com/other"],"type":"VerifiableCredential","credentialSubject":{}}`,
+		`{"@context":["https://www.w3.org/2018/credentials/v1"],"type":"VerifiableCredential"}`,
+	} {
+		var c jwt.Claims
+		if err := json.Unmarshal([]byte(`{"vc":`+vc+`}`), &c.Set); err != nil {
+			t.Fatal(err)
+		}
+		c.Issuer = testIssuer
+		c.Subject = "did:example:subject"
+		c.NotBefore = jwt.NewNumericTime(time.Now().Truncate(time.Second))
+		if _, err := ParseCredential(&c); err == nil {
+			t.Errorf("vc %s accepted", vc)
+		}
+	}
+}
+
+func TestCheckPresentation(t *testing.T) {
+	issuerPub, issuerKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holderPub, holderKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuers := jwt.RegisterSet{testIssuer: {EdDSAs: []ed25519.PublicKey{issuerPub}}}
+	holder := &jwt.KeyRegister{EdDSAs: []ed25519.PublicKey{holderPub}}
+
+	cred := &Credential{
+		Issuer:         testIssuer,
+		IssuanceDate:   time.Now().Add(-time.Minute),
+		ExpirationDate: time.Now().Add(time.Hour),
+		Subject:        map[string]interface{}{"id": "did:example:holder"},
+	}
+	credJWT, err := cred.Sign(jwt.EdDSA, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Presentation{Holder: "did:example:holder", Credentials: []string{string(credJWT)}}
+	token, err := p.Claims("https://verifier.example.com", "n-0S6", time.Minute).Sign(jwt.EdDSA, holderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, creds, err := CheckPresentation(token, holder, issuers, "https://verifier.example.com", "n-0S6", time.Now())
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if got.Holder != p.Holder || !reflect.DeepEqual(got.Type, []string{TypePresentation}) {
+		t.Errorf("got presentation %+v", got)
+	}
+	if len(creds) != 1 || creds[0].Subject["id"] != "did:example:holder" {
+		t.Errorf("got credentials %+v", creds)
+	}
+
+	if _, _, err := CheckPresentation(token, holder, issuers, "https://verifier.example.com", "replay", time.Now()); err == nil {
+		t.Error("nonce mismatch accepted")
+	}
+	if _, _, err := CheckPresentation(token, holder, issuers, "https://other.example.com", "n-0S6", time.Now()); err == nil {
+		t.Error("audience mismatch accepted")
+	}
+	if _, _, err := CheckPresentation(token, holder, issuers, "https://verifier.example.com", "n-0S6", time.Now().Add(2*time.Hour)); err == nil {
+		t.Error("expired presentation accepted")
+	}
+}
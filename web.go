@@ -2,13 +2,17 @@ package jwt
 
 import (
 	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
 	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,7 +30,7 @@ var errAuthSchema = errors.New("jwt: want Bearer schema")
 // ECDSACheckHeader applies ECDSACheck on a HTTP request.
 // Specifically it looks for a bearer token in the Authorization header.
 func ECDSACheckHeader(r *http.Request, key *ecdsa.PublicKey) (*Claims, error) {
-	token, err := tokenFromHeader(r)
+	token, err := FromAuthorization(r)
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +40,7 @@ func ECDSACheckHeader(r *http.Request, key *ecdsa.PublicKey) (*Claims, error) {
 // EdDSACheckHeader applies EdDSACheck on a HTTP request.
 // Specifically it looks for a bearer token in the Authorization header.
 func EdDSACheckHeader(r *http.Request, key ed25519.PublicKey) (*Claims, error) {
-	token, err := tokenFromHeader(r)
+	token, err := FromAuthorization(r)
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +50,7 @@ func EdDSACheckHeader(r *http.Request, key ed25519.PublicKey) (*Claims, error) {
 // HMACCheckHeader applies HMACCheck on a HTTP request.
 // Specifically it looks for a bearer token in the Authorization header.
 func HMACCheckHeader(r *http.Request, secret []byte) (*Claims, error) {
-	token, err := tokenFromHeader(r)
+	token, err := FromAuthorization(r)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +60,7 @@ func HMACCheckHeader(r *http.Request, secret []byte) (*Claims, error) {
 // RSACheckHeader applies RSACheck on a HTTP request.
 // Specifically it looks for a bearer token in the Authorization header.
 func RSACheckHeader(r *http.Request, key *rsa.PublicKey) (*Claims, error) {
-	token, err := tokenFromHeader(r)
+	token, err := FromAuthorization(r)
 	if err != nil {
 		return nil, err
 	}
@@ -66,14 +70,34 @@ func RSACheckHeader(r *http.Request, key *rsa.PublicKey) (*Claims, error) {
 // CheckHeader applies KeyRegister.Check on a HTTP request.
 // Specifically it looks for a bearer token in the Authorization header.
 func (keys *KeyRegister) CheckHeader(r *http.Request) (*Claims, error) {
-	token, err := tokenFromHeader(r)
+	token, err := FromAuthorization(r)
 	if err != nil {
 		return nil, err
 	}
 	return keys.Check(token)
 }
 
-func tokenFromHeader(r *http.Request) ([]byte, error) {
+// CheckHeader applies RegisterSet.Check on a HTTP request.
+// Specifically it looks for a bearer token in the Authorization header.
+func (set RegisterSet) CheckHeader(r *http.Request) (*Claims, error) {
+	token, err := FromAuthorization(r)
+	if err != nil {
+		return nil, err
+	}
+	return set.Check(token)
+}
+
+// ErrNoToken signals an HTTP request without a token at the location of an
+// Extractor. The Authorization header has ErrNoHeader instead.
+var ErrNoToken = errors.New("jwt: no token in HTTP request")
+
+// Extractor locates a token in HTTP requests. The return is either ErrNoHeader
+// or ErrNoToken when the request has no token at the respective location.
+type Extractor func(r *http.Request) (token []byte, err error)
+
+// FromAuthorization is an Extractor for a bearer token in the Authorization
+// header, conform RFC 6750, subsection 2.1.
+func FromAuthorization(r *http.Request) (token []byte, err error) {
 	h := r.Header["Authorization"]
 	if h == nil {
 		return nil, ErrNoHeader
@@ -95,6 +119,61 @@ func tokenFromHeader(r *http.Request) ([]byte, error) {
 	return []byte(auth[len(prefix):]), nil
 }
 
+// FromCookie returns an Extractor for the value of a named cookie. Browsers
+// can't set the Authorization header on navigation or on WebSocket upgrades.
+func FromCookie(name string) Extractor {
+	return func(r *http.Request) ([]byte, error) {
+		c, err := r.Cookie(name)
+		if err != nil || c.Value == "" {
+			return nil, ErrNoToken
+		}
+		return []byte(c.Value), nil
+	}
+}
+
+// FromQuery returns an Extractor for the value of a named URI query parameter,
+// like "access_token" from RFC 6750, subsection 2.3. Note that URIs are more
+// likely to end up in logs than headers.
+func FromQuery(param string) Extractor {
+	return func(r *http.Request) ([]byte, error) {
+		s := r.URL.Query().Get(param)
+		if s == "" {
+			return nil, ErrNoToken
+		}
+		return []byte(s), nil
+	}
+}
+
+// FromHeader returns an Extractor for the value of a named HTTP header, as is,
+// i.e., without any authentication scheme.
+func FromHeader(name string) Extractor {
+	name = http.CanonicalHeaderKey(name)
+	return func(r *http.Request) ([]byte, error) {
+		h := r.Header[name]
+		if len(h) == 0 || h[0] == "" {
+			return nil, ErrNoToken
+		}
+		return []byte(h[0]), nil
+	}
+}
+
+// ExtractorChain returns an Extractor which tries each extractor in order until
+// one of them finds a token. Any error other than ErrNoHeader or ErrNoToken
+// ends the chain, as is. The return is the last absence error otherwise.
+func ExtractorChain(extractors ...Extractor) Extractor {
+	return func(r *http.Request) ([]byte, error) {
+		err := ErrNoToken
+		for _, extract := range extractors {
+			var token []byte
+			token, err = extract(r)
+			if err != ErrNoHeader && err != ErrNoToken {
+				return token, err
+			}
+		}
+		return nil, err
+	}
+}
+
 // ECDSASignHeader applies ECDSASign on a HTTP request.
 // Specifically it sets a bearer token in the Authorization header.
 func (c *Claims) ECDSASignHeader(r *http.Request, alg string, key *ecdsa.PrivateKey) error {
@@ -139,6 +218,97 @@ func (c *Claims) RSASignHeader(r *http.Request, alg string, key *rsa.PrivateKey)
 	return nil
 }
 
+// ErrCertBinding signals a token which is not bound to the TLS client
+// certificate of the request.
+var ErrCertBinding = errors.New("jwt: token not bound to client certificate")
+
+// CheckCertBinding verifies that the "x5t#S256" confirmation method from the
+// "cnf" claim matches the TLS client certificate of the request. The return is
+// ErrCertBinding, or an error wrapping ErrCertBinding, on mismatch, and on
+// absence of the claim or the certificate.
+//
+// “the protected resource MUST obtain, from its TLS implementation layer, the
+// client certificate used for mutual TLS and MUST verify that the certificate
+// matches the certificate associated with the access token” — RFC 8705,
+// subsection 3
+func (c *Claims) CheckCertBinding(r *http.Request) error {
+	cnf, ok := c.Set["cnf"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: no confirmation claim", ErrCertBinding)
+	}
+	thumbprint, ok := cnf["x5t#S256"].(string)
+	if !ok {
+		return fmt.Errorf("%w: no x5t#S256 confirmation method", ErrCertBinding)
+	}
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return fmt.Errorf("%w: no TLS client certificate", ErrCertBinding)
+	}
+
+	sum := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+	want := make([]byte, encoding.EncodedLen(len(sum)))
+	encodeBase64URL(want, sum[:])
+	if subtle.ConstantTimeCompare([]byte(thumbprint), want) != 1 {
+		return ErrCertBinding
+	}
+	return nil
+}
+
+// ErrScope signals that a token lacks the privileges for a request. It maps to
+// the "insufficient_scope" error code from RFC 6750, subsection 3.1.
+var ErrScope = errors.New("jwt: insufficient scope")
+
+var errTimeConstraints = errors.New("jwt: time constraints exceeded")
+
+// WriteError sends a response conform RFC 6750, section 3, for an error from
+// the verification process. Absence of a token, i.e., ErrNoHeader or ErrNoToken,
+// gets a plain challenge with status code 401 (Unauthorized). ErrScope, or any
+// error wrapping ErrScope, gets status code 403 (Forbidden). Any other error
+// is an "invalid_token" with status code 401, and with the error message as
+// the description.
+func WriteError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), challenge(w.Header(), err))
+}
+
+// Challenge sets the WWW-Authenticate header for err. The return is the
+// applicable HTTP status code.
+func challenge(h http.Header, err error) (statusCode int) {
+	switch {
+	case err == ErrNoHeader, err == ErrNoToken:
+		h.Set("WWW-Authenticate", "Bearer")
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrScope):
+		h.Set("WWW-Authenticate", `Bearer error="insufficient_scope", error_description=`+descriptionValue(err.Error()))
+		return http.StatusForbidden
+	default:
+		h.Set("WWW-Authenticate", `Bearer error="invalid_token", error_description=`+descriptionValue(err.Error()))
+		return http.StatusUnauthorized
+	}
+}
+
+// DescriptionValue returns s as a quoted string. Characters outside of the
+// error_description syntax from RFC 6750, subsection 3, are replaced.
+//
+//	error-description = 1*( %x20-21 / %x23-5B / %x5D-7E )
+func descriptionValue(s string) string {
+	var buf strings.Builder
+	buf.Grow(len(s) + 2)
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			buf.WriteByte('\'')
+		case r == '\\':
+			buf.WriteByte('/')
+		case r < 0x20 || r > 0x7e:
+			buf.WriteByte('?')
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
 // Handler protects an http.Handler with security enforcements.
 // Requests are only passed to Target if the JWT checks out.
 type Handler struct {
@@ -148,6 +318,23 @@ type Handler struct {
 	// Keys defines the trusted credentials.
 	Keys *KeyRegister
 
+	// Extract locates the token in requests. Nil defaults to
+	// FromAuthorization.
+	Extract Extractor
+
+	// Clock provides the time for the expiry and not-before checks
+	// of each request. Nil defaults to time.Now.
+	Clock func() time.Time
+
+	// Schema is an optional constraint on the claims content. In
+	// case of failure the request is rejected with status code 401
+	// (Unauthorized) and the SchemaError as a description.
+	Schema *Schema
+
+	// CertBound enforces certificate-bound access tokens, conform
+	// RFC 8705. See Claims.CheckCertBinding for details.
+	CertBound bool
+
 	// HeaderBinding maps JWT claim names to HTTP header names.
 	// All requests passed to Target have these headers set. In
 	// case of failure the request is rejected with status code
@@ -186,25 +373,48 @@ func (h *Handler) error(w http.ResponseWriter, error string, statusCode int) {
 
 // ServeHTTP honors the http.Handler interface.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	extract := h.Extract
+	if extract == nil {
+		extract = FromAuthorization
+	}
+
 	// verify claims
-	claims, err := h.Keys.CheckHeader(r)
+	token, err := extract(r)
+	var claims *Claims
+	if err == nil {
+		claims, err = h.Keys.Check(token)
+	}
 	if err != nil {
-		if err == ErrNoHeader {
-			w.Header().Set("WWW-Authenticate", "Bearer")
-		} else {
-			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description=`+strconv.QuoteToASCII(err.Error()))
-		}
-		h.error(w, err.Error(), http.StatusUnauthorized)
+		h.error(w, err.Error(), challenge(w.Header(), err))
 		return
 	}
 
 	// verify time constraints
-	if !claims.Valid(time.Now()) {
-		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="jwt: time constraints exceeded"`)
-		h.error(w, "jwt: time constraints exceeded", http.StatusUnauthorized)
+	now := time.Now
+	if h.Clock != nil {
+		now = h.Clock
+	}
+	if !claims.Valid(now()) {
+		h.error(w, errTimeConstraints.Error(), challenge(w.Header(), errTimeConstraints))
 		return
 	}
 
+	// verify content
+	if h.Schema != nil {
+		if err := h.Schema.Check(claims); err != nil {
+			h.error(w, err.Error(), challenge(w.Header(), err))
+			return
+		}
+	}
+
+	// verify proof-of-possession
+	if h.CertBound {
+		if err := claims.CheckCertBinding(r); err != nil {
+			h.error(w, err.Error(), challenge(w.Header(), err))
+			return
+		}
+	}
+
 	// filter request headers
 	headerPrefix := http.CanonicalHeaderKey(h.HeaderPrefix)
 	if headerPrefix != "" {
@@ -230,9 +440,8 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		s, ok := claims.String(claimName)
 		if !ok {
-			msg := "jwt: want string for claim " + claimName
-			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description=`+strconv.QuoteToASCII(msg))
-			h.error(w, msg, http.StatusUnauthorized)
+			err := errors.New("jwt: want string for claim " + claimName)
+			h.error(w, err.Error(), challenge(w.Header(), err))
 			return
 		}
 		r.Header[headerName] = []string{s}
@@ -245,3 +454,97 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	h.Target.ServeHTTP(w, r)
 }
+
+// Transport is an http.RoundTripper which sets a bearer token in the
+// Authorization header of each request, as the client-side counterpart of
+// Handler. Tokens are signed with Claims as a template. With a Lifetime, the
+// token is reused until it is about to expire. Without a Lifetime, each request
+// gets a token of its own. Any modifications to the exported fields should be
+// made before first use. Multiple goroutines may invoke RoundTrip
+// simultaneously.
+type Transport struct {
+	// Base performs the requests. Nil defaults to http.DefaultTransport.
+	Base http.RoundTripper
+
+	// Claims is the template for each token. The Registered time
+	// fields are set on each token with Lifetime. Nil is equivalent to
+	// a zero value.
+	Claims *Claims
+
+	// Alg and Key apply as with Claims.Sign.
+	Alg string
+	Key crypto.PrivateKey
+
+	// Lifetime sets the expiry relative to the issue time.
+	Lifetime time.Duration
+
+	// RenewBefore is the remaining lifetime at which tokens get
+	// replaced. Zero defaults to a tenth of Lifetime.
+	RenewBefore time.Duration
+
+	mutex  sync.Mutex
+	token  string  // cached Authorization value
+	claims *Claims // cached token content
+}
+
+// RoundTrip honors the http.RoundTripper interface. The request is cloned
+// before the Authorization header is set, as required for RoundTrippers.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	token, err := t.authorization()
+	if err != nil {
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return nil, err
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", token)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
+
+// Authorization returns the header value, with cache use when applicable.
+func (t *Transport) authorization() (string, error) {
+	if t.Lifetime <= 0 {
+		token, _, err := t.mint()
+		return token, err
+	}
+
+	renewBefore := t.RenewBefore
+	if renewBefore == 0 {
+		renewBefore = t.Lifetime / 10
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.token != "" && !t.claims.ShouldRenew(renewBefore, time.Now()) {
+		return t.token, nil
+	}
+	token, claims, err := t.mint()
+	if err != nil {
+		return "", err
+	}
+	t.token, t.claims = token, claims
+	return token, nil
+}
+
+func (t *Transport) mint() (authorization string, c *Claims, err error) {
+	c = new(Claims)
+	if t.Claims != nil {
+		c = t.Claims.Clone()
+	}
+	if t.Lifetime > 0 {
+		c.ExpiresIn(t.Lifetime)
+	}
+
+	token, err := c.Sign(t.Alg, t.Key)
+	if err != nil {
+		return "", nil, err
+	}
+	return "Bearer " + string(token), c, nil
+}
@@ -0,0 +1,191 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// WebhookHeader is the HTTP header name for detached webhook signatures.
+const WebhookHeader = "X-JWS-Signature"
+
+var (
+	errWebhookDetached = errors.New("jwt: webhook signature not a detached JWS")
+	errWebhookTime     = errors.New("jwt: webhook timestamp outside tolerance")
+	errWebhookID       = errors.New("jwt: webhook signature without ID")
+	errWebhookSize     = errors.New("jwt: webhook body exceeds size limit")
+)
+
+// WebhookSigner signs outbound webhook bodies as a JWS with detached content,
+// conform RFC 7515, appendix F. The JOSE header has the time of signing as
+// "iat", and a random "jti" for replay protection. Consumers can verify with
+// any JOSE implementation: they put the base64url encoding of the body in
+// between the two dots. Any modifications to the exported fields should be
+// made before first use.
+type WebhookSigner struct {
+	// Alg and Key apply as with SignBytes.
+	Alg string
+	Key crypto.PrivateKey
+	// KeyID is the optional "kid" for the JOSE header.
+	KeyID string
+
+	// Clock provides the time of signing. Nil defaults to time.Now.
+	Clock func() time.Time
+}
+
+// Sign returns the detached JWS of body, in the compact serialization without
+// the payload part, i.e., "header..signature".
+func (s *WebhookSigner) Sign(body []byte) (signature []byte, err error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	now := time.Now
+	if s.Clock != nil {
+		now = s.Clock
+	}
+	header := map[string]interface{}{
+		"iat": now().Unix(),
+		"jti": encoding.EncodeToString(id[:]),
+	}
+	if s.KeyID != "" {
+		header[headerKeyID] = s.KeyID
+	}
+	extra, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := SignBytes(body, s.Alg, s.Key, extra)
+	if err != nil {
+		return nil, err
+	}
+	firstDot := bytes.IndexByte(token, '.')
+	lastDot := bytes.LastIndexByte(token, '.')
+	return append(token[:firstDot+1], token[lastDot:]...), nil
+}
+
+// SignRequest sets the body on r, with the detached JWS in WebhookHeader.
+func (s *WebhookSigner) SignRequest(r *http.Request, body []byte) error {
+	signature, err := s.Sign(body)
+	if err != nil {
+		return err
+	}
+	r.Header.Set(WebhookHeader, string(signature))
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return nil
+}
+
+// WebhookVerifier validates webhook bodies with a detached JWS, as produced by
+// WebhookSigner. Any modifications to the exported fields should be made before
+// first use.
+type WebhookVerifier struct {
+	// Keys defines the trusted credentials.
+	Keys *KeyRegister
+
+	// Tolerance is the maximum difference between the "iat" of the JOSE
+	// header and the current time, in either direction. Zero defaults to
+	// five minutes.
+	Tolerance time.Duration
+
+	// Replay receives the "jti" of each signature verified, until the
+	// Tolerance passed. Signatures with an ID denied get ErrRevoked. See
+	// RevokeOnce for concurrent use. Nil disables replay protection.
+	Replay Revocation
+
+	// MaxBodySize limits VerifyRequest. Zero defaults to one MiB.
+	MaxBodySize int64
+
+	// Clock provides the time for the Tolerance. Nil defaults to time.Now.
+	Clock func() time.Time
+}
+
+func (v *WebhookVerifier) tolerance() time.Duration {
+	if v.Tolerance > 0 {
+		return v.Tolerance
+	}
+	return 5 * time.Minute
+}
+
+// Verify returns the JOSE header of signature if, and only if, it checks out on
+// body, within the Tolerance, and with an ID not seen before by Replay.
+func (v *WebhookVerifier) Verify(body, signature []byte) (*Header, error) {
+	firstDot := bytes.IndexByte(signature, '.')
+	if firstDot < 0 || firstDot+1 >= len(signature) || signature[firstDot+1] != '.' {
+		return nil, errWebhookDetached
+	}
+	token := make([]byte, 0, len(signature)+encoding.EncodedLen(len(body)))
+	token = append(token, signature[:firstDot+1]...)
+	token = append(token, encoding.EncodeToString(body)...)
+	token = append(token, signature[firstDot+1:]...)
+	if _, err := v.Keys.VerifyBytes(token); err != nil {
+		return nil, err
+	}
+
+	header, err := PeekHeader(token)
+	if err != nil {
+		return nil, err
+	}
+	iat, ok := jsonNumber(header.Set["iat"])
+	if !ok {
+		return nil, errWebhookTime
+	}
+	now := time.Now
+	if v.Clock != nil {
+		now = v.Clock
+	}
+	signed := time.Unix(int64(iat), 0)
+	if d := now().Sub(signed); d > v.tolerance() || d < -v.tolerance() {
+		return nil, errWebhookTime
+	}
+
+	if v.Replay != nil {
+		id, _ := header.Set["jti"].(string)
+		if id == "" {
+			return nil, errWebhookID
+		}
+		if err := useOnce(v.Replay, id, signed.Add(v.tolerance())); err != nil {
+			return nil, err
+		}
+	}
+	return header, nil
+}
+
+// VerifyRequest reads the body of r, and it applies Verify with the signature
+// from WebhookHeader. The body of r is replaced for subsequent reads.
+func (v *WebhookVerifier) VerifyRequest(r *http.Request) (body []byte, err error) {
+	signature := r.Header.Get(WebhookHeader)
+	if signature == "" {
+		return nil, fmt.Errorf("jwt: no %s header in webhook request", WebhookHeader)
+	}
+
+	limit := v.MaxBodySize
+	if limit <= 0 {
+		limit = 1 << 20
+	}
+	body, err = ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, errWebhookSize
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if _, err := v.Verify(body, []byte(signature)); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
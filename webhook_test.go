@@ -0,0 +1,140 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	signer := &WebhookSigner{
+		Alg:   ES256,
+		Key:   testKeyEC256,
+		KeyID: "hook1",
+		Clock: func() time.Time { return now },
+	}
+	verifier := &WebhookVerifier{
+		Keys:   &KeyRegister{ECDSAs: []*ecdsa.PublicKey{&testKeyEC256.PublicKey}},
+		Replay: new(RevocationList),
+		Clock:  func() time.Time { return now },
+	}
+
+	body := []byte(`{"event":"order.paid"}`)
+	signature, err := signer.Sign(body)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if n := bytes.Count(signature, []byte(".")); n != 2 || !bytes.Contains(signature, []byte("..")) {
+		t.Fatalf("got signature %q, want detached payload", signature)
+	}
+
+	// attached payload is a regular JWS
+	first := bytes.IndexByte(signature, '.')
+	attached := string(signature[:first+1]) + encoding.EncodeToString(body) + string(signature[first+1:])
+	payload, err := verifier.Keys.VerifyBytes([]byte(attached))
+	if err != nil || string(payload) != string(body) {
+		t.Errorf("got (%q, %v) for attached payload, want (%q, nil)", payload, err, body)
+	}
+
+	header, err := verifier.Verify(body, signature)
+	if err != nil {
+		t.Fatal("verify error:", err)
+	}
+	if header.KeyID != "hook1" || header.Set["iat"] != float64(now.Unix()) {
+		t.Errorf("got kid %q and iat %v, want hook1 and %d", header.KeyID, header.Set["iat"], now.Unix())
+	}
+
+	if _, err := verifier.Verify(body, signature); err != ErrRevoked {
+		t.Errorf("got error %v on replay, want %v", err, ErrRevoked)
+	}
+	signature, err = signer.Sign(body)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := verifier.Verify([]byte(`{"event":"order.refunded"}`), signature); err != ErrSigMiss {
+		t.Errorf("got error %v for other body, want %v", err, ErrSigMiss)
+	}
+	now = now.Add(6 * time.Minute)
+	if _, err := verifier.Verify(body, signature); err != errWebhookTime {
+		t.Errorf("got error %v after tolerance, want %v", err, errWebhookTime)
+	}
+	if _, err := verifier.Verify(body, []byte(attached)); err != errWebhookDetached {
+		t.Errorf("got error %v for attached payload, want %v", err, errWebhookDetached)
+	}
+}
+
+func TestWebhookRequest(t *testing.T) {
+	signer := &WebhookSigner{Alg: HS256, Key: []byte("guest")}
+	verifier := &WebhookVerifier{
+		Keys:        &KeyRegister{Secrets: [][]byte{[]byte("guest")}},
+		MaxBodySize: 64,
+	}
+
+	body := []byte("plain text")
+	r := httptest.NewRequest("POST", "/hook", nil)
+	if err := signer.SignRequest(r, body); err != nil {
+		t.Fatal("sign error:", err)
+	}
+	got, err := verifier.VerifyRequest(r)
+	if err != nil {
+		t.Fatal("verify error:", err)
+	}
+	if string(got) != string(body) {
+		t.Errorf("got body %q, want %q", got, body)
+	}
+	if again, _ := ioutil.ReadAll(r.Body); string(again) != string(body) {
+		t.Errorf("got body %q on second read, want %q", again, body)
+	}
+
+	r = httptest.NewRequest("POST", "/hook", nil)
+	if err := signer.SignRequest(r, bytes.Repeat([]byte{'x'}, 65)); err != nil {
+		t.Fatal("sign error:", err)
+	}
+	if _, err := verifier.VerifyRequest(r); err != errWebhookSize {
+		t.Errorf("got error %v, want %v", err, errWebhookSize)
+	}
+
+	r = httptest.NewRequest("POST", "/hook", bytes.NewReader(body))
+	if _, err := verifier.VerifyRequest(r); err == nil {
+		t.Error("no error without signature header")
+	}
+}
+
+func TestWebhookConcurrentReplay(t *testing.T) {
+	signer := &WebhookSigner{Alg: ES256, Key: testKeyEC256}
+	verifier := &WebhookVerifier{
+		Keys:   &KeyRegister{ECDSAs: []*ecdsa.PublicKey{&testKeyEC256.PublicKey}},
+		Replay: new(RevocationList),
+	}
+	body := []byte(`{"event":"order.paid"}`)
+	signature, err := signer.Sign(body)
+	if err != nil {
+		t.Fatal("sign error:", err)
+	}
+
+	errs := make(chan error)
+	for i := 0; i < 16; i++ {
+		go func() {
+			_, err := verifier.Verify(body, signature)
+			errs <- err
+		}()
+	}
+	var passes int
+	for i := 0; i < 16; i++ {
+		switch err := <-errs; err {
+		case nil:
+			passes++
+		case ErrRevoked:
+			break
+		default:
+			t.Error("verify error:", err)
+		}
+	}
+	if passes != 1 {
+		t.Errorf("got %d passes on concurrent replay, want 1", passes)
+	}
+}
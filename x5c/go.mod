@@ -0,0 +1,8 @@
+module github.com/pascaldekloe/jwt/x5c
+
+go 1.26.0
+
+require (
+	github.com/pascaldekloe/jwt v1.13.0
+	golang.org/x/crypto v0.57.0
+)
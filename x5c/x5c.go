@@ -0,0 +1,286 @@
+// Package x5c verifies tokens with the X.509 certificate chain from the "x5c"
+// JOSE header parameter, conform RFC 7515, subsection 4.1.6. The leaf key must
+// chain to a trusted root before it verifies any signature. Revocation checks
+// are optional, with OCSP (including stapled responses) and CRLs as a fallback.
+package x5c
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ErrNoChain signals a token without any "x5c" header parameter.
+var ErrNoChain = errors.New("x5c: no certificate chain in JOSE header")
+
+// ErrStatusUnknown signals absence of a revocation status. Verifier.SoftFail
+// accepts the certificate in such case.
+var ErrStatusUnknown = errors.New("x5c: certificate revocation status unknown")
+
+// Verifier checks tokens with the certificate chain from their header. Any
+// modifications to the exported fields should be made before first use.
+// Multiple goroutines may invoke methods on a Verifier simultaneously.
+type Verifier struct {
+	// Roots are the trust anchors. Nil defaults to the system pool.
+	Roots *x509.CertPool
+
+	// KeyUsages constrains the extended key usage of the chain. Nil
+	// accepts any.
+	KeyUsages []x509.ExtKeyUsage
+
+	// CheckRevocation enables OCSP and CRL checks on the leaf.
+	CheckRevocation bool
+
+	// SoftFail accepts certificates when the revocation status can't be
+	// determined, e.g., due to network failure. Revoked certificates
+	// are always rejected.
+	SoftFail bool
+
+	// Client performs OCSP requests and CRL fetches. Nil defaults to
+	// http.DefaultClient.
+	Client *http.Client
+
+	// Clock provides the time for chain and response validation. Nil
+	// defaults to time.Now.
+	Clock func() time.Time
+
+	mutex sync.Mutex
+	crls  map[string]*x509.RevocationList // cache per distribution point
+}
+
+// Check parses a JWT if, and only if, the signature checks out with the leaf
+// certificate of a trusted chain, and, with CheckRevocation, if the leaf is not
+// revoked. Revoked certificates get an error wrapping jwt.ErrRevoked. Use
+// jwt.Claims.Valid to complete the verification.
+func (v *Verifier) Check(ctx context.Context, token []byte) (*jwt.Claims, error) {
+	return v.CheckStapled(ctx, token, nil)
+}
+
+// CheckStapled is like Check, with a DER-encoded OCSP response for the leaf as
+// an alternative to a request to the OCSP responder. A nil staple is ignored.
+func (v *Verifier) CheckStapled(ctx context.Context, token, staple []byte) (*jwt.Claims, error) {
+	header, err := jwt.PeekHeader(token)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := parseChain(header.Set["x5c"])
+	if err != nil {
+		return nil, err
+	}
+	leaf := chain[0]
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	keyUsages := v.KeyUsages
+	if keyUsages == nil {
+		keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	verified, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         v.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   v.now(),
+		KeyUsages:     keyUsages,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("x5c: certificate chain rejected: %w", err)
+	}
+
+	if v.CheckRevocation {
+		issuer := leaf
+		if len(verified[0]) > 1 {
+			issuer = verified[0][1]
+		}
+		err := v.revocation(ctx, leaf, issuer, staple)
+		if err == ErrStatusUnknown && v.SoftFail {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var keys jwt.KeyRegister
+	switch pub := leaf.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		keys.ECDSAs = []*ecdsa.PublicKey{pub}
+	case *rsa.PublicKey:
+		keys.RSAs = []*rsa.PublicKey{pub}
+	case ed25519.PublicKey:
+		keys.EdDSAs = []ed25519.PublicKey{pub}
+	default:
+		return nil, fmt.Errorf("x5c: unsupported public key type %T", pub)
+	}
+	return keys.Check(token)
+}
+
+func parseChain(x5c interface{}) ([]*x509.Certificate, error) {
+	array, ok := x5c.([]interface{})
+	if !ok || len(array) == 0 {
+		return nil, ErrNoChain
+	}
+	chain := make([]*x509.Certificate, len(array))
+	for i, v := range array {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("x5c: certificate chain entry not a string")
+		}
+		// “base64-encoded (Section 4 of [RFC4648] -- not base64url-encoded) DER”
+		der, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("x5c: certificate chain entry %d: %w", i, err)
+		}
+		chain[i], err = x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("x5c: certificate chain entry %d: %w", i, err)
+		}
+	}
+	return chain, nil
+}
+
+func (v *Verifier) now() time.Time {
+	if v.Clock != nil {
+		return v.Clock()
+	}
+	return time.Now()
+}
+
+func (v *Verifier) client() *http.Client {
+	if v.Client != nil {
+		return v.Client
+	}
+	return http.DefaultClient
+}
+
+// Revocation returns nil when the certificate is good, ErrStatusUnknown when
+// undetermined, or any other error for rejection.
+func (v *Verifier) revocation(ctx context.Context, cert, issuer *x509.Certificate, staple []byte) error {
+	if staple != nil {
+		return v.evalOCSP(staple, cert, issuer)
+	}
+
+	for _, server := range cert.OCSPServer {
+		resp, err := v.fetchOCSP(ctx, server, cert, issuer)
+		if err != nil {
+			continue // try next; CRL as fallback
+		}
+		if err := v.evalOCSP(resp, cert, issuer); err != ErrStatusUnknown {
+			return err
+		}
+	}
+
+	for _, point := range cert.CRLDistributionPoints {
+		crl, err := v.crl(ctx, point, issuer)
+		if err != nil {
+			continue
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("x5c: certificate serial %s revoked at %s per CRL: %w", cert.SerialNumber, entry.RevocationTime.UTC().Format(time.RFC3339), jwt.ErrRevoked)
+			}
+		}
+		return nil
+	}
+	return ErrStatusUnknown
+}
+
+func (v *Verifier) evalOCSP(der []byte, cert, issuer *x509.Certificate) error {
+	resp, err := ocsp.ParseResponseForCert(der, cert, issuer)
+	if err != nil {
+		return ErrStatusUnknown
+	}
+	now := v.now()
+	if now.Before(resp.ThisUpdate) || (!resp.NextUpdate.IsZero() && now.After(resp.NextUpdate)) {
+		return ErrStatusUnknown // stale
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("x5c: certificate serial %s revoked at %s per OCSP: %w", cert.SerialNumber, resp.RevokedAt.UTC().Format(time.RFC3339), jwt.ErrRevoked)
+	default:
+		return ErrStatusUnknown
+	}
+}
+
+func (v *Verifier) fetchOCSP(ctx context.Context, server string, cert, issuer *x509.Certificate) ([]byte, error) {
+	body, err := ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: crypto.SHA256})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+	return v.fetch(req)
+}
+
+// Crl returns the revocation list with caching until its next update.
+func (v *Verifier) crl(ctx context.Context, location string, issuer *x509.Certificate) (*x509.RevocationList, error) {
+	now := v.now()
+	v.mutex.Lock()
+	cached := v.crls[location]
+	v.mutex.Unlock()
+	if cached != nil && now.Before(cached.NextUpdate) {
+		return cached, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	der, err := v.fetch(req)
+	if err != nil {
+		return nil, err
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return nil, err
+	}
+	if !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate) {
+		return nil, errors.New("x5c: CRL expired")
+	}
+
+	v.mutex.Lock()
+	if v.crls == nil {
+		v.crls = make(map[string]*x509.RevocationList)
+	}
+	v.crls[location] = crl
+	v.mutex.Unlock()
+	return crl, nil
+}
+
+// MaxResponseSize limits OCSP responses and CRLs in bytes.
+const maxResponseSize = 10 << 20
+
+func (v *Verifier) fetch(req *http.Request) ([]byte, error) {
+	resp, err := v.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("x5c: %s got HTTP status %q", req.URL, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
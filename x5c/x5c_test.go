@@ -0,0 +1,267 @@
+package x5c
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+	"golang.org/x/crypto/ocsp"
+)
+
+// TestPKI is a CA with an OCSP responder and a CRL endpoint.
+type testPKI struct {
+	t       *testing.T
+	caKey   *ecdsa.PrivateKey
+	ca      *x509.Certificate
+	roots   *x509.CertPool
+	srv     *httptest.Server
+	revoked map[int64]bool // by serial
+	ocspOff bool           // responder down
+	crlHits int32
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	p := &testPKI{t: t, revoked: make(map[int64]bool)}
+	var err error
+	p.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &p.caKey.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ca, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.roots = x509.NewCertPool()
+	p.roots.AddCert(p.ca)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ocsp", p.serveOCSP)
+	mux.HandleFunc("/crl", p.serveCRL)
+	p.srv = httptest.NewServer(mux)
+	return p
+}
+
+func (p *testPKI) response(serial *big.Int) []byte {
+	template := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: serial,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}
+	if p.revoked[serial.Int64()] {
+		template.Status = ocsp.Revoked
+		template.RevokedAt = time.Now().Add(-time.Minute)
+	}
+	der, err := ocsp.CreateResponse(p.ca, p.ca, template, p.caKey)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return der
+}
+
+func (p *testPKI) serveOCSP(w http.ResponseWriter, r *http.Request) {
+	if p.ocspOff {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	req, err := ocsp.ParseRequest(body)
+	if err != nil {
+		p.t.Error("OCSP request:", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(p.response(req.SerialNumber))
+}
+
+func (p *testPKI) serveCRL(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&p.crlHits, 1)
+	template := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for serial := range p.revoked {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, p.ca, p.caKey)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	w.Write(der)
+}
+
+// Token returns a token signed by a new leaf with the serial number.
+func (p *testPKI) token(serial int64, ocspServer, crlPoint bool) (token []byte, leaf *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if ocspServer {
+		template.OCSPServer = []string{p.srv.URL + "/ocsp"}
+	}
+	if crlPoint {
+		template.CRLDistributionPoints = []string{p.srv.URL + "/crl"}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	leaf, err = x509.ParseCertificate(der)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	header, err := json.Marshal(map[string]interface{}{"x5c": []string{base64.StdEncoding.EncodeToString(der)}})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	var c jwt.Claims
+	c.Subject = "test"
+	token, err = c.ECDSASign(jwt.ES256, key, header)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return token, leaf
+}
+
+func TestCheckChain(t *testing.T) {
+	p := newTestPKI(t)
+	defer p.srv.Close()
+	token, _ := p.token(2, false, false)
+
+	v := &Verifier{Roots: p.roots}
+	claims, err := v.Check(context.Background(), token)
+	if err != nil {
+		t.Fatal("check error:", err)
+	}
+	if claims.Subject != "test" {
+		t.Errorf("got subject %q, want test", claims.Subject)
+	}
+
+	if _, err := (&Verifier{Roots: x509.NewCertPool()}).Check(context.Background(), token); err == nil {
+		t.Error("untrusted chain accepted")
+	}
+
+	var c jwt.Claims
+	plain, err := c.HMACSign(jwt.HS256, []byte("guest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Check(context.Background(), plain); err != ErrNoChain {
+		t.Errorf("got error %v, want %v", err, ErrNoChain)
+	}
+}
+
+func TestCheckRevocationOCSP(t *testing.T) {
+	p := newTestPKI(t)
+	defer p.srv.Close()
+	v := &Verifier{Roots: p.roots, CheckRevocation: true}
+
+	good, _ := p.token(2, true, false)
+	if _, err := v.Check(context.Background(), good); err != nil {
+		t.Error("good certificate error:", err)
+	}
+
+	p.revoked[3] = true
+	revoked, _ := p.token(3, true, false)
+	if _, err := v.Check(context.Background(), revoked); !errors.Is(err, jwt.ErrRevoked) {
+		t.Errorf("got error %v, want %v", err, jwt.ErrRevoked)
+	}
+
+	p.ocspOff = true
+	if _, err := v.Check(context.Background(), good); err != ErrStatusUnknown {
+		t.Errorf("got error %v with responder down, want %v", err, ErrStatusUnknown)
+	}
+	v.SoftFail = true
+	if _, err := v.Check(context.Background(), good); err != nil {
+		t.Error("soft fail error:", err)
+	}
+	if _, err := v.Check(context.Background(), revoked); err != nil {
+		t.Error("soft fail error, as status unknown:", err)
+	}
+}
+
+func TestCheckStapled(t *testing.T) {
+	p := newTestPKI(t)
+	defer p.srv.Close()
+	v := &Verifier{Roots: p.roots, CheckRevocation: true}
+
+	// no responder nor CRL in the certificate
+	token, leaf := p.token(2, false, false)
+	if _, err := v.Check(context.Background(), token); err != ErrStatusUnknown {
+		t.Errorf("got error %v without staple, want %v", err, ErrStatusUnknown)
+	}
+	if _, err := v.CheckStapled(context.Background(), token, p.response(leaf.SerialNumber)); err != nil {
+		t.Error("stapled error:", err)
+	}
+	p.revoked[2] = true
+	if _, err := v.CheckStapled(context.Background(), token, p.response(leaf.SerialNumber)); !errors.Is(err, jwt.ErrRevoked) {
+		t.Errorf("got stapled error %v, want %v", err, jwt.ErrRevoked)
+	}
+
+	// stale staple
+	v.Clock = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := v.CheckStapled(context.Background(), token, p.response(leaf.SerialNumber)); err == nil {
+		t.Error("stale staple accepted")
+	}
+}
+
+func TestCheckRevocationCRL(t *testing.T) {
+	p := newTestPKI(t)
+	defer p.srv.Close()
+	p.ocspOff = true // fallback to CRL
+	v := &Verifier{Roots: p.roots, CheckRevocation: true}
+
+	p.revoked[3] = true
+	good, _ := p.token(2, true, true)
+	revoked, _ := p.token(3, true, true)
+	for i := 0; i < 2; i++ {
+		if _, err := v.Check(context.Background(), good); err != nil {
+			t.Error("good certificate error:", err)
+		}
+		if _, err := v.Check(context.Background(), revoked); !errors.Is(err, jwt.ErrRevoked) {
+			t.Errorf("got error %v, want %v", err, jwt.ErrRevoked)
+		}
+	}
+	if n := atomic.LoadInt32(&p.crlHits); n != 1 {
+		t.Errorf("got %d CRL fetches, want 1 due caching", n)
+	}
+}